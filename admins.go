@@ -0,0 +1,610 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Параметры хеширования паролей администраторов (PBKDF2-HMAC-SHA256)
+const (
+	adminHashIterations = 210000
+	adminSaltSize       = 16
+	adminKeySize        = 32
+	adminMinPassword    = 8
+
+	// Учетная запись, создаваемая из admin_password при пустом хранилище
+	// и используемая, если заголовок X-Admin-User не передан
+	defaultAdminName = "admin"
+
+	// Имя, под которым действует статический admin_token
+	adminTokenName = "admin_token"
+
+	// Сколько помнится успешная проверка пароля: клиенты с X-Admin-Password передают
+	// его в каждом запросе, а хеширование занимает десятки миллисекунд процессора
+	adminVerifyCacheTTL = time.Minute
+)
+
+var adminNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// AdminAccount - учетная запись администратора; пароль хранится только в виде хеша
+type AdminAccount struct {
+	Name       string    `json:"name"`
+	Role       string    `json:"role"` // пусто в файлах до появления ролей - admin
+	Salt       string    `json:"salt"`
+	Hash       string    `json:"hash"`
+	Iterations int       `json:"iterations"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// adminStore - учетные записи администраторов, сохраняемые в data_dir/admins.json.
+// Файл перечитывается при изменении, поэтому "admin reset" и "admin role" действуют
+// на работающий сервер без перезапуска
+type adminStore struct {
+	mu       sync.RWMutex
+	accounts map[string]AdminAccount
+	verified map[[sha256.Size]byte]verifiedPassword // отпечаток недавно проверенного пароля
+	path     string                                 // файл, из которого загружены записи
+	modTime  time.Time                              // время изменения файла при загрузке
+}
+
+// verifiedPassword - запомненная успешная проверка пароля
+type verifiedPassword struct {
+	name  string
+	until time.Time
+}
+
+var admins = &adminStore{accounts: make(map[string]AdminAccount)}
+
+// adminVerifyKey - ключ отпечатков проверенных паролей; живет только в памяти процесса
+var adminVerifyKey = func() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+// pbkdf2SHA256 - PBKDF2 (RFC 8018) с HMAC-SHA256
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	blocks := (keyLen + hashLen - 1) / hashLen
+
+	key := make([]byte, 0, blocks*hashLen)
+	var counter [4]byte
+	u := make([]byte, hashLen)
+	t := make([]byte, hashLen)
+	for block := 1; block <= blocks; block++ {
+		binary.BigEndian.PutUint32(counter[:], uint32(block))
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(counter[:])
+		u = prf.Sum(u[:0])
+		copy(t, u)
+
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
+
+// newAdminAccount создает запись с новой солью
+func newAdminAccount(name, password string) (AdminAccount, error) {
+	salt := make([]byte, adminSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return AdminAccount{}, err
+	}
+	now := time.Now().UTC()
+	return AdminAccount{
+		Name:       name,
+		Salt:       base64.StdEncoding.EncodeToString(salt),
+		Hash:       base64.StdEncoding.EncodeToString(pbkdf2SHA256([]byte(password), salt, adminHashIterations, adminKeySize)),
+		Iterations: adminHashIterations,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}, nil
+}
+
+// matches сравнивает пароль с хешем за постоянное время. Пустой или укороченный хеш
+// в поврежденном файле не должен совпадать с любым паролем
+func (a AdminAccount) matches(password string) bool {
+	salt, err := base64.StdEncoding.DecodeString(a.Salt)
+	if err != nil || len(salt) < adminSaltSize {
+		return false
+	}
+	expected, err := base64.StdEncoding.DecodeString(a.Hash)
+	if err != nil || len(expected) < adminKeySize || a.Iterations <= 0 {
+		return false
+	}
+	actual := pbkdf2SHA256([]byte(password), salt, a.Iterations, len(expected))
+	return subtle.ConstantTimeCompare(actual, expected) == 1
+}
+
+// fingerprint - отпечаток пароля для кеша проверок. В него входит хеш учетной записи,
+// поэтому после смены пароля прежние отпечатки перестают совпадать
+func (a AdminAccount) fingerprint(password string) [sha256.Size]byte {
+	mac := hmac.New(sha256.New, adminVerifyKey)
+	mac.Write([]byte(a.Name + "\x00" + a.Hash + "\x00" + password))
+	var sum [sha256.Size]byte
+	mac.Sum(sum[:0])
+	return sum
+}
+
+// validateAdminCredentials проверяет имя и пароль новой учетной записи
+func validateAdminCredentials(name, password string) error {
+	if !adminNamePattern.MatchString(name) {
+		return errors.New("admin name must be 1-64 characters: letters, digits, '_', '.', '-'")
+	}
+	if name == adminTokenName {
+		return fmt.Errorf("admin name %q is reserved", adminTokenName)
+	}
+	if len(password) < adminMinPassword {
+		return fmt.Errorf("password must be at least %d characters", adminMinPassword)
+	}
+	return nil
+}
+
+// Load читает учетные записи из файла и запоминает его для reloadIfChanged
+func (s *adminStore) Load(path string) (bool, error) {
+	var modTime time.Time
+	if info, err := os.Stat(path); err == nil {
+		modTime = info.ModTime()
+	}
+	var accounts []AdminAccount
+	found, err := loadJSONFile(path, &accounts)
+
+	s.mu.Lock()
+	s.path, s.modTime = path, modTime
+	if err != nil || !found {
+		s.mu.Unlock()
+		return false, err
+	}
+
+	loaded := make(map[string]AdminAccount, len(accounts))
+	for _, account := range accounts {
+		if account.Role == "" {
+			account.Role = roleAdmin
+		}
+		loaded[account.Name] = account
+	}
+	// Запомненные проверки сменившихся или удаленных паролей больше не действуют,
+	// а сессии, выданные по старому паролю, отзываются
+	var reset []string
+	for name, previous := range s.accounts {
+		account, exists := loaded[name]
+		if !exists || account.Hash != previous.Hash {
+			s.forgetVerifiedLocked(name)
+		}
+		if exists && account.Hash != previous.Hash {
+			reset = append(reset, name)
+		}
+	}
+	s.accounts = loaded
+	s.mu.Unlock()
+
+	for _, name := range reset {
+		if err := revokeAdminSessions(name); err != nil {
+			return true, fmt.Errorf("revoke sessions of %s: %w", name, err)
+		}
+	}
+	return true, nil
+}
+
+// reloadIfChanged перечитывает файл, если его изменила другая команда, например "admin reset".
+// Ошибка чтения оставляет прежние записи до следующего изменения файла
+func (s *adminStore) reloadIfChanged() {
+	s.mu.RLock()
+	path, modTime := s.path, s.modTime
+	s.mu.RUnlock()
+	if path == "" {
+		return
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || info.ModTime().Equal(modTime) {
+		return
+	}
+	if _, err := s.Load(path); err != nil {
+		logHTTP.Error("ошибка перечитывания учетных записей администраторов", "file", path, "error", err)
+		return
+	}
+	logHTTP.Info("учетные записи администраторов перечитаны", "file", path, "admins", len(s.Names()))
+}
+
+// forgetVerifiedLocked удаляет запомненные проверки пароля учетной записи
+func (s *adminStore) forgetVerifiedLocked(name string) {
+	for fingerprint, entry := range s.verified {
+		if entry.name == name {
+			delete(s.verified, fingerprint)
+		}
+	}
+}
+
+// Save записывает учетные записи в файл
+func (s *adminStore) Save(path string) error {
+	s.mu.RLock()
+	accounts := make([]AdminAccount, 0, len(s.accounts))
+	for _, account := range s.accounts {
+		accounts = append(accounts, account)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].Name < accounts[j].Name })
+	if err := saveJSONFile(path, accounts); err != nil {
+		return err
+	}
+
+	// Собственная запись не должна вызывать перечитывание
+	if info, err := os.Stat(path); err == nil {
+		s.mu.Lock()
+		if s.path == path {
+			s.modTime = info.ModTime()
+		}
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// Set создает учетную запись с ролью admin или меняет пароль существующей и отзывает ее сессии
+func (s *adminStore) Set(name, password string) error {
+	if err := validateAdminCredentials(name, password); err != nil {
+		return err
+	}
+	account, err := newAdminAccount(name, password)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	account.Role = roleAdmin
+	existing, exists := s.accounts[name]
+	if exists {
+		account.CreatedAt = existing.CreatedAt
+		account.Role = existing.Role
+	}
+	s.accounts[name] = account
+	s.forgetVerifiedLocked(name)
+	s.mu.Unlock()
+
+	// После смены пароля входы по старому не должны продолжаться через refresh-токены
+	if exists {
+		return revokeAdminSessions(name)
+	}
+	return nil
+}
+
+// SetRole назначает роль существующей учетной записи
+func (s *adminStore) SetRole(name, role string) error {
+	if !validRole(role) {
+		return fmt.Errorf("unknown role %q, expected one of: %s", role, strings.Join(roleNames(), ", "))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	account, exists := s.accounts[name]
+	if !exists {
+		return fmt.Errorf("admin %q not found", name)
+	}
+	account.Role = role
+	account.UpdatedAt = time.Now().UTC()
+	s.accounts[name] = account
+	return nil
+}
+
+// Role возвращает роль учетной записи; для неизвестного имени - anonymous
+func (s *adminStore) Role(name string) string {
+	s.reloadIfChanged()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	account, exists := s.accounts[name]
+	if !exists {
+		return roleAnonymous
+	}
+	return account.Role
+}
+
+// Exists сообщает, есть ли учетная запись
+func (s *adminStore) Exists(name string) bool {
+	s.reloadIfChanged()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, exists := s.accounts[name]
+	return exists
+}
+
+// Names возвращает имена администраторов по алфавиту
+func (s *adminStore) Names() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.accounts))
+	for name := range s.accounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Verify проверяет пароль администратора. Успешная проверка запоминается
+// на adminVerifyCacheTTL, неудачная - никогда
+func (s *adminStore) Verify(name, password string) bool {
+	s.reloadIfChanged()
+	s.mu.RLock()
+	account, exists := s.accounts[name]
+	s.mu.RUnlock()
+
+	if !exists {
+		// Хешируем впустую, чтобы время ответа не выдавало существование имени
+		pbkdf2SHA256([]byte(password), make([]byte, adminSaltSize), adminHashIterations, adminKeySize)
+		return false
+	}
+
+	now := time.Now()
+	fingerprint := account.fingerprint(password)
+	s.mu.RLock()
+	entry, cached := s.verified[fingerprint]
+	s.mu.RUnlock()
+	if cached && now.Before(entry.until) {
+		return true
+	}
+
+	if !account.matches(password) {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.verified == nil {
+		s.verified = make(map[[sha256.Size]byte]verifiedPassword)
+	}
+	for f, entry := range s.verified {
+		if !now.Before(entry.until) {
+			delete(s.verified, f)
+		}
+	}
+	s.verified[fingerprint] = verifiedPassword{name: name, until: now.Add(adminVerifyCacheTTL)}
+	return true
+}
+
+// loadAdmins загружает учетные записи. При пустом хранилище создает admin с паролем
+// из admin_password, а без него - со случайным паролем, который выводится один раз
+func loadAdmins() error {
+	path := dataPath("admins.json")
+	if _, err := admins.Load(path); err != nil {
+		return err
+	}
+	if len(admins.Names()) > 0 {
+		return nil
+	}
+
+	password, generated := cfg.AdminPassword, false
+	if password == "" {
+		password, generated = randomHex(12), true
+	}
+	if err := admins.Set(defaultAdminName, password); err != nil {
+		return fmt.Errorf("bootstrap admin from admin_password: %w", err)
+	}
+	if err := admins.Save(path); err != nil {
+		return err
+	}
+	if generated {
+		// Пароль не пишется в журнал: файлы журнала живут дольше, чем нужен пароль
+		fmt.Fprintf(os.Stderr, "\nСоздана учетная запись администратора %q с паролем: %s\n"+
+			"Пароль показывается один раз; смените его командой 'admin reset %s'\n\n",
+			defaultAdminName, password, defaultAdminName)
+		logHTTP.Warn("создана учетная запись администратора со случайным паролем; смените пароль командой 'admin reset'",
+			"name", defaultAdminName, "file", path)
+		return nil
+	}
+	logHTTP.Warn("создана учетная запись администратора из admin_password; смените пароль командой 'admin reset'",
+		"name", defaultAdminName, "file", path)
+	return nil
+}
+
+// authMemo - результат проверки прав, запомненный на время одного запроса
+type authMemo struct {
+	once sync.Once
+	name string
+	ok   bool
+}
+
+type authMemoKey struct{}
+
+// withAuthMemo добавляет в контекст запроса место для результата проверки прав.
+// Один запрос проверяет права несколько раз (middleware, обработчик), а хеширование
+// пароля медленное; следующий запрос проверяется заново, поэтому выход и отзыв
+// сессии действуют сразу
+func withAuthMemo(ctx context.Context) context.Context {
+	return context.WithValue(ctx, authMemoKey{}, &authMemo{})
+}
+
+// authenticateAdmin возвращает имя администратора, если запрос несет верные учетные данные
+func authenticateAdmin(r *http.Request) (string, bool) {
+	memo, _ := r.Context().Value(authMemoKey{}).(*authMemo)
+	if memo == nil {
+		return verifyAdminRequest(r)
+	}
+	memo.once.Do(func() {
+		memo.name, memo.ok = verifyAdminRequest(r)
+	})
+	return memo.name, memo.ok
+}
+
+// verifyAdminRequest проверяет заголовки и учитывает попытку входа
+func verifyAdminRequest(r *http.Request) (string, bool) {
+	if bearer := bearerToken(r); strings.HasPrefix(bearer, apiKeyPrefix) {
+		return verifyAPIKeyRequest(r, bearer)
+	} else if bearer != "" {
+		return verifySessionRequest(r, bearer)
+	}
+
+	adminToken := r.Header.Get("X-Admin-Token")
+	adminPassword := r.Header.Get("X-Admin-Password")
+
+	var method, name string
+	switch {
+	case adminToken != "":
+		method, name = "header_token", adminTokenName
+	case adminPassword != "":
+		method, name = "header_password", r.Header.Get("X-Admin-User")
+		if name == "" {
+			name = defaultAdminName
+		}
+	default:
+		// Учетные данные не переданы - это не попытка входа. admin_token в строке
+		// запроса не принимается: URL попадает в журналы и историю браузера
+		if r.URL.Query().Has("admin_token") {
+			logHTTP.WarnContext(r.Context(), "admin_token в URL игнорируется, используйте заголовок X-Admin-Token", "client_ip", clientIP(r))
+		}
+		return "", false
+	}
+
+	// Во время блокировки пароль и статический токен не проверяются: их можно подобрать
+	if authLockedFor(clientIP(r)) > 0 {
+		recordAuthAttempt(r, method, name, authResultLocked)
+		return "", false
+	}
+
+	var ok bool
+	if method == "header_token" {
+		// Без admin_token в конфигурации статический токен отключен
+		ok = cfg.AdminToken != "" && subtle.ConstantTimeCompare([]byte(adminToken), []byte(cfg.AdminToken)) == 1
+	} else {
+		ok = admins.Verify(name, adminPassword)
+	}
+
+	if !ok {
+		recordAuthAttempt(r, method, name, authResultFailure)
+		return "", false
+	}
+	recordAuthAttempt(r, method, name, authResultSuccess)
+	return name, true
+}
+
+// verifySessionRequest проверяет токен сессии. Неверная подпись считается попыткой
+// подбора, а истекший или отозванный токен - нет: клиент просто должен войти заново.
+// Блокировка не мешает действующей сессии: подписанный токен нельзя подобрать,
+// а подбор паролей с чужих адресов иначе отключил бы всех администраторов
+func verifySessionRequest(r *http.Request, token string) (string, bool) {
+	claims, err := parseSession(token, sessionAccess)
+	switch {
+	case errors.Is(err, errSessionInvalid):
+		recordAuthAttempt(r, "session", "", authResultFailure)
+		return "", false
+	case err != nil:
+		logHTTP.DebugContext(r.Context(), "сессия отклонена", "admin", claims.Admin, "session_id", claims.SessionID, "reason", err)
+		return "", false
+	}
+	return claims.Admin, true
+}
+
+// runAdminCommand выполняет "admin add|reset|role|list"; пароль читается из первой строки stdin
+func runAdminCommand(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("usage: admin add <name> [role] | admin reset <name> | admin role <name> <role> | admin list")
+	}
+	path := dataPath("admins.json")
+	if _, err := admins.Load(path); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		for _, name := range admins.Names() {
+			fmt.Fprintf(stdout, "%s\t%s\n", name, admins.Role(name))
+		}
+		return nil
+
+	case "role":
+		if len(args) != 3 {
+			return errors.New("usage: admin role <name> <role>")
+		}
+		if err := admins.SetRole(args[1], args[2]); err != nil {
+			return err
+		}
+		if err := admins.Save(path); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Администратору %s назначена роль %s; работающий сервер применит ее без перезапуска\n", args[1], args[2])
+		return nil
+
+	case "add", "reset":
+		role := ""
+		switch {
+		case args[0] == "add" && len(args) == 3:
+			role = args[2]
+			if !validRole(role) {
+				return fmt.Errorf("unknown role %q, expected one of: %s", role, strings.Join(roleNames(), ", "))
+			}
+		case args[0] == "add" && len(args) != 2:
+			return errors.New("usage: admin add <name> [role]")
+		case len(args) != 2:
+			return errors.New("usage: admin reset <name>")
+		}
+		name := args[1]
+		exists := admins.Exists(name)
+		if args[0] == "add" && exists {
+			return fmt.Errorf("admin %q already exists, use 'admin reset %s'", name, name)
+		}
+		if args[0] == "reset" && !exists {
+			return fmt.Errorf("admin %q not found", name)
+		}
+
+		if file, ok := stdin.(*os.File); ok {
+			if info, err := file.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+				fmt.Fprintf(stdout, "Пароль для %s: ", name)
+			}
+		}
+		password, err := bufio.NewReader(stdin).ReadString('\n')
+		if err != nil && !(errors.Is(err, io.EOF) && password != "") {
+			return fmt.Errorf("read password: %w", err)
+		}
+		password = strings.TrimRight(password, "\r\n")
+
+		// Set отзывает сессии сбрасываемой учетной записи: состояние сессий нужно загрузить,
+		// чтобы не затереть уже отозванные
+		if exists {
+			if err := loadSessions(); err != nil {
+				return err
+			}
+		}
+		if err := admins.Set(name, password); err != nil {
+			return err
+		}
+		if role != "" {
+			if err := admins.SetRole(name, role); err != nil {
+				return err
+			}
+		}
+		if err := admins.Save(path); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Администратор %s сохранен в %s; работающий сервер применит изменения без перезапуска\n", name, path)
+		return nil
+
+	default:
+		return fmt.Errorf("unknown admin command %q", args[0])
+	}
+}
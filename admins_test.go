@@ -0,0 +1,370 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// authenticateThroughMiddleware проверяет права так же, как маршруты: через withRequestID
+func authenticateThroughMiddleware(r *http.Request) (name string, ok bool) {
+	withRequestID(func(w http.ResponseWriter, r *http.Request) {
+		name, ok = authenticateAdmin(r)
+		// Повторная проверка в том же запросе берет запомненный результат
+		if again, againOK := authenticateAdmin(r); again != name || againOK != ok {
+			ok = false
+		}
+	})(httptest.NewRecorder(), r)
+	return name, ok
+}
+
+func TestSessionRevocationTakesEffectImmediately(t *testing.T) {
+	tests := []struct {
+		name   string
+		revoke func(tokens sessionTokens) error
+	}{
+		{"logout", func(tokens sessionTokens) error {
+			return revokeSession(tokens.SessionID, time.Now().Add(time.Hour))
+		}},
+		{"revoke all sessions of admin", func(tokens sessionTokens) error {
+			time.Sleep(2 * time.Millisecond) // RevokedBefore сравнивается с IssuedAt в миллисекундах
+			return revokeAdminSessions(tokens.Admin)
+		}},
+		{"admin removed", func(tokens sessionTokens) error {
+			removeTestAdmin(tokens.Admin)
+			return nil
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestConfig(t)
+			useTestSessions(t)
+			resetAuthAttempts(t)
+			addTestAdmin(t, "alice", roleAdmin)
+
+			tokens := issueSession("alice")
+			request := func() *http.Request {
+				r := httptest.NewRequest(http.MethodGet, "/api/v1/clients", nil)
+				r.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+				r.Header.Set("X-Request-ID", "replayed-request-id")
+				return r
+			}
+
+			if name, ok := authenticateThroughMiddleware(request()); !ok || name != "alice" {
+				t.Fatalf("before revocation: got %q, %v", name, ok)
+			}
+			if err := tt.revoke(tokens); err != nil {
+				t.Fatal(err)
+			}
+			if name, ok := authenticateThroughMiddleware(request()); ok {
+				t.Fatalf("after revocation the same X-Request-ID still authenticates as %q", name)
+			}
+		})
+	}
+}
+
+func TestVerifyAdminRequestStaticToken(t *testing.T) {
+	const token = "0123456789abcdef-static"
+	tests := []struct {
+		name       string
+		configured string
+		header     string
+		query      string
+		want       bool
+	}{
+		{"header matches", token, token, "", true},
+		{"header mismatch", token, "wrong-token-value", "", false},
+		{"query string is ignored", token, "", token, false},
+		{"disabled without configured token", "", "", "", false},
+		{"empty configured token never matches", "", token, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestConfig(t)
+			resetAuthAttempts(t)
+			cfg.AdminToken = tt.configured
+
+			target := "/api/v1/clients"
+			if tt.query != "" {
+				target += "?admin_token=" + tt.query
+			}
+			r := httptest.NewRequest(http.MethodGet, target, nil)
+			if tt.header != "" {
+				r.Header.Set("X-Admin-Token", tt.header)
+			}
+			if _, ok := verifyAdminRequest(r); ok != tt.want {
+				t.Errorf("verifyAdminRequest = %v, want %v", ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultConfigHasNoAdminSecrets(t *testing.T) {
+	defaults := defaultConfig()
+	if defaults.AdminPassword != "" || defaults.AdminToken != "" {
+		t.Fatalf("default config ships admin secrets: password %q, token %q", defaults.AdminPassword, defaults.AdminToken)
+	}
+}
+
+func TestPBKDF2SHA256(t *testing.T) {
+	// RFC 7914, раздел 11
+	tests := []struct {
+		password, salt string
+		iterations     int
+		want           string
+	}{
+		{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc" +
+			"49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56" +
+			"a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+	}
+	for _, tt := range tests {
+		for _, keyLen := range []int{64, adminKeySize, 20} {
+			got := hex.EncodeToString(pbkdf2SHA256([]byte(tt.password), []byte(tt.salt), tt.iterations, keyLen))
+			if want := tt.want[:2*keyLen]; got != want {
+				t.Errorf("pbkdf2SHA256(%q, %q, %d, %d) = %s, want %s", tt.password, tt.salt, tt.iterations, keyLen, got, want)
+			}
+		}
+	}
+}
+
+func TestAdminStoreVerify(t *testing.T) {
+	store := &adminStore{accounts: make(map[string]AdminAccount)}
+	if err := store.Set("alice", "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	account := store.accounts["alice"]
+	if account.Role != roleAdmin || account.Iterations != adminHashIterations {
+		t.Fatalf("new account = %+v", account)
+	}
+
+	malformed := func(change func(a *AdminAccount)) AdminAccount {
+		a := account
+		change(&a)
+		return a
+	}
+	store.accounts["bad-salt"] = malformed(func(a *AdminAccount) { a.Name = "bad-salt"; a.Salt = "not base64!" })
+	store.accounts["bad-hash"] = malformed(func(a *AdminAccount) { a.Name = "bad-hash"; a.Hash = "not base64!" })
+	store.accounts["no-iterations"] = malformed(func(a *AdminAccount) { a.Name = "no-iterations"; a.Iterations = 0 })
+	store.accounts["short-hash"] = malformed(func(a *AdminAccount) {
+		a.Name = "short-hash"
+		hash, _ := base64.StdEncoding.DecodeString(a.Hash)
+		a.Hash = base64.StdEncoding.EncodeToString(hash[:8])
+	})
+	store.accounts["empty-hash"] = malformed(func(a *AdminAccount) { a.Name = "empty-hash"; a.Hash = "" })
+	store.accounts["empty-salt"] = malformed(func(a *AdminAccount) { a.Name = "empty-salt"; a.Salt = "" })
+
+	tests := []struct {
+		name, password string
+		want           bool
+	}{
+		{"alice", "correct horse", true},
+		{"alice", "correct horse", true}, // из кеша
+		{"alice", "wrong horse", false},
+		{"alice", "", false},
+		{"alice", "correct horse ", false},
+		{"bob", "correct horse", false},
+		{"bad-salt", "correct horse", false},
+		{"bad-hash", "correct horse", false},
+		{"no-iterations", "correct horse", false},
+		{"short-hash", "correct horse", false},
+		{"empty-hash", "correct horse", false},
+		{"empty-hash", "", false},
+		{"empty-salt", "correct horse", false},
+	}
+	for _, tt := range tests {
+		if got := store.Verify(tt.name, tt.password); got != tt.want {
+			t.Errorf("Verify(%q, %q) = %v, want %v", tt.name, tt.password, got, tt.want)
+		}
+	}
+	if len(store.verified) != 1 {
+		t.Errorf("%d cached verifications, want only the successful one", len(store.verified))
+	}
+
+	// Смена пароля делает запомненную проверку недействительной
+	if err := store.Set("alice", "battery staple"); err != nil {
+		t.Fatal(err)
+	}
+	if store.Verify("alice", "correct horse") {
+		t.Error("old password accepted from cache after reset")
+	}
+	if !store.Verify("alice", "battery staple") {
+		t.Error("new password rejected")
+	}
+	if created := store.accounts["alice"].CreatedAt; !created.Equal(account.CreatedAt) {
+		t.Errorf("reset changed created_at: %v -> %v", account.CreatedAt, created)
+	}
+
+	// Кеш не переживает удаление учетной записи
+	store.mu.Lock()
+	delete(store.accounts, "alice")
+	store.mu.Unlock()
+	if store.Verify("alice", "battery staple") {
+		t.Error("removed admin accepted from cache")
+	}
+}
+
+func TestAdminStoreReloadsCommandChanges(t *testing.T) {
+	useTestConfig(t)
+	useTestSessions(t)
+	captureLogs(t)
+	saved := admins
+	t.Cleanup(func() { admins = saved })
+	path := dataPath("admins.json")
+
+	// runAdminCommand работает с глобальным хранилищем, как отдельный процесс CLI
+	runCLI := func(args []string, stdin string) {
+		t.Helper()
+		admins = &adminStore{accounts: make(map[string]AdminAccount)}
+		if err := runAdminCommand(args, strings.NewReader(stdin), new(strings.Builder)); err != nil {
+			t.Fatal(err)
+		}
+		// Гарантируем новое время изменения при грубой точности файловой системы
+		later := time.Now().Add(time.Second)
+		if err := os.Chtimes(path, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runCLI([]string{"add", "alice", roleEditor}, "correct horse\n")
+
+	server := &adminStore{accounts: make(map[string]AdminAccount)}
+	if _, err := server.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if !server.Verify("alice", "correct horse") || server.Role("alice") != roleEditor {
+		t.Fatal("server did not load the account")
+	}
+	if len(server.verified) != 1 {
+		t.Fatalf("%d cached verifications, want 1", len(server.verified))
+	}
+
+	runCLI([]string{"reset", "alice"}, "battery staple\n")
+	if server.Verify("alice", "correct horse") {
+		t.Error("old password accepted after admin reset")
+	}
+	if len(server.verified) != 0 {
+		t.Errorf("%d cached verifications survived the reset", len(server.verified))
+	}
+	if !server.Verify("alice", "battery staple") {
+		t.Error("new password rejected after admin reset")
+	}
+
+	runCLI([]string{"role", "alice", roleViewer}, "")
+	if got := server.Role("alice"); got != roleViewer {
+		t.Errorf("role after admin role = %q, want %q", got, roleViewer)
+	}
+	if !server.Verify("alice", "battery staple") {
+		t.Error("role change dropped the password")
+	}
+
+	// Запись самим сервером не вызывает перечитывания, испорченный файл не сбрасывает записи
+	if err := server.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("{broken"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(2 * time.Second)
+	os.Chtimes(path, later, later)
+	if !server.Verify("alice", "battery staple") || server.Role("alice") != roleViewer {
+		t.Error("broken admins.json replaced the loaded accounts")
+	}
+}
+
+func TestAdminResetRevokesSessions(t *testing.T) {
+	tests := []struct {
+		name  string
+		reset func(t *testing.T, server *adminStore)
+	}{
+		{"reset in the server process", func(t *testing.T, server *adminStore) {
+			if err := server.Set("alice", "battery staple"); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"admin reset from the CLI", func(t *testing.T, server *adminStore) {
+			// CLI подписывает сессии тем же ключом, что и сервер
+			cfg.SessionSecret = string(sessionKey)
+			admins = &adminStore{accounts: make(map[string]AdminAccount)}
+			if err := runAdminCommand([]string{"reset", "alice"}, strings.NewReader("battery staple\n"), new(strings.Builder)); err != nil {
+				t.Fatal(err)
+			}
+			admins = server
+			// Отзыв, записанный CLI, сервер не видит: сессии он отзывает сам, перечитав admins.json
+			sessionsMu.Lock()
+			sessions.RevokedBefore = map[string]time.Time{}
+			sessionsMu.Unlock()
+			later := time.Now().Add(time.Second)
+			if err := os.Chtimes(dataPath("admins.json"), later, later); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestConfig(t)
+			useTestSessions(t)
+			resetAuthAttempts(t)
+			captureLogs(t)
+			saved := admins
+			t.Cleanup(func() { admins = saved })
+			path := dataPath("admins.json")
+
+			server := &adminStore{accounts: make(map[string]AdminAccount)}
+			if err := server.Set("alice", "correct horse"); err != nil {
+				t.Fatal(err)
+			}
+			if err := server.Save(path); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := server.Load(path); err != nil {
+				t.Fatal(err)
+			}
+			admins = server
+
+			other := issueSession("alice")
+			old := issueSession("alice")
+			if rec := postRefresh(other.RefreshToken); rec.Code != http.StatusOK {
+				t.Fatalf("refresh before reset: status %d", rec.Code)
+			}
+
+			tt.reset(t, server)
+			if rec := postRefresh(old.RefreshToken); rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), errSessionRevoked.Error()) {
+				t.Errorf("old refresh token after reset: status %d %s", rec.Code, rec.Body)
+			}
+			if _, err := parseSession(old.AccessToken, sessionAccess); err != errSessionRevoked {
+				t.Errorf("old access token after reset: %v, want %v", err, errSessionRevoked)
+			}
+
+			// Вход с новым паролем выдает рабочую сессию
+			time.Sleep(2 * time.Millisecond)
+			if rec := postRefresh(issueSession("alice").RefreshToken); rec.Code != http.StatusOK {
+				t.Errorf("refresh of a new session: status %d %s", rec.Code, rec.Body)
+			}
+		})
+	}
+}
+
+func TestAdminStoreSetValidation(t *testing.T) {
+	store := &adminStore{accounts: make(map[string]AdminAccount)}
+	tests := []struct {
+		name, password string
+	}{
+		{"alice", "short"},
+		{"", "long enough"},
+		{"has space", "long enough"},
+		{adminTokenName, "long enough"},
+	}
+	for _, tt := range tests {
+		if err := store.Set(tt.name, tt.password); err == nil {
+			t.Errorf("Set(%q, %q): expected error", tt.name, tt.password)
+		}
+	}
+	if len(store.accounts) != 0 {
+		t.Errorf("invalid accounts were stored: %v", store.Names())
+	}
+}
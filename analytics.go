@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Максимальная длина запрашиваемого периода аналитики
+const maxAnalyticsRange = 5 * 366 * 24 * time.Hour
+
+// ForEach вызывает fn для каждого пользователя под блокировкой чтения, без копирования карты
+func (db *InMemoryDB) ForEach(fn func(User)) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	for _, user := range db.users {
+		fn(user)
+	}
+}
+
+// periodStart возвращает начало периода (day, week, month), содержащего t
+func periodStart(t time.Time, interval string) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch interval {
+	case "week":
+		// Недели начинаются с понедельника
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return day
+	}
+}
+
+// nextPeriod возвращает начало следующего периода
+func nextPeriod(start time.Time, interval string) time.Time {
+	switch interval {
+	case "week":
+		return start.AddDate(0, 0, 7)
+	case "month":
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// periodLabel форматирует период для ответа
+func periodLabel(start time.Time, interval string) string {
+	switch interval {
+	case "week":
+		year, week := start.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case "month":
+		return start.Format("2006-01")
+	default:
+		return start.Format("2006-01-02")
+	}
+}
+
+// emailDomain возвращает домен email в нижнем регистре
+func emailDomain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(email[at+1:])
+}
+
+// parseAnalyticsDate разбирает дату в формате YYYY-MM-DD или RFC3339
+func parseAnalyticsDate(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// Аналитика пользователей: регистрации по периодам, домены, рост и когорты
+func apiUserStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	query := r.URL.Query()
+
+	interval := query.Get("interval")
+	if interval == "" {
+		interval = "day"
+	}
+	if interval != "day" && interval != "week" && interval != "month" {
+		sendError(w, http.StatusBadRequest, "Interval must be 'day', 'week' or 'month'")
+		return
+	}
+
+	now := time.Now().UTC()
+	to := now
+	from := now.AddDate(0, 0, -30)
+	if value := query.Get("from"); value != "" {
+		t, err := parseAnalyticsDate(value)
+		if err != nil {
+			sendError(w, http.StatusBadRequest, "Invalid 'from' date")
+			return
+		}
+		from = t.UTC()
+	}
+	if value := query.Get("to"); value != "" {
+		t, err := parseAnalyticsDate(value)
+		if err != nil {
+			sendError(w, http.StatusBadRequest, "Invalid 'to' date")
+			return
+		}
+		to = t.UTC()
+		// Дата без времени включает весь день
+		if len(value) == len("2006-01-02") {
+			to = to.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		}
+	}
+	if to.Before(from) {
+		sendError(w, http.StatusBadRequest, "'to' must not be before 'from'")
+		return
+	}
+	if to.Sub(from) > maxAnalyticsRange {
+		sendError(w, http.StatusBadRequest, "Date range is too large")
+		return
+	}
+
+	top := 5
+	if value := query.Get("top"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 100 {
+			sendError(w, http.StatusBadRequest, "Top must be between 1 and 100")
+			return
+		}
+		top = n
+	}
+
+	// Один проход по базе под блокировкой чтения
+	total := 0
+	before := 0
+	inRange := 0
+	signups := make(map[time.Time]int)
+	cohorts := make(map[time.Time]int)
+	domains := make(map[string]int)
+
+	db.ForEach(func(user User) {
+		total++
+		created := user.CreatedAt.UTC()
+		if created.Before(from) {
+			before++
+			return
+		}
+		if created.After(to) {
+			return
+		}
+		inRange++
+		signups[periodStart(created, interval)]++
+		cohorts[periodStart(created, "month")]++
+		if domain := emailDomain(user.Email); domain != "" {
+			domains[domain]++
+		}
+	})
+
+	// Ряд регистраций, включая пустые периоды
+	series := make([]map[string]interface{}, 0)
+	cumulative := before
+	for start := periodStart(from, interval); !start.After(to); start = nextPeriod(start, interval) {
+		count := signups[start]
+		cumulative += count
+		series = append(series, map[string]interface{}{
+			"period":     periodLabel(start, interval),
+			"start":      start.Format("2006-01-02"),
+			"signups":    count,
+			"cumulative": cumulative,
+		})
+	}
+
+	type domainCount struct {
+		Domain string `json:"domain"`
+		Users  int    `json:"users"`
+	}
+	topDomains := make([]domainCount, 0, len(domains))
+	for domain, count := range domains {
+		topDomains = append(topDomains, domainCount{Domain: domain, Users: count})
+	}
+	sort.Slice(topDomains, func(i, j int) bool {
+		if topDomains[i].Users != topDomains[j].Users {
+			return topDomains[i].Users > topDomains[j].Users
+		}
+		return topDomains[i].Domain < topDomains[j].Domain
+	})
+	if len(topDomains) > top {
+		topDomains = topDomains[:top]
+	}
+
+	cohortStarts := make([]time.Time, 0, len(cohorts))
+	for start := range cohorts {
+		cohortStarts = append(cohortStarts, start)
+	}
+	sort.Slice(cohortStarts, func(i, j int) bool { return cohortStarts[i].Before(cohortStarts[j]) })
+	cohortList := make([]map[string]interface{}, 0, len(cohortStarts))
+	for _, start := range cohortStarts {
+		cohortList = append(cohortList, map[string]interface{}{
+			"cohort":        periodLabel(start, "month"),
+			"users":         cohorts[start],
+			"share_percent": float64(cohorts[start]) * 100 / float64(inRange),
+		})
+	}
+
+	// Рост относительно числа пользователей на начало периода
+	var growthRate interface{}
+	if before > 0 {
+		growthRate = float64(inRange) * 100 / float64(before)
+	}
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"from":                from.Format(time.RFC3339),
+		"to":                  to.Format(time.RFC3339),
+		"interval":            interval,
+		"total_users":         total,
+		"users_before_range":  before,
+		"signups_in_range":    inRange,
+		"growth_rate_percent": growthRate,
+		"signups":             series,
+		"top_domains":         topDomains,
+		"cohorts":             cohortList,
+	})
+}
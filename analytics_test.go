@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPeriodBoundaries(t *testing.T) {
+	tests := []struct {
+		name     string
+		t        time.Time
+		interval string
+		start    string
+		next     string
+		label    string
+	}{
+		{"day", time.Date(2025, 12, 31, 23, 59, 0, 0, time.UTC), "day", "2025-12-31", "2026-01-01", "2025-12-31"},
+		{"day in another zone", time.Date(2026, 1, 1, 1, 0, 0, 0, time.FixedZone("UTC+3", 3*3600)), "day", "2025-12-31", "2026-01-01", "2025-12-31"},
+		{"week of 1 January belongs to the new ISO year", time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC), "week", "2025-12-29", "2026-01-05", "2026-W01"},
+		{"December days in week 1 of the next ISO year", time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC), "week", "2024-12-30", "2025-01-06", "2025-W01"},
+		{"January days in week 53 of the previous ISO year", time.Date(2027, 1, 2, 0, 0, 0, 0, time.UTC), "week", "2026-12-28", "2027-01-04", "2026-W53"},
+		{"week starts on Monday", time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC), "week", "2026-03-02", "2026-03-09", "2026-W10"},
+		{"month across the year", time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC), "month", "2025-12-01", "2026-01-01", "2025-12"},
+		{"month of 31 January", time.Date(2026, 1, 31, 0, 0, 0, 0, time.UTC), "month", "2026-01-01", "2026-02-01", "2026-01"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := periodStart(tt.t, tt.interval)
+			if got := start.Format("2006-01-02"); got != tt.start {
+				t.Errorf("periodStart = %s, want %s", got, tt.start)
+			}
+			if got := nextPeriod(start, tt.interval).Format("2006-01-02"); got != tt.next {
+				t.Errorf("nextPeriod = %s, want %s", got, tt.next)
+			}
+			if got := periodLabel(start, tt.interval); got != tt.label {
+				t.Errorf("periodLabel = %s, want %s", got, tt.label)
+			}
+		})
+	}
+}
+
+// userStatsResponse - поля ответа /api/v1/stats/users, проверяемые тестами
+type userStatsResponse struct {
+	TotalUsers     int      `json:"total_users"`
+	UsersBefore    int      `json:"users_before_range"`
+	SignupsInRange int      `json:"signups_in_range"`
+	GrowthRate     *float64 `json:"growth_rate_percent"`
+	Signups        []struct {
+		Period     string `json:"period"`
+		Signups    int    `json:"signups"`
+		Cumulative int    `json:"cumulative"`
+	} `json:"signups"`
+	TopDomains []struct {
+		Domain string `json:"domain"`
+		Users  int    `json:"users"`
+	} `json:"top_domains"`
+	Cohorts []struct {
+		Cohort string  `json:"cohort"`
+		Users  int     `json:"users"`
+		Share  float64 `json:"share_percent"`
+	} `json:"cohorts"`
+}
+
+func getUserStats(t *testing.T, query string) (int, userStatsResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	apiUserStatsHandler(rec, httptest.NewRequest(http.MethodGet, "/api/v1/stats/users?"+query, nil))
+	var response userStatsResponse
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rec.Code, response
+}
+
+func TestUserStatsValidation(t *testing.T) {
+	useTestDB(t, User{ID: 1, Name: "Алексей", Email: "alex@example.com", CreatedAt: time.Now()})
+
+	tests := []struct {
+		query  string
+		status int
+	}{
+		{"", http.StatusOK},
+		{"interval=year", http.StatusBadRequest},
+		{"from=yesterday", http.StatusBadRequest},
+		{"to=2026-13-01", http.StatusBadRequest},
+		{"from=2026-02-01&to=2026-01-31", http.StatusBadRequest},
+		{"from=2026-01-31&to=2026-01-31", http.StatusOK},
+		{"from=2026-01-31T12:00:00Z&to=2026-01-31T11:00:00Z", http.StatusBadRequest},
+		{"from=2020-01-01&to=2024-12-31", http.StatusOK},
+		{"from=2000-01-01&to=2026-01-01", http.StatusBadRequest},
+		{"top=0", http.StatusBadRequest},
+		{"top=1", http.StatusOK},
+		{"top=100", http.StatusOK},
+		{"top=101", http.StatusBadRequest},
+		{"top=many", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if status, _ := getUserStats(t, tt.query); status != tt.status {
+			t.Errorf("%q: status %d, want %d", tt.query, status, tt.status)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	apiUserStatsHandler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/stats/users", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestUserStatsSeries(t *testing.T) {
+	at := func(year int, month time.Month, day, hour int) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, time.UTC)
+	}
+	users := []User{
+		{ID: 1, Email: "old@example.com", CreatedAt: at(2025, 11, 15, 10)},
+		{ID: 2, Email: "a@example.com", CreatedAt: at(2025, 12, 30, 9)},
+		{ID: 3, Email: "b@Example.com", CreatedAt: at(2025, 12, 31, 23)},
+		{ID: 4, Email: "c@company.ru", CreatedAt: at(2026, 1, 1, 0)},
+		{ID: 5, Email: "d@mail.org", CreatedAt: at(2026, 1, 2, 23)},
+		{ID: 6, Email: "late@example.com", CreatedAt: at(2026, 1, 3, 0)},
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		periods []string
+		signups []int
+		before  int
+		growth  *float64
+		cohorts map[string]int
+		domains []string
+	}{
+		{
+			name:    "days with inclusive date-only to",
+			query:   "interval=day&from=2025-12-30&to=2026-01-02",
+			periods: []string{"2025-12-30", "2025-12-31", "2026-01-01", "2026-01-02"},
+			signups: []int{1, 1, 1, 1},
+			before:  1,
+			growth:  ptrFloat(400),
+			cohorts: map[string]int{"2025-12": 2, "2026-01": 2},
+			domains: []string{"example.com", "company.ru", "mail.org"},
+		},
+		{
+			name:    "ISO weeks across the year",
+			query:   "interval=week&from=2025-12-22&to=2026-01-04",
+			periods: []string{"2025-W52", "2026-W01"},
+			signups: []int{0, 5},
+			before:  1,
+			growth:  ptrFloat(500),
+			cohorts: map[string]int{"2025-12": 2, "2026-01": 3},
+			domains: []string{"example.com", "company.ru", "mail.org"},
+		},
+		{
+			name:    "months across the year",
+			query:   "interval=month&from=2025-11-01&to=2026-01-31",
+			periods: []string{"2025-11", "2025-12", "2026-01"},
+			signups: []int{1, 2, 3},
+			before:  0,
+			cohorts: map[string]int{"2025-11": 1, "2025-12": 2, "2026-01": 3},
+			domains: []string{"example.com", "company.ru", "mail.org"},
+		},
+		{
+			name:    "top limits domains",
+			query:   "interval=month&from=2025-11-01&to=2026-01-31&top=1",
+			periods: []string{"2025-11", "2025-12", "2026-01"},
+			signups: []int{1, 2, 3},
+			cohorts: map[string]int{"2025-11": 1, "2025-12": 2, "2026-01": 3},
+			domains: []string{"example.com"},
+		},
+		{
+			name:    "empty range",
+			query:   "interval=day&from=2026-02-01&to=2026-02-02",
+			periods: []string{"2026-02-01", "2026-02-02"},
+			signups: []int{0, 0},
+			before:  6,
+			growth:  ptrFloat(0),
+			cohorts: map[string]int{},
+			domains: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDB(t, users...)
+			status, got := getUserStats(t, tt.query)
+			if status != http.StatusOK {
+				t.Fatalf("status %d", status)
+			}
+
+			if len(got.Signups) != len(tt.periods) {
+				t.Fatalf("%d periods, want %d: %+v", len(got.Signups), len(tt.periods), got.Signups)
+			}
+			cumulative := tt.before
+			for i, period := range got.Signups {
+				cumulative += tt.signups[i]
+				if period.Period != tt.periods[i] || period.Signups != tt.signups[i] || period.Cumulative != cumulative {
+					t.Errorf("period #%d = %+v, want %s with %d signups, %d cumulative", i, period, tt.periods[i], tt.signups[i], cumulative)
+				}
+			}
+
+			if got.UsersBefore != tt.before || got.TotalUsers != len(users) {
+				t.Errorf("before/total = %d/%d, want %d/%d", got.UsersBefore, got.TotalUsers, tt.before, len(users))
+			}
+			switch {
+			case tt.growth == nil && got.GrowthRate != nil:
+				t.Errorf("growth rate = %v with no users before the range, want null", *got.GrowthRate)
+			case tt.growth != nil && (got.GrowthRate == nil || *got.GrowthRate != *tt.growth):
+				t.Errorf("growth rate = %v, want %v", got.GrowthRate, *tt.growth)
+			}
+
+			if len(got.Cohorts) != len(tt.cohorts) {
+				t.Errorf("cohorts = %+v, want %v", got.Cohorts, tt.cohorts)
+			}
+			for _, cohort := range got.Cohorts {
+				if cohort.Users != tt.cohorts[cohort.Cohort] {
+					t.Errorf("cohort %s has %d users, want %d", cohort.Cohort, cohort.Users, tt.cohorts[cohort.Cohort])
+				}
+				if want := float64(cohort.Users) * 100 / float64(got.SignupsInRange); cohort.Share != want {
+					t.Errorf("cohort %s share = %v, want %v", cohort.Cohort, cohort.Share, want)
+				}
+			}
+
+			if len(got.TopDomains) != len(tt.domains) {
+				t.Fatalf("top domains = %+v, want %v", got.TopDomains, tt.domains)
+			}
+			for i, domain := range got.TopDomains {
+				if domain.Domain != tt.domains[i] {
+					t.Errorf("top domain #%d = %s, want %s", i, domain.Domain, tt.domains[i])
+				}
+			}
+		})
+	}
+}
+
+func ptrFloat(v float64) *float64 { return &v }
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Ключ выглядит как umk_<id>_<secret>; id позволяет найти запись без перебора хешей
+	apiKeyPrefix = "umk_"
+
+	// Имя, под которым ключ действует в журналах и changed_by: apikey:<id>
+	apiKeyPrincipalPrefix = "apikey:"
+
+	// Время последнего использования сохраняется на диск не чаще раза в минуту
+	apiKeyTouchInterval = time.Minute
+)
+
+var (
+	errAPIKeyNotFound = errors.New("API key not found")
+	errAPIKeyInvalid  = errors.New("invalid API key")
+	errAPIKeyInactive = errors.New("API key expired or revoked")
+)
+
+// apiKeyScopes - разрешения, которые можно выдать ключу
+var apiKeyScopes = []string{permUsersRead, permUsersWrite, permModeWrite}
+
+// APIKey - ключ для скриптов; хранится только SHA-256 от ключа
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	Hash       string     `json:"hash,omitempty"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// active сообщает, действует ли ключ в момент now
+func (k APIKey) active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// hasScope сообщает, выдано ли ключу разрешение
+func (k APIKey) hasScope(permission string) bool {
+	for _, scope := range k.Scopes {
+		if scope == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// apiKeyStore - ключи, сохраняемые в data_dir/api_keys.json
+type apiKeyStore struct {
+	mu    sync.RWMutex
+	keys  map[string]*APIKey
+	saved map[string]time.Time // когда last_used_at ключа последний раз сохранялся
+}
+
+var apiKeys = &apiKeyStore{keys: make(map[string]*APIKey), saved: make(map[string]time.Time)}
+
+// Load читает ключи из файла
+func (s *apiKeyStore) Load(path string) error {
+	var keys []APIKey
+	found, err := loadJSONFile(path, &keys)
+	if err != nil || !found {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = make(map[string]*APIKey, len(keys))
+	for i := range keys {
+		s.keys[keys[i].ID] = &keys[i]
+	}
+	return nil
+}
+
+// saveLocked записывает ключи в файл; s.mu должен быть захвачен
+func (s *apiKeyStore) saveLocked() error {
+	keys := make([]APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, *key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return saveJSONFile(dataPath("api_keys.json"), keys)
+}
+
+// Create выпускает ключ и возвращает его единственный раз вместе с записью
+func (s *apiKeyStore) Create(name string, scopes []string, expiresAt *time.Time, createdBy string) (string, APIKey, error) {
+	id := randomHex(6)
+	secret := apiKeyPrefix + id + "_" + randomHex(24)
+	digest := sha256.Sum256([]byte(secret))
+
+	key := &APIKey{
+		ID:        id,
+		Name:      name,
+		Scopes:    scopes,
+		Hash:      hex.EncodeToString(digest[:]),
+		CreatedBy: createdBy,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: expiresAt,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[id] = key
+	if err := s.saveLocked(); err != nil {
+		delete(s.keys, id)
+		return "", APIKey{}, err
+	}
+	return secret, key.public(), nil
+}
+
+// Revoke отзывает ключ; запись остается для аудита
+func (s *apiKeyStore) Revoke(id string) (APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, exists := s.keys[id]
+	if !exists {
+		return APIKey{}, errAPIKeyNotFound
+	}
+	if key.RevokedAt == nil {
+		now := time.Now().UTC()
+		key.RevokedAt = &now
+		if err := s.saveLocked(); err != nil {
+			return APIKey{}, err
+		}
+	}
+	return key.public(), nil
+}
+
+// List возвращает ключи без хешей, новые первыми
+func (s *apiKeyStore) List() []APIKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key.public())
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+	return keys
+}
+
+// Get возвращает ключ по идентификатору
+func (s *apiKeyStore) Get(id string) (APIKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, exists := s.keys[id]
+	if !exists {
+		return APIKey{}, false
+	}
+	return *key, true
+}
+
+// Verify проверяет ключ целиком и отмечает использование
+func (s *apiKeyStore) Verify(secret, ip string) (APIKey, error) {
+	id, _, found := strings.Cut(strings.TrimPrefix(secret, apiKeyPrefix), "_")
+	digest := sha256.Sum256([]byte(secret))
+	actual := hex.EncodeToString(digest[:])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, exists := s.keys[id]
+	if !found || !exists || subtle.ConstantTimeCompare([]byte(actual), []byte(key.Hash)) != 1 {
+		return APIKey{}, errAPIKeyInvalid
+	}
+
+	now := time.Now().UTC()
+	if !key.active(now) {
+		return key.public(), errAPIKeyInactive
+	}
+
+	key.LastUsedAt = &now
+	key.LastUsedIP = ip
+	if now.Sub(s.saved[id]) >= apiKeyTouchInterval {
+		s.saved[id] = now
+		if err := s.saveLocked(); err != nil {
+			logHTTP.Error("ошибка сохранения API-ключей", "error", err)
+		}
+	}
+	return key.public(), nil
+}
+
+// public возвращает копию записи без хеша
+func (k *APIKey) public() APIKey {
+	key := *k
+	key.Hash = ""
+	key.Scopes = append([]string(nil), k.Scopes...)
+	return key
+}
+
+// loadAPIKeys загружает ключи при старте
+func loadAPIKeys() error {
+	return apiKeys.Load(dataPath("api_keys.json"))
+}
+
+// apiKeyPrincipal возвращает идентификатор ключа из имени apikey:<id>
+func apiKeyPrincipal(name string) (string, bool) {
+	return strings.CutPrefix(name, apiKeyPrincipalPrefix)
+}
+
+// apiKeyAllows сообщает, выдано ли ключу разрешение; отозванный ключ не дает ничего.
+// local:access есть у любого действующего ключа: scopes ограничивают его и в локальном режиме
+func apiKeyAllows(name, permission string) bool {
+	id, ok := apiKeyPrincipal(name)
+	if !ok {
+		return false
+	}
+	key, exists := apiKeys.Get(id)
+	return exists && key.active(time.Now()) && (permission == permLocalAccess || key.hasScope(permission))
+}
+
+// verifyAPIKeyRequest проверяет ключ из Authorization: Bearer. Неизвестный ключ считается
+// попыткой подбора, истекший или отозванный - нет: скрипт просто использует старый ключ.
+// Как и сессии, действующий ключ принимается и во время блокировки
+func verifyAPIKeyRequest(r *http.Request, secret string) (string, bool) {
+	key, err := apiKeys.Verify(secret, clientIP(r))
+	switch {
+	case err == errAPIKeyInvalid:
+		recordAuthAttempt(r, "api_key", "", authResultFailure)
+		return "", false
+	case err != nil:
+		logHTTP.InfoContext(r.Context(), "отклонен неактивный API-ключ", "key_id", key.ID, "name", key.Name)
+		return "", false
+	}
+	return apiKeyPrincipalPrefix + key.ID, true
+}
+
+// apiKeyRequest - тело запроса выпуска ключа
+type apiKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresIn string     `json:"expires_in,omitempty"` // длительность ("720h"); вместо expires_at
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// apiKeyCreated - ответ на выпуск ключа; key больше нигде не показывается
+type apiKeyCreated struct {
+	Key    string `json:"key"`
+	APIKey APIKey `json:"api_key"`
+}
+
+// GET /api/v1/admin/api-keys
+func listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys := apiKeys.List()
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"api_keys": keys,
+		"total":    len(keys),
+		"scopes":   apiKeyScopes,
+	})
+}
+
+// POST /api/v1/admin/api-keys
+func createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var body apiKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		sendError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" {
+		sendError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	if len(body.Scopes) == 0 {
+		sendError(w, http.StatusBadRequest, "At least one scope is required")
+		return
+	}
+	scopes := make([]string, 0, len(body.Scopes))
+	for _, scope := range body.Scopes {
+		allowed := false
+		for _, candidate := range apiKeyScopes {
+			allowed = allowed || scope == candidate
+		}
+		if !allowed {
+			sendError(w, http.StatusBadRequest, "Unknown scope: "+scope+", expected one of: "+strings.Join(apiKeyScopes, ", "))
+			return
+		}
+		scopes = append(scopes, scope)
+	}
+
+	expiresAt := body.ExpiresAt
+	if body.ExpiresIn != "" {
+		ttl, err := time.ParseDuration(body.ExpiresIn)
+		if err != nil || ttl <= 0 {
+			sendError(w, http.StatusBadRequest, "expires_in must be a positive duration like '720h'")
+			return
+		}
+		at := time.Now().Add(ttl).UTC()
+		expiresAt = &at
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		sendError(w, http.StatusBadRequest, "expires_at must be in the future")
+		return
+	}
+
+	adminName, _ := requestRole(r)
+	secret, key, err := apiKeys.Create(body.Name, scopes, expiresAt, adminName)
+	if err != nil {
+		sendError(w, http.StatusInternalServerError, "Failed to save API key")
+		return
+	}
+
+	logHTTP.InfoContext(r.Context(), "выпущен API-ключ",
+		"key_id", key.ID, "name", key.Name, "scopes", key.Scopes, "admin", adminName)
+	sendJSON(w, http.StatusCreated, apiKeyCreated{Key: secret, APIKey: key})
+}
+
+// DELETE /api/v1/admin/api-keys/{id}
+func revokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	key, err := apiKeys.Revoke(r.PathValue("id"))
+	switch {
+	case err == errAPIKeyNotFound:
+		sendError(w, http.StatusNotFound, "API key not found")
+		return
+	case err != nil:
+		sendError(w, http.StatusInternalServerError, "Failed to save API key")
+		return
+	}
+
+	adminName, _ := requestRole(r)
+	logHTTP.InfoContext(r.Context(), "API-ключ отозван", "key_id", key.ID, "name", key.Name, "admin", adminName)
+	sendJSON(w, http.StatusOK, key)
+}
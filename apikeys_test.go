@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIKeyHasScope(t *testing.T) {
+	key := APIKey{Scopes: []string{permUsersRead, permModeWrite}}
+	tests := []struct {
+		permission string
+		want       bool
+	}{
+		{permUsersRead, true},
+		{permModeWrite, true},
+		{permUsersWrite, false},
+		{permClientsRead, false},
+		{permLocalAccess, false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := key.hasScope(tt.permission); got != tt.want {
+			t.Errorf("hasScope(%q) = %v, want %v", tt.permission, got, tt.want)
+		}
+	}
+	if (APIKey{}).hasScope(permUsersRead) {
+		t.Error("key without scopes has users:read")
+	}
+}
+
+// issueTestKey выпускает ключ; expiresIn < 0 - уже истекший
+func issueTestKey(t *testing.T, expiresIn time.Duration, scopes ...string) (string, APIKey) {
+	t.Helper()
+	var expiresAt *time.Time
+	if expiresIn != 0 {
+		at := time.Now().Add(expiresIn)
+		expiresAt = &at
+	}
+	secret, key, err := apiKeys.Create("test", scopes, expiresAt, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return secret, key
+}
+
+func TestVerifyAPIKeyRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		secret  func(valid, expired, revoked string) string
+		want    bool
+		counted bool // считается неудачной попыткой входа
+	}{
+		{"valid", func(valid, _, _ string) string { return valid }, true, false},
+		{"unknown id", func(string, string, string) string { return apiKeyPrefix + "000000000000_" + strings.Repeat("0", 48) }, false, true},
+		{"known id, wrong secret", func(valid, _, _ string) string { return valid[:len(valid)-1] + "x" }, false, true},
+		{"malformed", func(string, string, string) string { return apiKeyPrefix + "garbage" }, false, true},
+		{"expired", func(_, expired, _ string) string { return expired }, false, false},
+		{"revoked", func(_, _, revoked string) string { return revoked }, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestConfig(t)
+			useTestAPIKeys(t)
+			resetAuthAttempts(t)
+			valid, validKey := issueTestKey(t, time.Hour, permUsersRead)
+			expired, _ := issueTestKey(t, -time.Minute, permUsersRead)
+			revoked, revokedKey := issueTestKey(t, 0, permUsersRead)
+			if _, err := apiKeys.Revoke(revokedKey.ID); err != nil {
+				t.Fatal(err)
+			}
+
+			before := authFailures()
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/users", nil)
+			name, ok := verifyAPIKeyRequest(r, tt.secret(valid, expired, revoked))
+			if ok != tt.want {
+				t.Fatalf("verifyAPIKeyRequest ok = %v, want %v", ok, tt.want)
+			}
+			if ok && name != apiKeyPrincipalPrefix+validKey.ID {
+				t.Errorf("name = %q, want %q", name, apiKeyPrincipalPrefix+validKey.ID)
+			}
+			if counted := authFailures() > before; counted != tt.counted {
+				t.Errorf("counted as failure = %v, want %v", counted, tt.counted)
+			}
+		})
+	}
+}
+
+func TestAPIKeyScopeEnforcement(t *testing.T) {
+	tests := []struct {
+		name       string
+		scopes     []string
+		expiresIn  time.Duration
+		revoke     bool
+		permission string
+		status     int
+	}{
+		{"scope granted", []string{permUsersWrite}, 0, false, permUsersWrite, http.StatusOK},
+		{"mode scope granted", []string{permModeWrite}, 0, false, permModeWrite, http.StatusOK},
+		{"read-only key cannot write", []string{permUsersRead}, 0, false, permUsersWrite, http.StatusForbidden},
+		{"scopes never grant admin permissions", apiKeyScopes, 0, false, permAPIKeysManage, http.StatusForbidden},
+		{"not yet expired", []string{permUsersWrite}, time.Hour, false, permUsersWrite, http.StatusOK},
+		{"expired", []string{permUsersWrite}, -time.Minute, false, permUsersWrite, http.StatusUnauthorized},
+		{"revoked", []string{permUsersWrite}, 0, true, permUsersWrite, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestConfig(t)
+			useTestAPIKeys(t)
+			resetAuthAttempts(t)
+			useTestMode(t, modeServer)
+			secret, key := issueTestKey(t, tt.expiresIn, tt.scopes...)
+			if tt.revoke {
+				apiKeys.Revoke(key.ID)
+			}
+
+			handler := requirePermission(tt.permission, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/test", nil)
+			r.Header.Set("Authorization", "Bearer "+secret)
+			rec := httptest.NewRecorder()
+			withRequestID(handler)(rec, r)
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Время жизни токена подтверждения массовой операции
+const bulkTokenTTL = 5 * time.Minute
+
+// Количество пользователей, показываемых в предпросмотре
+const bulkPreviewSample = 10
+
+var (
+	errBulkConflict      = errors.New("matched users changed since preview")
+	errBulkTokenNotFound = errors.New("unknown or expired confirmation token")
+	errBulkCountMismatch = errors.New("count does not match preview")
+)
+
+// UserFilter описывает выборку пользователей для массовых операций
+type UserFilter struct {
+	IDs           []int      `json:"ids,omitempty"`
+	EmailDomain   string     `json:"email_domain,omitempty"`
+	EmailContains string     `json:"email_contains,omitempty"`
+	NameContains  string     `json:"name_contains,omitempty"`
+	CreatedAfter  *time.Time `json:"created_after,omitempty"`
+	CreatedBefore *time.Time `json:"created_before,omitempty"`
+}
+
+// IsEmpty сообщает, что фильтр не содержит ни одного критерия
+func (f UserFilter) IsEmpty() bool {
+	return len(f.IDs) == 0 && f.EmailDomain == "" && f.EmailContains == "" &&
+		f.NameContains == "" && f.CreatedAfter == nil && f.CreatedBefore == nil
+}
+
+// Matches проверяет, подходит ли пользователь под фильтр
+func (f UserFilter) Matches(user User) bool {
+	if len(f.IDs) > 0 {
+		found := false
+		for _, id := range f.IDs {
+			if id == user.ID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	email := strings.ToLower(user.Email)
+	if f.EmailDomain != "" {
+		domain := strings.ToLower(strings.TrimPrefix(f.EmailDomain, "@"))
+		if !strings.HasSuffix(email, "@"+domain) {
+			return false
+		}
+	}
+	if f.EmailContains != "" && !strings.Contains(email, strings.ToLower(f.EmailContains)) {
+		return false
+	}
+	if f.NameContains != "" && !strings.Contains(strings.ToLower(user.Name), strings.ToLower(f.NameContains)) {
+		return false
+	}
+	if f.CreatedAfter != nil && !user.CreatedAt.After(*f.CreatedAfter) {
+		return false
+	}
+	if f.CreatedBefore != nil && !user.CreatedAt.Before(*f.CreatedBefore) {
+		return false
+	}
+	return true
+}
+
+// UserPatch содержит поля, изменяемые массовым обновлением
+type UserPatch struct {
+	Name  *string `json:"name,omitempty"`
+	Email *string `json:"email,omitempty"`
+}
+
+// IsEmpty сообщает, что обновление ничего не меняет
+func (p UserPatch) IsEmpty() bool {
+	return p.Name == nil && p.Email == nil
+}
+
+// Apply возвращает копию пользователя с примененными изменениями
+func (p UserPatch) Apply(user User) User {
+	if p.Name != nil {
+		user.Name = *p.Name
+	}
+	if p.Email != nil {
+		user.Email = *p.Email
+	}
+	return user
+}
+
+// Match возвращает отсортированные ID пользователей, подходящих под фильтр
+func (db *InMemoryDB) Match(filter UserFilter) []int {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	return db.matchLocked(filter)
+}
+
+func (db *InMemoryDB) matchLocked(filter UserFilter) []int {
+	ids := make([]int, 0)
+	for id, user := range db.users {
+		if filter.Matches(user) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// checkBulkLocked убеждается, что выборка не изменилась с момента предпросмотра
+func (db *InMemoryDB) checkBulkLocked(filter UserFilter, ids []int) error {
+	current := db.matchLocked(filter)
+	if len(current) != len(ids) {
+		return errBulkConflict
+	}
+	for i := range current {
+		if current[i] != ids[i] {
+			return errBulkConflict
+		}
+	}
+	return nil
+}
+
+// BulkUpdate применяет изменения ко всем пользователям выборки или ни к одному
+func (db *InMemoryDB) BulkUpdate(filter UserFilter, ids []int, patch UserPatch) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if err := db.checkBulkLocked(filter, ids); err != nil {
+		return err
+	}
+
+	updated := make([]User, 0, len(ids))
+	for _, id := range ids {
+		user := patch.Apply(db.users[id])
+		if err := validateUser(user); err != nil {
+			return fmt.Errorf("user %d: %w", id, err)
+		}
+		updated = append(updated, user)
+	}
+	for _, user := range updated {
+		db.users[user.ID] = user
+	}
+	return nil
+}
+
+// BulkDelete удаляет всех пользователей выборки
+func (db *InMemoryDB) BulkDelete(filter UserFilter, ids []int) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if err := db.checkBulkLocked(filter, ids); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		delete(db.users, id)
+	}
+	return nil
+}
+
+// bulkPreviewRequest - тело запроса предпросмотра массовой операции
+type bulkPreviewRequest struct {
+	Action string     `json:"action"` // "update" или "delete"
+	Filter UserFilter `json:"filter"`
+	Update UserPatch  `json:"update"`
+}
+
+// bulkApplyRequest - подтверждение массовой операции токеном и числом из предпросмотра
+type bulkApplyRequest struct {
+	Token string `json:"token"`
+	Count *int   `json:"count"`
+}
+
+// bulkOperation - массовая операция, ожидающая подтверждения
+type bulkOperation struct {
+	Action    string
+	Filter    UserFilter
+	Patch     UserPatch
+	IDs       []int
+	ExpiresAt time.Time
+}
+
+var (
+	bulkOps   = make(map[string]*bulkOperation)
+	bulkOpsMu sync.Mutex
+)
+
+// pruneBulkOperationsLocked удаляет истекшие операции; bulkOpsMu должен быть захвачен
+func pruneBulkOperationsLocked(now time.Time) {
+	for t, op := range bulkOps {
+		if now.After(op.ExpiresAt) {
+			delete(bulkOps, t)
+		}
+	}
+}
+
+// addBulkOperation сохраняет операцию до подтверждения и возвращает ее токен
+func addBulkOperation(op *bulkOperation) string {
+	token := randomHex(16)
+
+	bulkOpsMu.Lock()
+	defer bulkOpsMu.Unlock()
+	pruneBulkOperationsLocked(time.Now())
+	bulkOps[token] = op
+	return token
+}
+
+// takeBulkOperation извлекает операцию по токену и числу из предпросмотра. Токен
+// одноразовый, но неверное число его не тратит: клиент может повторить подтверждение
+func takeBulkOperation(token string, count int) (*bulkOperation, error) {
+	bulkOpsMu.Lock()
+	defer bulkOpsMu.Unlock()
+	pruneBulkOperationsLocked(time.Now())
+
+	op, exists := bulkOps[token]
+	if !exists {
+		return nil, errBulkTokenNotFound
+	}
+	if count != len(op.IDs) {
+		return nil, errBulkCountMismatch
+	}
+	delete(bulkOps, token)
+	return op, nil
+}
+
+// Предпросмотр массовой операции: возвращает число затронутых пользователей и токен подтверждения
+func apiBulkPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var body bulkPreviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		sendError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	if body.Action != "update" && body.Action != "delete" {
+		sendError(w, http.StatusBadRequest, "Action must be 'update' or 'delete'")
+		return
+	}
+	if body.Filter.IsEmpty() {
+		sendError(w, http.StatusBadRequest, "Filter must contain at least one criterion")
+		return
+	}
+	if body.Action == "update" && body.Update.IsEmpty() {
+		sendError(w, http.StatusBadRequest, "Update must change at least one field")
+		return
+	}
+
+	ids := db.Match(body.Filter)
+
+	// Изменение проверяется на всей выборке, чтобы подтверждение не упало на пользователе вне образца
+	sample := make([]User, 0, bulkPreviewSample)
+	for _, id := range ids {
+		user, exists := db.GetByID(id)
+		if !exists {
+			continue
+		}
+		if body.Action == "update" {
+			if err := validateUser(body.Update.Apply(user)); err != nil {
+				sendError(w, http.StatusBadRequest, fmt.Sprintf("user %d: %v", id, err))
+				return
+			}
+		}
+		if len(sample) < bulkPreviewSample {
+			sample = append(sample, user)
+		}
+	}
+
+	// Применять нечего: без токена подтверждение не разошлет пустое users_bulk_changed
+	if len(ids) == 0 {
+		sendJSON(w, http.StatusOK, map[string]interface{}{
+			"action": body.Action,
+			"count":  0,
+			"sample": sample,
+		})
+		return
+	}
+
+	expiresAt := time.Now().Add(bulkTokenTTL)
+	token := addBulkOperation(&bulkOperation{
+		Action:    body.Action,
+		Filter:    body.Filter,
+		Patch:     body.Update,
+		IDs:       ids,
+		ExpiresAt: expiresAt,
+	})
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"action":     body.Action,
+		"count":      len(ids),
+		"sample":     sample,
+		"token":      token,
+		"expires_at": expiresAt.Format(time.RFC3339),
+	})
+}
+
+// Применение массовой операции по токену из предпросмотра
+func apiBulkApplyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	adminName, _ := requestRole(r)
+
+	var body bulkApplyRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		sendError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	if body.Token == "" || body.Count == nil {
+		sendError(w, http.StatusBadRequest, "Token and count from preview are required")
+		return
+	}
+
+	op, err := takeBulkOperation(body.Token, *body.Count)
+	switch {
+	case errors.Is(err, errBulkTokenNotFound):
+		sendError(w, http.StatusNotFound, "Unknown or expired confirmation token")
+		return
+	case errors.Is(err, errBulkCountMismatch):
+		sendError(w, http.StatusConflict, "Count does not match preview")
+		return
+	}
+
+	if op.Action == "delete" {
+		err = db.BulkDelete(op.Filter, op.IDs)
+	} else {
+		err = db.BulkUpdate(op.Filter, op.IDs, op.Patch)
+	}
+	if err != nil {
+		if errors.Is(err, errBulkConflict) {
+			sendError(w, http.StatusConflict, err.Error())
+		} else {
+			sendError(w, http.StatusBadRequest, err.Error())
+		}
+		return
+	}
+
+	// Одно сообщение на всю операцию вместо уведомления на каждого пользователя
+	broadcastToAll("users_bulk_changed", map[string]interface{}{
+		"action":     op.Action,
+		"count":      len(op.IDs),
+		"ids":        op.IDs,
+		"filter":     op.Filter,
+		"changed_by": adminName,
+	})
+
+	logDB.InfoContext(r.Context(), "массовая операция применена",
+		"action", op.Action,
+		"count", len(op.IDs),
+		"admin", adminName,
+		"admin_ip", clientIP(r),
+	)
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"action":  op.Action,
+		"count":   len(op.IDs),
+		"ids":     op.IDs,
+		"message": fmt.Sprintf("Операция '%s' применена к %d пользователям", op.Action, len(op.IDs)),
+	})
+}
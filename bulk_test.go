@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUserFilterMatches(t *testing.T) {
+	created := time.Date(2026, 5, 10, 12, 0, 0, 0, time.UTC)
+	user := User{ID: 7, Name: "Мария Петрова", Email: "Maria@Example.com", CreatedAt: created}
+	before, after := created.Add(-time.Hour), created.Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		filter UserFilter
+		want   bool
+	}{
+		{"empty filter", UserFilter{}, true},
+		{"id listed", UserFilter{IDs: []int{1, 7}}, true},
+		{"id not listed", UserFilter{IDs: []int{1, 2}}, false},
+		{"domain is case insensitive", UserFilter{EmailDomain: "EXAMPLE.com"}, true},
+		{"domain with leading @", UserFilter{EmailDomain: "@example.com"}, true},
+		{"domain suffix is not a subdomain match", UserFilter{EmailDomain: "ample.com"}, false},
+		{"email contains", UserFilter{EmailContains: "maria@"}, true},
+		{"email does not contain", UserFilter{EmailContains: "ivan"}, false},
+		{"name contains is case insensitive", UserFilter{NameContains: "петров"}, true},
+		{"name does not contain", UserFilter{NameContains: "Иван"}, false},
+		{"created after", UserFilter{CreatedAfter: &before}, true},
+		{"created after is exclusive", UserFilter{CreatedAfter: &created}, false},
+		{"created before", UserFilter{CreatedBefore: &after}, true},
+		{"created before is exclusive", UserFilter{CreatedBefore: &created}, false},
+		{"all criteria must match", UserFilter{IDs: []int{7}, EmailDomain: "example.com", NameContains: "иван"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Matches(user); got != tt.want {
+				t.Errorf("Matches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// useTestDB подменяет базу пользователей на время теста
+func useTestDB(t *testing.T, users ...User) {
+	t.Helper()
+	saved := db
+	db = &InMemoryDB{users: make(map[int]User), nextID: len(users) + 1}
+	for _, user := range users {
+		db.users[user.ID] = user
+	}
+	t.Cleanup(func() { db = saved })
+}
+
+// postJSON вызывает обработчик с JSON-телом и разбирает ответ
+func postJSON(t *testing.T, handler http.HandlerFunc, body interface{}) (int, map[string]interface{}) {
+	t.Helper()
+	data, _ := json.Marshal(body)
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/admin/users/bulk", bytes.NewReader(data)))
+	var response map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &response)
+	return rec.Code, response
+}
+
+func TestBulkPreviewApply(t *testing.T) {
+	newName := "Переименован"
+	invalidEmail := ""
+	tests := []struct {
+		name     string
+		preview  bulkPreviewRequest
+		status   int // ответ предпросмотра
+		count    int
+		apply    []int // числа, передаваемые при подтверждении, и ожидаемые статусы
+		statuses []int
+		remain   int
+	}{
+		{
+			name:     "delete by domain",
+			preview:  bulkPreviewRequest{Action: "delete", Filter: UserFilter{EmailDomain: "example.com"}},
+			status:   http.StatusOK,
+			count:    2,
+			apply:    []int{2},
+			statuses: []int{http.StatusOK},
+			remain:   1,
+		},
+		{
+			name:     "wrong count keeps the token",
+			preview:  bulkPreviewRequest{Action: "delete", Filter: UserFilter{EmailDomain: "example.com"}},
+			status:   http.StatusOK,
+			count:    2,
+			apply:    []int{3, 2, 2},
+			statuses: []int{http.StatusConflict, http.StatusOK, http.StatusNotFound},
+			remain:   1,
+		},
+		{
+			name:     "update by ids",
+			preview:  bulkPreviewRequest{Action: "update", Filter: UserFilter{IDs: []int{1}}, Update: UserPatch{Name: &newName}},
+			status:   http.StatusOK,
+			count:    1,
+			apply:    []int{1},
+			statuses: []int{http.StatusOK},
+			remain:   3,
+		},
+		{
+			name:    "empty filter is rejected",
+			preview: bulkPreviewRequest{Action: "delete"},
+			status:  http.StatusBadRequest,
+			remain:  3,
+		},
+		{
+			name:    "unknown action is rejected",
+			preview: bulkPreviewRequest{Action: "truncate", Filter: UserFilter{IDs: []int{1}}},
+			status:  http.StatusBadRequest,
+			remain:  3,
+		},
+		{
+			name:    "update without fields is rejected",
+			preview: bulkPreviewRequest{Action: "update", Filter: UserFilter{IDs: []int{1}}},
+			status:  http.StatusBadRequest,
+			remain:  3,
+		},
+		{
+			name:    "invalid update is rejected at preview",
+			preview: bulkPreviewRequest{Action: "update", Filter: UserFilter{IDs: []int{1}}, Update: UserPatch{Email: &invalidEmail}},
+			status:  http.StatusBadRequest,
+			remain:  3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDB(t,
+				User{ID: 1, Name: "Алексей Иванов", Email: "alex@example.com"},
+				User{ID: 2, Name: "Мария Петрова", Email: "maria@example.com"},
+				User{ID: 3, Name: "Иван Сидоров", Email: "ivan@company.ru"},
+			)
+
+			status, preview := postJSON(t, apiBulkPreviewHandler, tt.preview)
+			if status != tt.status {
+				t.Fatalf("preview status %d, want %d: %v", status, tt.status, preview)
+			}
+			if status == http.StatusOK && int(preview["count"].(float64)) != tt.count {
+				t.Fatalf("preview count %v, want %d", preview["count"], tt.count)
+			}
+			for i, count := range tt.apply {
+				status, response := postJSON(t, apiBulkApplyHandler, map[string]interface{}{"token": preview["token"], "count": count})
+				if status != tt.statuses[i] {
+					t.Fatalf("apply #%d with count %d: status %d, want %d: %v", i, count, status, tt.statuses[i], response)
+				}
+			}
+			if got := db.Count(); got != tt.remain {
+				t.Errorf("%d users remain, want %d", got, tt.remain)
+			}
+		})
+	}
+}
+
+func TestBulkApplyConflictAfterPreview(t *testing.T) {
+	useTestDB(t,
+		User{ID: 1, Name: "Алексей Иванов", Email: "alex@example.com"},
+		User{ID: 2, Name: "Мария Петрова", Email: "maria@example.com"},
+	)
+	_, preview := postJSON(t, apiBulkPreviewHandler, bulkPreviewRequest{Action: "delete", Filter: UserFilter{EmailDomain: "example.com"}})
+	db.Add(User{Name: "Новый", Email: "new@example.com"})
+
+	status, _ := postJSON(t, apiBulkApplyHandler, map[string]interface{}{"token": preview["token"], "count": 2})
+	if status != http.StatusConflict {
+		t.Fatalf("apply after the selection changed: status %d, want %d", status, http.StatusConflict)
+	}
+	if got := db.Count(); got != 3 {
+		t.Errorf("%d users remain, want 3", got)
+	}
+}
+
+func TestBulkPreviewValidatesBeyondSample(t *testing.T) {
+	users := make([]User, bulkPreviewSample+2)
+	for i := range users {
+		users[i] = User{ID: i + 1, Name: fmt.Sprintf("Пользователь %d", i+1), Email: fmt.Sprintf("user%d@example.com", i+1)}
+	}
+	// Последний пользователь не попадает в образец, и переименование делает его запись недопустимой
+	users[len(users)-1].Email = "broken"
+	useTestDB(t, users...)
+
+	newName := "Переименован"
+	status, response := postJSON(t, apiBulkPreviewHandler, bulkPreviewRequest{
+		Action: "update",
+		Filter: UserFilter{NameContains: "Пользователь"},
+		Update: UserPatch{Name: &newName},
+	})
+	if status != http.StatusBadRequest {
+		t.Fatalf("preview status %d, want %d: %v", status, http.StatusBadRequest, response)
+	}
+	if msg, _ := response["error"].(string); !strings.Contains(msg, fmt.Sprintf("user %d", len(users))) {
+		t.Errorf("error %q does not name the invalid user", msg)
+	}
+	if _, exists := response["token"]; exists {
+		t.Error("preview issued a token for an update that cannot be applied")
+	}
+}
+
+func TestBulkPreviewWithoutMatches(t *testing.T) {
+	useTestDB(t, User{ID: 1, Name: "Алексей Иванов", Email: "alex@example.com"})
+	bulkOpsMu.Lock()
+	pending := len(bulkOps)
+	bulkOpsMu.Unlock()
+
+	for _, action := range []string{"delete", "update"} {
+		newName := "Переименован"
+		status, response := postJSON(t, apiBulkPreviewHandler, bulkPreviewRequest{
+			Action: action,
+			Filter: UserFilter{EmailDomain: "nowhere.test"},
+			Update: UserPatch{Name: &newName},
+		})
+		if status != http.StatusOK || response["count"] != float64(0) {
+			t.Fatalf("%s: status %d, response %v", action, status, response)
+		}
+		if sample, _ := response["sample"].([]interface{}); sample == nil || len(sample) != 0 {
+			t.Errorf("%s: sample = %v, want an empty list", action, response["sample"])
+		}
+		if _, exists := response["token"]; exists {
+			t.Errorf("%s: preview issued a token for an empty selection", action)
+		}
+	}
+
+	bulkOpsMu.Lock()
+	defer bulkOpsMu.Unlock()
+	if len(bulkOps) != pending {
+		t.Errorf("%d pending operations, want %d", len(bulkOps), pending)
+	}
+}
+
+func TestBulkOperationsPrunedOnPreview(t *testing.T) {
+	bulkOpsMu.Lock()
+	saved := bulkOps
+	bulkOps = map[string]*bulkOperation{"expired": {ExpiresAt: time.Now().Add(-time.Second)}}
+	bulkOpsMu.Unlock()
+	t.Cleanup(func() {
+		bulkOpsMu.Lock()
+		bulkOps = saved
+		bulkOpsMu.Unlock()
+	})
+
+	token := addBulkOperation(&bulkOperation{ExpiresAt: time.Now().Add(bulkTokenTTL)})
+
+	bulkOpsMu.Lock()
+	defer bulkOpsMu.Unlock()
+	if _, exists := bulkOps["expired"]; exists {
+		t.Error("expired operation was not pruned when a preview was created")
+	}
+	if _, exists := bulkOps[token]; !exists {
+		t.Error("new operation was not stored")
+	}
+}
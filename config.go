@@ -0,0 +1,534 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Префикс переменных окружения
+const envPrefix = "USERMANAGER_"
+
+// Самый короткий допустимый admin_token
+const minAdminTokenLength = 16
+
+// Duration - time.Duration, записываемая в JSON строкой ("30s") или числом секунд
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var seconds float64
+	if err := json.Unmarshal(data, &seconds); err == nil {
+		d.Duration = time.Duration(seconds * float64(time.Second))
+		return nil
+	}
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string or number of seconds")
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// LogConfig - настройки журнала
+type LogConfig struct {
+	Format     string            `json:"format"`      // "json" или "text"
+	Level      string            `json:"level"`       // уровень по умолчанию для всех подсистем
+	Levels     map[string]string `json:"levels"`      // уровни отдельных подсистем
+	File       string            `json:"file"`        // пустая строка - stdout
+	MaxSizeMB  int               `json:"max_size_mb"` // размер файла до ротации
+	MaxBackups int               `json:"max_backups"` // число архивных файлов
+}
+
+// Config - конфигурация сервера.
+// Приоритет источников: значения по умолчанию < файл < переменные окружения < флаги.
+type Config struct {
+	Addr             string          `json:"addr"`
+	AdminPassword    string          `json:"admin_password"`
+	AdminToken       string          `json:"admin_token"`
+	SessionSecret    string          `json:"session_secret"` // пусто - ключ в data_dir/session.key
+	SessionTTL       Duration        `json:"session_ttl"`
+	RefreshTTL       Duration        `json:"refresh_ttl"`
+	DataDir          string          `json:"data_dir"`
+	HandshakeTimeout Duration        `json:"handshake_timeout"`
+	ReadDeadline     Duration        `json:"read_deadline"`
+	PingInterval     Duration        `json:"ping_interval"`
+	CleanupInterval  Duration        `json:"cleanup_interval"`
+	CleanupThreshold Duration        `json:"cleanup_threshold"`
+	ShutdownTimeout  Duration        `json:"shutdown_timeout"`
+	ExpectedDowntime Duration        `json:"expected_downtime"`
+	ModeAnnounce     Duration        `json:"mode_announce"` // предупреждение о плановой смене режима
+	Log              LogConfig       `json:"log"`
+	TLS              TLSConfig       `json:"tls"`
+	RateLimit        RateLimitConfig `json:"rate_limit"`
+	Lockout          LockoutConfig   `json:"lockout"`
+	CORS             CORSConfig      `json:"cors"`
+	LocalAllowlist   []string        `json:"local_allowlist"` // сети (CIDR), доверенные в локальном режиме
+}
+
+// cfg - действующая конфигурация
+var cfg = defaultConfig()
+
+func defaultConfig() Config {
+	return Config{
+		Addr:             ":8068",
+		SessionTTL:       Duration{15 * time.Minute},
+		RefreshTTL:       Duration{24 * time.Hour},
+		DataDir:          "data",
+		HandshakeTimeout: Duration{5 * time.Second},
+		ReadDeadline:     Duration{60 * time.Second},
+		PingInterval:     Duration{30 * time.Second},
+		CleanupInterval:  Duration{60 * time.Second},
+		CleanupThreshold: Duration{120 * time.Second},
+		ShutdownTimeout:  Duration{10 * time.Second},
+		ExpectedDowntime: Duration{30 * time.Second},
+		ModeAnnounce:     Duration{5 * time.Minute},
+		Log: LogConfig{
+			Format:     "text",
+			Level:      "info",
+			Levels:     map[string]string{},
+			MaxSizeMB:  100,
+			MaxBackups: 5,
+		},
+		TLS: TLSConfig{
+			Hosts: []string{"localhost", "127.0.0.1", "::1"},
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:   true,
+			Read:      RateLimit{PerMinute: 600, Burst: 100},
+			Write:     RateLimit{PerMinute: 120, Burst: 30},
+			Admin:     RateLimit{PerMinute: 10, Burst: 5},
+			WSConnect: RateLimit{PerMinute: 30, Burst: 10},
+		},
+		Lockout: LockoutConfig{
+			MaxFailures:       5,
+			BaseDuration:      Duration{30 * time.Second},
+			MaxDuration:       Duration{30 * time.Minute},
+			GlobalMaxFailures: 100,
+			GlobalWindow:      Duration{5 * time.Minute},
+			GlobalDuration:    Duration{time.Minute},
+		},
+		CORS: CORSConfig{
+			// Копия фронтенда на GitHub Pages и локальная разработка
+			AllowedOrigins: []string{
+				"https://dmitriy43229.github.io",
+				"http://localhost:*", "https://localhost:*",
+				"http://127.0.0.1:*", "https://127.0.0.1:*",
+			},
+			MaxAge: Duration{10 * time.Minute},
+		},
+	}
+}
+
+// configOption - параметр, задаваемый флагом и переменной окружения.
+// Имя флага совпадает с name, переменная - USERMANAGER_ + name в верхнем регистре с "_" вместо "-".
+type configOption struct {
+	name   string
+	usage  string
+	secret bool
+	isBool bool
+	get    func(c *Config) string
+	set    func(c *Config, value string) error
+}
+
+func stringOption(name, usage string, secret bool, field func(c *Config) *string) configOption {
+	return configOption{
+		name:   name,
+		usage:  usage,
+		secret: secret,
+		get:    func(c *Config) string { return *field(c) },
+		set: func(c *Config, value string) error {
+			*field(c) = value
+			return nil
+		},
+	}
+}
+
+func durationOption(name, usage string, field func(c *Config) *Duration) configOption {
+	return configOption{
+		name:  name,
+		usage: usage,
+		get:   func(c *Config) string { return field(c).String() },
+		set: func(c *Config, value string) error {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return err
+			}
+			field(c).Duration = d
+			return nil
+		},
+	}
+}
+
+func boolOption(name, usage string, field func(c *Config) *bool) configOption {
+	return configOption{
+		name:   name,
+		usage:  usage,
+		isBool: true,
+		get:    func(c *Config) string { return strconv.FormatBool(*field(c)) },
+		set: func(c *Config, value string) error {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return err
+			}
+			*field(c) = b
+			return nil
+		},
+	}
+}
+
+// listOption - список значений через запятую
+func listOption(name, usage string, field func(c *Config) *[]string) configOption {
+	return configOption{
+		name:  name,
+		usage: usage,
+		get:   func(c *Config) string { return strings.Join(*field(c), ",") },
+		set: func(c *Config, value string) error {
+			items := make([]string, 0)
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			*field(c) = items
+			return nil
+		},
+	}
+}
+
+func intOption(name, usage string, field func(c *Config) *int) configOption {
+	return configOption{
+		name:  name,
+		usage: usage,
+		get:   func(c *Config) string { return strconv.Itoa(*field(c)) },
+		set: func(c *Config, value string) error {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return err
+			}
+			*field(c) = n
+			return nil
+		},
+	}
+}
+
+// configOptions перечисляет все параметры в порядке вывода
+func configOptions() []configOption {
+	options := []configOption{
+		stringOption("addr", "адрес HTTP-сервера", false, func(c *Config) *string { return &c.Addr }),
+		stringOption("admin-password", "пароль администратора", true, func(c *Config) *string { return &c.AdminPassword }),
+		stringOption("admin-token", "токен администратора", true, func(c *Config) *string { return &c.AdminToken }),
+		stringOption("session-secret", "ключ подписи сессий администраторов", true, func(c *Config) *string { return &c.SessionSecret }),
+		durationOption("session-ttl", "срок действия токена сессии", func(c *Config) *Duration { return &c.SessionTTL }),
+		durationOption("refresh-ttl", "срок действия токена обновления сессии", func(c *Config) *Duration { return &c.RefreshTTL }),
+		stringOption("data-dir", "каталог для сохраняемых данных", false, func(c *Config) *string { return &c.DataDir }),
+		durationOption("handshake-timeout", "таймаут WebSocket-рукопожатия", func(c *Config) *Duration { return &c.HandshakeTimeout }),
+		durationOption("read-deadline", "таймаут чтения WebSocket", func(c *Config) *Duration { return &c.ReadDeadline }),
+		durationOption("ping-interval", "интервал ping-сообщений", func(c *Config) *Duration { return &c.PingInterval }),
+		durationOption("cleanup-interval", "интервал очистки неактивных клиентов", func(c *Config) *Duration { return &c.CleanupInterval }),
+		durationOption("cleanup-threshold", "время бездействия до отключения клиента", func(c *Config) *Duration { return &c.CleanupThreshold }),
+		durationOption("shutdown-timeout", "ожидание завершения запросов при остановке", func(c *Config) *Duration { return &c.ShutdownTimeout }),
+		durationOption("expected-downtime", "ожидаемый простой, сообщаемый клиентам", func(c *Config) *Duration { return &c.ExpectedDowntime }),
+		listOption("local-allowlist", "сети (CIDR или IP), работающие в локальном режиме как в серверном", func(c *Config) *[]string { return &c.LocalAllowlist }),
+		durationOption("mode-announce", "за сколько предупреждать клиентов о плановой смене режима", func(c *Config) *Duration { return &c.ModeAnnounce }),
+		stringOption("log-format", "формат журнала: text или json", false, func(c *Config) *string { return &c.Log.Format }),
+		stringOption("log-level", "уровень журнала по умолчанию", false, func(c *Config) *string { return &c.Log.Level }),
+		stringOption("log-file", "файл журнала (пусто - stdout)", false, func(c *Config) *string { return &c.Log.File }),
+		intOption("log-max-size-mb", "размер файла журнала до ротации", func(c *Config) *int { return &c.Log.MaxSizeMB }),
+		intOption("log-max-backups", "число архивных файлов журнала", func(c *Config) *int { return &c.Log.MaxBackups }),
+		stringOption("tls-cert", "файл сертификата TLS", false, func(c *Config) *string { return &c.TLS.CertFile }),
+		stringOption("tls-key", "файл ключа TLS", false, func(c *Config) *string { return &c.TLS.KeyFile }),
+		boolOption("tls-self-signed", "создать самоподписанный сертификат для локальной разработки", func(c *Config) *bool { return &c.TLS.SelfSigned }),
+		listOption("tls-hosts", "имена и IP для самоподписанного сертификата", func(c *Config) *[]string { return &c.TLS.Hosts }),
+		stringOption("tls-redirect-addr", "адрес HTTP-сервера, перенаправляющего на HTTPS", false, func(c *Config) *string { return &c.TLS.RedirectAddr }),
+		boolOption("rate-limit-enabled", "ограничивать частоту запросов с одного IP", func(c *Config) *bool { return &c.RateLimit.Enabled }),
+		intOption("lockout-max-failures", "неудачных входов администратора с одного IP до блокировки", func(c *Config) *int { return &c.Lockout.MaxFailures }),
+		durationOption("lockout-base-duration", "первая блокировка, далее удваивается", func(c *Config) *Duration { return &c.Lockout.BaseDuration }),
+		durationOption("lockout-max-duration", "максимальная блокировка IP", func(c *Config) *Duration { return &c.Lockout.MaxDuration }),
+		intOption("lockout-global-max-failures", "неудачных входов со всех IP до общей блокировки (0 - выключено)", func(c *Config) *int { return &c.Lockout.GlobalMaxFailures }),
+		durationOption("lockout-global-window", "окно подсчета неудачных входов со всех IP", func(c *Config) *Duration { return &c.Lockout.GlobalWindow }),
+		durationOption("lockout-global-duration", "длительность общей блокировки", func(c *Config) *Duration { return &c.Lockout.GlobalDuration }),
+		listOption("cors-allowed-origins", "разрешенные origins: https://*.example.com, http://localhost:*, *", func(c *Config) *[]string { return &c.CORS.AllowedOrigins }),
+		listOption("cors-admin-origins", "origins для /admin и /auth (пусто - как cors-allowed-origins)", func(c *Config) *[]string { return &c.CORS.AdminOrigins }),
+		boolOption("cors-allow-credentials", "разрешать запросы с учетными данными браузера", func(c *Config) *bool { return &c.CORS.AllowCredentials }),
+		durationOption("cors-max-age", "время кеширования предзапросов CORS", func(c *Config) *Duration { return &c.CORS.MaxAge }),
+	}
+
+	// Уровни подсистем: -log-level-http, USERMANAGER_LOG_LEVEL_WS и т.д.
+	for _, name := range []string{subsystemHTTP, subsystemWS, subsystemMode, subsystemDB} {
+		name := name
+		options = append(options, configOption{
+			name:  "log-level-" + name,
+			usage: "уровень журнала подсистемы " + name,
+			get:   func(c *Config) string { return c.Log.Levels[name] },
+			set: func(c *Config, value string) error {
+				if c.Log.Levels == nil {
+					c.Log.Levels = map[string]string{}
+				}
+				c.Log.Levels[name] = value
+				return nil
+			},
+		})
+	}
+
+	// Лимиты классов маршрутов: -rate-limit-read-per-minute, USERMANAGER_RATE_LIMIT_ADMIN_BURST и т.д.
+	for _, class := range rateClasses {
+		class := class
+		name := "rate-limit-" + strings.ReplaceAll(class, "_", "-")
+		options = append(options,
+			intOption(name+"-per-minute", "запросов в минуту с одного IP для класса "+class,
+				func(c *Config) *int { return &c.RateLimit.class(class).PerMinute }),
+			intOption(name+"-burst", "допустимый всплеск запросов для класса "+class,
+				func(c *Config) *int { return &c.RateLimit.class(class).Burst }),
+		)
+	}
+	return options
+}
+
+// optionFlag - значение флага, хранящее строку до применения к конфигурации
+type optionFlag struct {
+	value  string
+	isBool bool
+}
+
+func (f *optionFlag) String() string     { return f.value }
+func (f *optionFlag) Set(v string) error { f.value = v; return nil }
+func (f *optionFlag) IsBoolFlag() bool   { return f.isBool }
+
+func (o configOption) envName() string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(o.name, "-", "_"))
+}
+
+// loadConfig собирает конфигурацию из файла, окружения и флагов командной строки
+// и возвращает оставшиеся позиционные аргументы (подкоманду)
+func loadConfig(args []string) (Config, []string, error) {
+	c := defaultConfig()
+	options := configOptions()
+
+	fs := flag.NewFlagSet("usermanager", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv(envPrefix+"CONFIG"), "путь к JSON-файлу конфигурации")
+	values := make(map[string]*optionFlag, len(options))
+	for _, option := range options {
+		values[option.name] = &optionFlag{value: option.get(&c), isBool: option.isBool}
+		fs.Var(values[option.name], option.name, option.usage+" (env "+option.envName()+")")
+	}
+	if err := fs.Parse(args); err != nil {
+		return c, nil, err
+	}
+
+	// 1. Файл конфигурации
+	if *configPath != "" {
+		data, err := os.ReadFile(*configPath)
+		if err != nil {
+			return c, nil, fmt.Errorf("config file: %w", err)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&c); err != nil {
+			return c, nil, fmt.Errorf("config file %s: %w", *configPath, err)
+		}
+	}
+
+	// 2. Переменные окружения
+	for _, option := range options {
+		if value, ok := os.LookupEnv(option.envName()); ok {
+			if err := option.set(&c, value); err != nil {
+				return c, nil, fmt.Errorf("%s: %w", option.envName(), err)
+			}
+		}
+	}
+
+	// 3. Явно заданные флаги
+	var flagErr error
+	byName := make(map[string]configOption, len(options))
+	for _, option := range options {
+		byName[option.name] = option
+	}
+	fs.Visit(func(f *flag.Flag) {
+		option, exists := byName[f.Name]
+		if !exists || flagErr != nil {
+			return
+		}
+		if err := option.set(&c, values[f.Name].value); err != nil {
+			flagErr = fmt.Errorf("-%s: %w", f.Name, err)
+		}
+	})
+	if flagErr != nil {
+		return c, nil, flagErr
+	}
+
+	return c, fs.Args(), c.Validate()
+}
+
+// Validate проверяет согласованность конфигурации
+func (c Config) Validate() error {
+	var errs []error
+
+	if _, _, err := net.SplitHostPort(c.Addr); err != nil {
+		errs = append(errs, fmt.Errorf("addr: %w", err))
+	}
+	if c.AdminPassword != "" && len(c.AdminPassword) < adminMinPassword {
+		errs = append(errs, fmt.Errorf("admin_password must be at least %d characters", adminMinPassword))
+	}
+	if c.AdminToken != "" && len(c.AdminToken) < minAdminTokenLength {
+		errs = append(errs, fmt.Errorf("admin_token must be at least %d characters", minAdminTokenLength))
+	}
+	if c.DataDir == "" {
+		errs = append(errs, errors.New("data_dir must not be empty"))
+	}
+
+	durations := map[string]Duration{
+		"handshake_timeout": c.HandshakeTimeout,
+		"read_deadline":     c.ReadDeadline,
+		"ping_interval":     c.PingInterval,
+		"cleanup_interval":  c.CleanupInterval,
+		"cleanup_threshold": c.CleanupThreshold,
+		"shutdown_timeout":  c.ShutdownTimeout,
+		"session_ttl":       c.SessionTTL,
+		"refresh_ttl":       c.RefreshTTL,
+	}
+	for name, d := range durations {
+		if d.Duration <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", name))
+		}
+	}
+	if c.SessionSecret != "" && len(c.SessionSecret) < 32 {
+		errs = append(errs, errors.New("session_secret must be at least 32 characters"))
+	}
+	if c.RefreshTTL.Duration < c.SessionTTL.Duration {
+		errs = append(errs, errors.New("refresh_ttl must not be shorter than session_ttl"))
+	}
+	if c.ExpectedDowntime.Duration < 0 {
+		errs = append(errs, errors.New("expected_downtime must not be negative"))
+	}
+	if c.ModeAnnounce.Duration < 0 {
+		errs = append(errs, errors.New("mode_announce must not be negative"))
+	}
+	if _, err := parseNetworks(c.LocalAllowlist); err != nil {
+		errs = append(errs, fmt.Errorf("local_allowlist: %w", err))
+	}
+	// Клиенту нужно успеть получить ping до истечения таймаута чтения
+	if c.ReadDeadline.Duration <= c.PingInterval.Duration {
+		errs = append(errs, errors.New("read_deadline must be greater than ping_interval"))
+	}
+	if c.CleanupThreshold.Duration <= c.PingInterval.Duration {
+		errs = append(errs, errors.New("cleanup_threshold must be greater than ping_interval"))
+	}
+
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		errs = append(errs, fmt.Errorf("log format must be 'text' or 'json', got %q", c.Log.Format))
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		errs = append(errs, fmt.Errorf("log level: %w", err))
+	}
+	for name, value := range c.Log.Levels {
+		if _, exists := logLevels[name]; !exists {
+			errs = append(errs, fmt.Errorf("unknown log subsystem %q", name))
+			continue
+		}
+		if value == "" {
+			continue
+		}
+		if err := level.UnmarshalText([]byte(value)); err != nil {
+			errs = append(errs, fmt.Errorf("log level for %s: %w", name, err))
+		}
+	}
+	if c.Log.MaxSizeMB < 0 || c.Log.MaxBackups < 0 {
+		errs = append(errs, errors.New("log rotation limits must not be negative"))
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		errs = append(errs, errors.New("tls cert and key must be set together"))
+	}
+	if c.TLS.CertFile != "" && c.TLS.SelfSigned {
+		errs = append(errs, errors.New("tls self_signed cannot be combined with cert/key files"))
+	}
+	if c.TLS.SelfSigned && len(c.TLS.Hosts) == 0 {
+		errs = append(errs, errors.New("tls hosts must not be empty for a self-signed certificate"))
+	}
+	if c.TLS.RedirectAddr != "" {
+		if !c.TLS.Enabled() {
+			errs = append(errs, errors.New("tls redirect_addr requires TLS to be enabled"))
+		} else if _, _, err := net.SplitHostPort(c.TLS.RedirectAddr); err != nil {
+			errs = append(errs, fmt.Errorf("tls redirect_addr: %w", err))
+		}
+	}
+
+	if c.Lockout.MaxFailures <= 0 {
+		errs = append(errs, errors.New("lockout max_failures must be positive"))
+	}
+	if c.Lockout.BaseDuration.Duration <= 0 || c.Lockout.MaxDuration.Duration < c.Lockout.BaseDuration.Duration {
+		errs = append(errs, errors.New("lockout durations must be positive and max_duration >= base_duration"))
+	}
+	if c.Lockout.GlobalMaxFailures < 0 {
+		errs = append(errs, errors.New("lockout global_max_failures must not be negative"))
+	} else if c.Lockout.GlobalMaxFailures > 0 && (c.Lockout.GlobalWindow.Duration <= 0 || c.Lockout.GlobalDuration.Duration <= 0) {
+		errs = append(errs, errors.New("lockout global_window and global_duration must be positive"))
+	}
+
+	for _, class := range rateClasses {
+		limit := c.RateLimit.class(class)
+		if limit.PerMinute < 0 || limit.Burst < 0 {
+			errs = append(errs, fmt.Errorf("rate_limit %s must not be negative", class))
+		} else if limit.PerMinute > 0 && limit.Burst == 0 {
+			errs = append(errs, fmt.Errorf("rate_limit %s burst must be positive", class))
+		}
+	}
+
+	for _, origins := range [][]string{c.CORS.AllowedOrigins, c.CORS.AdminOrigins} {
+		if _, err := parseOriginPatterns(origins); err != nil {
+			errs = append(errs, fmt.Errorf("cors: %w", err))
+		}
+		for _, origin := range origins {
+			if origin == "*" && c.CORS.AllowCredentials {
+				errs = append(errs, errors.New("cors: '*' cannot be combined with allow_credentials"))
+			}
+		}
+	}
+	if c.CORS.MaxAge.Duration < 0 {
+		errs = append(errs, errors.New("cors max_age must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// maskSecret скрывает значение секрета в выводе
+func maskSecret(value string) string {
+	if value == "" {
+		return "(не задан)"
+	}
+	return "********"
+}
+
+// printConfig выводит действующую конфигурацию, скрывая секреты
+func printConfig(w io.Writer, c Config) {
+	for _, option := range configOptions() {
+		value := option.get(&c)
+		if option.secret {
+			value = maskSecret(value)
+		}
+		if value == "" {
+			continue
+		}
+		fmt.Fprintf(w, "   %-20s %s\n", option.name, value)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestConfig записывает файл конфигурации во временный каталог
+func writeTestConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	file := writeTestConfig(t, `{"addr": "127.0.0.1:1001", "data_dir": "file-data", "session_ttl": "20m", "log": {"level": "warn"}}`)
+	defaults := defaultConfig()
+	tests := []struct {
+		name    string
+		env     map[string]string
+		args    []string
+		addr    string
+		dataDir string
+		ttl     time.Duration
+	}{
+		{"defaults", nil, nil, defaults.Addr, defaults.DataDir, defaults.SessionTTL.Duration},
+		{"file over defaults", nil, []string{"-config", file}, "127.0.0.1:1001", "file-data", 20 * time.Minute},
+		{"config path from env", map[string]string{"USERMANAGER_CONFIG": file}, nil, "127.0.0.1:1001", "file-data", 20 * time.Minute},
+		{"env over file",
+			map[string]string{"USERMANAGER_ADDR": "127.0.0.1:2002", "USERMANAGER_SESSION_TTL": "30m"},
+			[]string{"-config", file}, "127.0.0.1:2002", "file-data", 30 * time.Minute},
+		{"flags over env and file",
+			map[string]string{"USERMANAGER_ADDR": "127.0.0.1:2002", "USERMANAGER_SESSION_TTL": "30m"},
+			[]string{"-config", file, "-addr", "127.0.0.1:3003", "-session-ttl", "40m"}, "127.0.0.1:3003", "file-data", 40 * time.Minute},
+		{"flags over defaults without file", nil, []string{"-data-dir", "flag-data"}, defaults.Addr, "flag-data", defaults.SessionTTL.Duration},
+		// Флаг, не заданный явно, не возвращает значение по умолчанию поверх файла и окружения
+		{"unset flags keep env", map[string]string{"USERMANAGER_DATA_DIR": "env-data"}, []string{"-config", file, "-addr", "127.0.0.1:3003"}, "127.0.0.1:3003", "env-data", 20 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			c, _, err := loadConfig(tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Addr != tt.addr || c.DataDir != tt.dataDir || c.SessionTTL.Duration != tt.ttl {
+				t.Errorf("addr %q, data_dir %q, session_ttl %v; want %q, %q, %v",
+					c.Addr, c.DataDir, c.SessionTTL.Duration, tt.addr, tt.dataDir, tt.ttl)
+			}
+		})
+	}
+
+	// Значения файла, не перекрытые другими источниками, сохраняются
+	c, rest, err := loadConfig([]string{"-config", file, "serve"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Log.Level != "warn" || c.Log.Format != defaults.Log.Format {
+		t.Errorf("log = %+v, want level from file and default format", c.Log)
+	}
+	if len(rest) != 1 || rest[0] != "serve" {
+		t.Errorf("positional args = %v, want [serve]", rest)
+	}
+}
+
+func TestLoadConfigRejectsInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		args    []string
+		wantErr string
+	}{
+		{"unknown file field", `{"adress": "127.0.0.1:1"}`, nil, nil, "adress"},
+		{"malformed file", `{"addr": `, nil, nil, "config file"},
+		{"wrong type in file", `{"session_ttl": true}`, nil, nil, "config file"},
+		{"missing file", "", nil, []string{"-config", "/nonexistent/config.json"}, "config file"},
+		{"bad duration in env", "", map[string]string{"USERMANAGER_SESSION_TTL": "soon"}, nil, "USERMANAGER_SESSION_TTL"},
+		{"bad duration flag", "", nil, []string{"-read-deadline", "long"}, "-read-deadline"},
+		{"unknown flag", "", nil, []string{"-no-such-flag"}, "no-such-flag"},
+		{"bad addr", "", nil, []string{"-addr", "no-port"}, "addr"},
+		{"zero session ttl", "", nil, []string{"-session-ttl", "0s"}, "session_ttl must be positive"},
+		{"refresh shorter than session", "", nil, []string{"-session-ttl", "2h", "-refresh-ttl", "1h"}, "refresh_ttl"},
+		{"read deadline not above ping", "", nil, []string{"-read-deadline", "10s", "-ping-interval", "10s"}, "read_deadline"},
+		{"short admin password", "", map[string]string{"USERMANAGER_ADMIN_PASSWORD": "short"}, nil, "admin_password"},
+		{"short session secret", `{"session_secret": "too-short"}`, nil, nil, "session_secret"},
+		{"bad allowlist", "", nil, []string{"-local-allowlist", "10.0.0.0/33"}, "local_allowlist"},
+		{"bad log format", `{"log": {"format": "xml"}}`, nil, nil, "log format"},
+		{"empty data dir from env", "", map[string]string{"USERMANAGER_DATA_DIR": ""}, nil, "data_dir"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeTestConfig(t, tt.file)}, args...)
+			}
+			_, _, err := loadConfig(args)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("loadConfig error = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Политики CORS маршрутов
+const (
+	corsDefault = ""       // origins из cors.allowed_origins
+	corsAdmin   = "admin"  // origins из cors.admin_origins (по умолчанию те же)
+	corsPublic  = "public" // любой origin без учетных данных: документация, здоровье
+)
+
+// CORSConfig - разрешенные origins для браузерных запросов и /ws
+type CORSConfig struct {
+	AllowedOrigins   []string `json:"allowed_origins"`   // "https://*.example.com", "http://localhost:*", "*"
+	AdminOrigins     []string `json:"admin_origins"`     // пусто - как allowed_origins
+	AllowCredentials bool     `json:"allow_credentials"` // Access-Control-Allow-Credentials для разрешенных origins
+	MaxAge           Duration `json:"max_age"`           // кеширование предзапросов
+}
+
+// originPattern - шаблон origin: схема, хост с необязательным "*." в начале и порт или "*"
+type originPattern struct {
+	any       bool
+	literal   string // для "null"
+	scheme    string
+	host      string
+	subdomain bool // "*.example.com" - любой поддомен, но не сам example.com
+	port      string
+}
+
+// parseOriginPattern разбирает шаблон из конфигурации
+func parseOriginPattern(value string) (originPattern, error) {
+	switch value {
+	case "*":
+		return originPattern{any: true}, nil
+	case "null":
+		return originPattern{literal: value}, nil
+	}
+
+	scheme, rest, found := strings.Cut(value, "://")
+	if !found || (scheme != "http" && scheme != "https") {
+		return originPattern{}, fmt.Errorf("origin %q must start with http:// or https://", value)
+	}
+	if strings.ContainsAny(rest, "/?#") {
+		return originPattern{}, fmt.Errorf("origin %q must not contain a path", value)
+	}
+
+	host, port := rest, ""
+	if i := strings.LastIndex(rest, ":"); i >= 0 && !strings.HasSuffix(rest, "]") {
+		host, port = rest[:i], rest[i+1:]
+		if port != "*" {
+			if _, err := strconv.Atoi(port); err != nil {
+				return originPattern{}, fmt.Errorf("origin %q has invalid port", value)
+			}
+		}
+	}
+
+	pattern := originPattern{scheme: scheme, host: strings.ToLower(host), port: port}
+	if strings.HasPrefix(pattern.host, "*.") {
+		pattern.subdomain = true
+		pattern.host = pattern.host[1:] // ".example.com"
+	}
+	if pattern.host == "" || pattern.host == "." || strings.Contains(pattern.host, "*") {
+		return originPattern{}, fmt.Errorf("origin %q: wildcard is only allowed as the first label", value)
+	}
+	return pattern, nil
+}
+
+// match сравнивает origin запроса с шаблоном
+func (p originPattern) match(origin string) bool {
+	if p.any {
+		return true
+	}
+	if p.literal != "" {
+		return origin == p.literal
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Scheme != p.scheme || u.Path != "" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	if p.subdomain {
+		if !strings.HasSuffix(host, p.host) || len(host) == len(p.host) {
+			return false
+		}
+	} else if host != strings.Trim(p.host, "[]") {
+		return false
+	}
+	return p.port == "*" || u.Port() == p.port
+}
+
+// parseOriginPatterns разбирает список шаблонов
+func parseOriginPatterns(values []string) ([]originPattern, error) {
+	patterns := make([]originPattern, 0, len(values))
+	for _, value := range values {
+		pattern, err := parseOriginPattern(strings.TrimSpace(value))
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+var (
+	corsAllowed []originPattern
+	corsAdmins  []originPattern
+)
+
+// setupCORS компилирует шаблоны origins из конфигурации
+func setupCORS(c CORSConfig) error {
+	var err error
+	if corsAllowed, err = parseOriginPatterns(c.AllowedOrigins); err != nil {
+		return err
+	}
+	corsAdmins = corsAllowed
+	if len(c.AdminOrigins) > 0 {
+		if corsAdmins, err = parseOriginPatterns(c.AdminOrigins); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// originAllowed проверяет Origin запроса по политике. Запросы без Origin (не из браузера)
+// и со своего же хоста разрешены всегда
+func originAllowed(r *http.Request, policy string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || policy == corsPublic {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && u.Host == r.Host {
+		return true
+	}
+
+	patterns := corsAllowed
+	if policy == corsAdmin {
+		patterns = corsAdmins
+	}
+	for _, pattern := range patterns {
+		if pattern.match(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// rejectOrigin записывает отказ в журнал
+func rejectOrigin(r *http.Request, policy string) {
+	if policy == corsDefault {
+		policy = "default"
+	}
+	logHTTP.WarnContext(r.Context(), "запрос с неразрешенного origin отклонен",
+		"origin", r.Header.Get("Origin"), "path", r.URL.Path, "method", r.Method, "policy", policy, "client_ip", clientIP(r))
+}
+
+// checkWSOrigin - CheckOrigin для /ws с той же политикой, что и у API
+func checkWSOrigin(r *http.Request) bool {
+	if originAllowed(r, corsDefault) {
+		return true
+	}
+	rejectOrigin(r, corsDefault)
+	return false
+}
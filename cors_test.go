@@ -0,0 +1,75 @@
+package main
+
+import "testing"
+
+func TestParseOriginPatternErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"example.com",
+		"ftp://example.com",
+		"https://example.com/",
+		"https://example.com/app",
+		"https://example.com?x=1",
+		"https://example.com:http",
+		"https://*",
+		"https://*.",
+		"https://a.*.example.com",
+		"https://*example.com",
+	}
+	for _, value := range tests {
+		if _, err := parseOriginPattern(value); err == nil {
+			t.Errorf("parseOriginPattern(%q): expected error", value)
+		}
+	}
+}
+
+func TestOriginPatternMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		origin  string
+		want    bool
+	}{
+		{"*", "https://anything.test", true},
+		{"*", "null", true},
+
+		{"null", "null", true},
+		{"null", "https://example.com", false},
+
+		{"https://example.com", "https://example.com", true},
+		{"https://example.com", "https://EXAMPLE.com", true},
+		{"https://Example.COM", "https://example.com", true},
+		{"https://example.com", "http://example.com", false},
+		{"https://example.com", "https://example.com:8443", false},
+		{"https://example.com", "https://www.example.com", false},
+		{"https://example.com", "https://example.com.evil.test", false},
+		{"https://example.com", "https://example.com/path", false},
+		{"https://example.com", "null", false},
+
+		{"https://*.example.com", "https://app.example.com", true},
+		{"https://*.example.com", "https://a.b.example.com", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://evilexample.com", false},
+		{"https://*.example.com", "http://app.example.com", false},
+		{"https://*.example.com", "https://app.example.com:8443", false},
+
+		{"http://localhost:*", "http://localhost", true},
+		{"http://localhost:*", "http://localhost:3000", true},
+		{"http://localhost:*", "http://localhost.evil.test:3000", false},
+		{"http://localhost:3000", "http://localhost:3000", true},
+		{"http://localhost:3000", "http://localhost:3001", false},
+		{"http://localhost:3000", "http://localhost", false},
+
+		{"http://[::1]:8080", "http://[::1]:8080", true},
+		{"http://[::1]:8080", "http://[::1]:8081", false},
+		{"http://[::1]", "http://[::1]", true},
+	}
+	for _, tt := range tests {
+		pattern, err := parseOriginPattern(tt.pattern)
+		if err != nil {
+			t.Fatalf("parseOriginPattern(%q): %v", tt.pattern, err)
+		}
+		if got := pattern.match(tt.origin); got != tt.want {
+			t.Errorf("%q.match(%q) = %v, want %v", tt.pattern, tt.origin, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Файлы фронтенда, встроенные в бинарник
+//
+//go:embed index.html about.html presentation.html script.js style.css service-worker.js update-checker.js version.json
+var frontendFiles embed.FS
+
+// frontendAsset - подготовленный к отдаче файл фронтенда
+type frontendAsset struct {
+	content     []byte
+	contentType string
+	etag        string
+	fingerprint string
+}
+
+var (
+	frontendAssets  map[string]*frontendAsset
+	frontendModTime = time.Now()
+
+	// frontendBuild - общий отпечаток исходных файлов фронтенда; страница получает его
+	// в <meta name="app-version"> и сравнивает с версией сервера
+	frontendBuild string
+)
+
+// Ссылки на ресурсы в HTML, к которым добавляется отпечаток версии
+var assetRefPattern = regexp.MustCompile(`(src|href)="([A-Za-z0-9_.-]+\.(?:js|css|json))"`)
+
+// loadFrontend читает встроенные файлы, считает отпечатки и переписывает ссылки в HTML
+func loadFrontend() error {
+	entries, err := frontendFiles.ReadDir(".")
+	if err != nil {
+		return err
+	}
+
+	assets := make(map[string]*frontendAsset, len(entries))
+	build := sha256.New()
+	for _, entry := range entries {
+		content, err := frontendFiles.ReadFile(entry.Name())
+		if err != nil {
+			return err
+		}
+		assets[entry.Name()] = newFrontendAsset(entry.Name(), content)
+		build.Write([]byte(entry.Name()))
+		build.Write(content)
+	}
+	frontendBuild = hex.EncodeToString(build.Sum(nil))[:12]
+	versionMeta := []byte("<head>\n    <meta name=\"app-version\" content=\"" + frontendBuild + "\">")
+
+	// HTML ссылается на ресурсы с ?v=<отпечаток>, поэтому их можно кешировать навсегда
+	for name, asset := range assets {
+		if path.Ext(name) != ".html" {
+			continue
+		}
+		content := assetRefPattern.ReplaceAllFunc(asset.content, func(match []byte) []byte {
+			parts := assetRefPattern.FindSubmatch(match)
+			ref, exists := assets[string(parts[2])]
+			if !exists {
+				return match
+			}
+			return []byte(string(parts[1]) + `="` + string(parts[2]) + "?v=" + ref.fingerprint + `"`)
+		})
+		content = bytes.Replace(content, []byte("<head>"), versionMeta, 1)
+		assets[name] = newFrontendAsset(name, content)
+	}
+
+	frontendAssets = assets
+	return nil
+}
+
+func newFrontendAsset(name string, content []byte) *frontendAsset {
+	sum := sha256.Sum256(content)
+	fingerprint := hex.EncodeToString(sum[:])[:12]
+
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = http.DetectContentType(content)
+	}
+
+	return &frontendAsset{
+		content:     content,
+		contentType: contentType,
+		etag:        `"` + fingerprint + `"`,
+		fingerprint: fingerprint,
+	}
+}
+
+// Отдача встроенного фронтенда
+func frontendHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	if name == "" {
+		name = "index.html"
+	}
+
+	asset, exists := frontendAssets[name]
+	if !exists {
+		sendError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", asset.contentType)
+	w.Header().Set("ETag", asset.etag)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	switch {
+	case name == "service-worker.js" || path.Ext(name) == ".html":
+		// HTML и service worker всегда перепроверяются, чтобы подхватить новые отпечатки
+		w.Header().Set("Cache-Control", "no-cache")
+	case r.URL.Query().Get("v") == asset.fingerprint:
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	default:
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+
+	http.ServeContent(w, r, name, frontendModTime, bytes.NewReader(asset.content))
+}
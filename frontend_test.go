@@ -0,0 +1,166 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// useTestFrontend загружает встроенные файлы фронтенда
+func useTestFrontend(t *testing.T) {
+	t.Helper()
+	if err := loadFrontend(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func getFrontend(path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	frontendHandler(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestFrontendContentTypes(t *testing.T) {
+	useTestFrontend(t)
+
+	entries, err := frontendFiles.ReadDir(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantTypes := map[string]string{
+		".html": "text/html",
+		".css":  "text/css",
+		".js":   "javascript",
+		".json": "application/json",
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		ext := name[strings.LastIndex(name, "."):]
+		rec := getFrontend("/" + name)
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: status %d", name, rec.Code)
+			continue
+		}
+		if got := rec.Header().Get("Content-Type"); !strings.Contains(got, wantTypes[ext]) {
+			t.Errorf("%s: Content-Type %q, want %s", name, got, wantTypes[ext])
+		}
+		if rec.Header().Get("X-Content-Type-Options") != "nosniff" || rec.Header().Get("ETag") == "" {
+			t.Errorf("%s: headers %v", name, rec.Header())
+		}
+	}
+
+	if rec := getFrontend("/"); rec.Code != http.StatusOK || !strings.Contains(rec.Header().Get("Content-Type"), "text/html") {
+		t.Errorf("/: status %d, Content-Type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if rec := getFrontend("/missing.js"); rec.Code != http.StatusNotFound {
+		t.Errorf("/missing.js: status %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestFrontendCacheControl(t *testing.T) {
+	useTestFrontend(t)
+	const immutable = "public, max-age=31536000, immutable"
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"fingerprinted script", "/script.js?v=" + frontendAssets["script.js"].fingerprint, immutable},
+		{"fingerprinted style", "/style.css?v=" + frontendAssets["style.css"].fingerprint, immutable},
+		{"stale fingerprint", "/script.js?v=000000000000", "no-cache"},
+		{"another asset's fingerprint", "/script.js?v=" + frontendAssets["style.css"].fingerprint, "no-cache"},
+		{"no fingerprint", "/script.js", "no-cache"},
+		{"HTML with a matching fingerprint", "/index.html?v=" + frontendAssets["index.html"].fingerprint, "no-cache"},
+		{"root page", "/", "no-cache"},
+		{"service worker with a matching fingerprint", "/service-worker.js?v=" + frontendAssets["service-worker.js"].fingerprint, "no-cache"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getFrontend(tt.path).Header().Get("Cache-Control"); got != tt.want {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFrontendHTMLRewriting(t *testing.T) {
+	useTestFrontend(t)
+	body := getFrontend("/index.html").Body.String()
+
+	for _, name := range []string{"script.js", "update-checker.js"} {
+		want := `src="` + name + "?v=" + frontendAssets[name].fingerprint + `"`
+		if !strings.Contains(body, want) {
+			t.Errorf("index.html does not reference %s", want)
+		}
+	}
+	if strings.Contains(body, `src="script.js"`) {
+		t.Error("index.html still references script.js without a fingerprint")
+	}
+	if !strings.Contains(body, `src="https://cdn.jsdelivr.net/npm/chart.js"`) {
+		t.Error("external script reference was rewritten")
+	}
+	if !strings.Contains(body, `href="about.html"`) {
+		t.Error("page link was rewritten")
+	}
+	if want := `<meta name="app-version" content="` + frontendBuild + `">`; strings.Count(body, want) != 1 {
+		t.Errorf("index.html must contain %s once", want)
+	}
+	if len(frontendBuild) != 12 {
+		t.Errorf("frontendBuild = %q, want 12 hex characters", frontendBuild)
+	}
+}
+
+func TestFrontendMethods(t *testing.T) {
+	useTestFrontend(t)
+	tests := []struct {
+		method string
+		want   int
+	}{
+		{http.MethodGet, http.StatusOK},
+		{http.MethodHead, http.StatusOK},
+		{http.MethodPost, http.StatusMethodNotAllowed},
+		{http.MethodPut, http.StatusMethodNotAllowed},
+		{http.MethodDelete, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		frontendHandler(rec, httptest.NewRequest(tt.method, "/index.html", nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.method, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestFrontendBlockedInLocalMode(t *testing.T) {
+	useTestFrontend(t)
+	tests := []struct {
+		principal string
+		want      int
+	}{
+		{"anonymous", http.StatusNotFound},
+		{"trusted", http.StatusOK},
+		{roleViewer, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.principal, func(t *testing.T) {
+			useTestConfig(t)
+			useTestSessions(t)
+			useTestTrustedNetwork(t, "10.0.0.0/8")
+			useTestMode(t, modeLocal)
+			request := modeTestRequester(t, tt.principal)
+
+			for _, path := range []string{"/", "/index.html", "/script.js"} {
+				rec := httptest.NewRecorder()
+				withRequestID(checkModeMiddleware("", frontendHandler))(rec, request(http.MethodGet, path))
+				if rec.Code != tt.want {
+					t.Errorf("%s: status %d, want %d", path, rec.Code, tt.want)
+				}
+				if tt.want == http.StatusNotFound && strings.Contains(rec.Body.String(), frontendBuild) {
+					t.Errorf("%s: blocked response leaks the frontend", path)
+				}
+			}
+		})
+	}
+}
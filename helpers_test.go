@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// useTestConfig подменяет конфигурацию значениями по умолчанию с временным data_dir
+func useTestConfig(t *testing.T) {
+	t.Helper()
+	saved := cfg
+	cfg = defaultConfig()
+	cfg.DataDir = t.TempDir()
+	t.Cleanup(func() { cfg = saved })
+}
+
+// useTestSessions задает ключ подписи и пустой список отозванных сессий
+func useTestSessions(t *testing.T) {
+	t.Helper()
+	savedKey := sessionKey
+	sessionsMu.Lock()
+	savedState := sessions
+	sessions = sessionState{Revoked: map[string]time.Time{}, RevokedBefore: map[string]time.Time{}}
+	sessionsMu.Unlock()
+	sessionKey = []byte(strings.Repeat("k", 32))
+	t.Cleanup(func() {
+		sessionKey = savedKey
+		sessionsMu.Lock()
+		sessions = savedState
+		sessionsMu.Unlock()
+	})
+}
+
+// addTestAdmin добавляет учетную запись без медленного хеширования пароля
+func addTestAdmin(t *testing.T, name, role string) {
+	t.Helper()
+	admins.mu.Lock()
+	admins.accounts[name] = AdminAccount{Name: name, Role: role}
+	admins.mu.Unlock()
+	t.Cleanup(func() { removeTestAdmin(name) })
+}
+
+func removeTestAdmin(name string) {
+	admins.mu.Lock()
+	delete(admins.accounts, name)
+	admins.mu.Unlock()
+}
+
+// resetAuthAttempts очищает счетчики неудачных входов после теста
+func resetAuthAttempts(t *testing.T) {
+	t.Helper()
+	t.Cleanup(func() {
+		authMu.Lock()
+		authStates = make(map[string]*ipAuthState)
+		authGlobalFailures = nil
+		authGlobalLocked = time.Time{}
+		authAttempts = nil
+		authMu.Unlock()
+	})
+}
+
+// useTestAPIKeys подменяет хранилище API-ключей пустым
+func useTestAPIKeys(t *testing.T) {
+	t.Helper()
+	saved := apiKeys
+	apiKeys = &apiKeyStore{keys: make(map[string]*APIKey), saved: make(map[string]time.Time)}
+	t.Cleanup(func() { apiKeys = saved })
+}
+
+// logBuffer - потокобезопасный буфер для записей журнала
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// records разбирает накопленные JSON-записи
+func (b *logBuffer) records(t *testing.T) []map[string]interface{} {
+	t.Helper()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("log line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// captureLogs направляет журналы подсистем в JSON-буфер до конца теста
+func captureLogs(t *testing.T) *logBuffer {
+	t.Helper()
+	savedHTTP, savedWS, savedMode, savedDB := logHTTP, logWS, logMode, logDB
+	buf := new(logBuffer)
+	base := slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+	logHTTP = newSubsystemLogger(base, subsystemHTTP)
+	logWS = newSubsystemLogger(base, subsystemWS)
+	logMode = newSubsystemLogger(base, subsystemMode)
+	logDB = newSubsystemLogger(base, subsystemDB)
+	t.Cleanup(func() { logHTTP, logWS, logMode, logDB = savedHTTP, savedWS, savedMode, savedDB })
+	return buf
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Сколько последних смен режима хранится в журнале
+const maxModeHistory = 1000
+
+// Источники смены режима
+const (
+	modeSourceAPI      = "api"      // POST /admin/mode
+	modeSourceGrace    = "grace"    // после отсрочки
+	modeSourceSchedule = "schedule" // по расписанию
+	modeSourceRevert   = "revert"   // автоматический возврат после TTL
+	modeSourceRestart  = "restart"  // перезапуск сервера сбросил режим
+)
+
+// ModeTransition - запись журнала смен режима
+type ModeTransition struct {
+	Time      time.Time `json:"time"`
+	OldMode   string    `json:"old_mode"`
+	NewMode   string    `json:"new_mode"`
+	ChangedBy string    `json:"changed_by"`
+	Source    string    `json:"source"`
+	Reason    string    `json:"reason,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+	Clients   int       `json:"clients"` // подключенных клиентов в момент смены
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+var (
+	modeHistoryMu sync.Mutex
+	modeHistory   []ModeTransition
+)
+
+// recordModeTransition добавляет запись в журнал и сохраняет его
+func recordModeTransition(transition ModeTransition) {
+	modeHistoryMu.Lock()
+	defer modeHistoryMu.Unlock()
+	modeHistory = append(modeHistory, transition)
+	if len(modeHistory) > maxModeHistory {
+		modeHistory = modeHistory[len(modeHistory)-maxModeHistory:]
+	}
+	if err := saveJSONFile(dataPath("mode_history.json"), modeHistory); err != nil {
+		logMode.Error("ошибка сохранения журнала режима", "error", err)
+	}
+}
+
+// loadModeHistory загружает журнал при старте. Режим не переживает перезапуск,
+// поэтому возврат к режиму по умолчанию тоже записывается в журнал
+func loadModeHistory() error {
+	modeHistoryMu.Lock()
+	found, err := loadJSONFile(dataPath("mode_history.json"), &modeHistory)
+	var last ModeTransition
+	if len(modeHistory) > 0 {
+		last = modeHistory[len(modeHistory)-1]
+	}
+	modeHistoryMu.Unlock()
+	if err != nil || !found {
+		return err
+	}
+
+	if current := currentModeState().Mode; last.NewMode != "" && last.NewMode != current {
+		recordModeTransition(ModeTransition{
+			Time:      time.Now().UTC(),
+			OldMode:   last.NewMode,
+			NewMode:   current,
+			ChangedBy: "system",
+			Source:    modeSourceRestart,
+			Reason:    "перезапуск сервера",
+		})
+	}
+	return nil
+}
+
+// GET /api/v1/admin/mode/history
+func apiModeHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := 100
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			sendError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = n
+	}
+	var since, until time.Time
+	for name, target := range map[string]*time.Time{"since": &since, "until": &until} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				sendError(w, http.StatusBadRequest, name+" must be an RFC 3339 time")
+				return
+			}
+			*target = parsed
+		}
+	}
+	modeFilter := query.Get("mode")
+	adminFilter := query.Get("changed_by")
+	sourceFilter := query.Get("source")
+
+	modeHistoryMu.Lock()
+	history := make([]ModeTransition, 0, min(limit, len(modeHistory)))
+	for i := len(modeHistory) - 1; i >= 0 && len(history) < limit; i-- {
+		transition := modeHistory[i]
+		if modeFilter != "" && transition.NewMode != modeFilter && transition.OldMode != modeFilter {
+			continue
+		}
+		if adminFilter != "" && transition.ChangedBy != adminFilter {
+			continue
+		}
+		if sourceFilter != "" && transition.Source != sourceFilter {
+			continue
+		}
+		if !since.IsZero() && transition.Time.Before(since) {
+			continue
+		}
+		if !until.IsZero() && transition.Time.After(until) {
+			continue
+		}
+		history = append(history, transition)
+	}
+	total := len(modeHistory)
+	modeHistoryMu.Unlock()
+
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"history": history,
+		"count":   len(history),
+		"total":   total,
+	})
+}
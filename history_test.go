@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// useTestModeHistory подменяет журнал смен режима; записи идут от старых к новым
+func useTestModeHistory(t *testing.T, transitions ...ModeTransition) {
+	t.Helper()
+	modeHistoryMu.Lock()
+	saved := modeHistory
+	modeHistory = transitions
+	modeHistoryMu.Unlock()
+	t.Cleanup(func() {
+		modeHistoryMu.Lock()
+		modeHistory = saved
+		modeHistoryMu.Unlock()
+	})
+}
+
+func TestModeHistoryHandler(t *testing.T) {
+	start := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	at := func(hours int) time.Time { return start.Add(time.Duration(hours) * time.Hour) }
+	useTestModeHistory(t,
+		ModeTransition{Time: at(0), OldMode: modeServer, NewMode: modeLocal, ChangedBy: "alice", Source: modeSourceAPI},
+		ModeTransition{Time: at(1), OldMode: modeLocal, NewMode: modeServer, ChangedBy: "schedule:abc", Source: modeSourceRevert},
+		ModeTransition{Time: at(2), OldMode: modeServer, NewMode: modeMaintenance, ChangedBy: "bob", Source: modeSourceGrace},
+		ModeTransition{Time: at(3), OldMode: modeMaintenance, NewMode: modeServer, ChangedBy: "alice", Source: modeSourceAPI},
+		ModeTransition{Time: at(4), OldMode: modeServer, NewMode: modeServer, ChangedBy: "system", Source: modeSourceRestart},
+	)
+
+	tests := []struct {
+		name   string
+		query  url.Values
+		status int
+		want   []int // часы записей в ответе, от новых к старым
+	}{
+		{"all, newest first", nil, http.StatusOK, []int{4, 3, 2, 1, 0}},
+		{"since is inclusive", url.Values{"since": {at(3).Format(time.RFC3339)}}, http.StatusOK, []int{4, 3}},
+		{"until is inclusive", url.Values{"until": {at(1).Format(time.RFC3339)}}, http.StatusOK, []int{1, 0}},
+		{"since and until", url.Values{"since": {at(1).Format(time.RFC3339)}, "until": {at(2).Format(time.RFC3339)}}, http.StatusOK, []int{2, 1}},
+		{"changed_by", url.Values{"changed_by": {"alice"}}, http.StatusOK, []int{3, 0}},
+		{"changed_by is exact", url.Values{"changed_by": {"ali"}}, http.StatusOK, []int{}},
+		{"mode matches old or new", url.Values{"mode": {modeMaintenance}}, http.StatusOK, []int{3, 2}},
+		{"source", url.Values{"source": {modeSourceAPI}}, http.StatusOK, []int{3, 0}},
+		{"filters combine", url.Values{"changed_by": {"alice"}, "mode": {modeLocal}}, http.StatusOK, []int{0}},
+		{"limit keeps the newest", url.Values{"limit": {"2"}}, http.StatusOK, []int{4, 3}},
+		{"limit applies after filters", url.Values{"limit": {"1"}, "source": {modeSourceAPI}}, http.StatusOK, []int{3}},
+		{"limit above total", url.Values{"limit": {"1000000"}}, http.StatusOK, []int{4, 3, 2, 1, 0}},
+		{"zero limit", url.Values{"limit": {"0"}}, http.StatusBadRequest, nil},
+		{"negative limit", url.Values{"limit": {"-1"}}, http.StatusBadRequest, nil},
+		{"non-numeric limit", url.Values{"limit": {"ten"}}, http.StatusBadRequest, nil},
+		{"bad since", url.Values{"since": {"yesterday"}}, http.StatusBadRequest, nil},
+		{"bad until", url.Values{"until": {"2026-10-19"}}, http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			apiModeHistoryHandler(rec, httptest.NewRequest(http.MethodGet, "/api/v1/admin/mode/history?"+tt.query.Encode(), nil))
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var body struct {
+				History []ModeTransition `json:"history"`
+				Count   int              `json:"count"`
+				Total   int              `json:"total"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			got := make([]int, 0, len(body.History))
+			for _, transition := range body.History {
+				got = append(got, int(transition.Time.Sub(start).Hours()))
+			}
+			if len(got) != len(tt.want) || body.Count != len(tt.want) || body.Total != 5 {
+				t.Fatalf("history hours %v (count %d, total %d), want %v", got, body.Count, body.Total, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("history hours %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
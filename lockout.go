@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Сколько последних попыток входа хранится в журнале
+const maxAuthAttempts = 1000
+
+// Результаты попыток административного входа
+const (
+	authResultSuccess = "success"
+	authResultFailure = "failure"
+	authResultLocked  = "locked"
+)
+
+// LockoutConfig - блокировка после неудачных попыток административного входа
+type LockoutConfig struct {
+	MaxFailures       int      `json:"max_failures"`        // неудач с одного IP до первой блокировки
+	BaseDuration      Duration `json:"base_duration"`       // первая блокировка, далее удваивается
+	MaxDuration       Duration `json:"max_duration"`        // предел блокировки; после него счетчик IP забывается
+	GlobalMaxFailures int      `json:"global_max_failures"` // неудач со всех IP за global_window до общей блокировки
+	GlobalWindow      Duration `json:"global_window"`
+	GlobalDuration    Duration `json:"global_duration"`
+}
+
+// AuthAttempt - запись журнала административных входов
+type AuthAttempt struct {
+	Time      time.Time `json:"time"`
+	IP        string    `json:"ip"`
+	Method    string    `json:"method"` // header_token, header_password, body_password, session, refresh, api_key
+	Admin     string    `json:"admin,omitempty"`
+	Path      string    `json:"path"`
+	Result    string    `json:"result"`
+	Failures  int       `json:"failures"` // неудач подряд с этого IP после попытки
+	RequestID string    `json:"request_id,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+}
+
+// ipAuthState - неудачные попытки одного IP
+type ipAuthState struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+var (
+	authMu             sync.Mutex
+	authStates         = make(map[string]*ipAuthState)
+	authGlobalFailures []time.Time
+	authGlobalLocked   time.Time
+	authAttempts       []AuthAttempt
+)
+
+// authLockedFor возвращает оставшееся время блокировки IP (или общей блокировки)
+func authLockedFor(ip string) time.Duration {
+	authMu.Lock()
+	defer authMu.Unlock()
+
+	now := time.Now()
+	until := authGlobalLocked
+	if state, exists := authStates[ip]; exists && state.lockedUntil.After(until) {
+		until = state.lockedUntil
+	}
+	if until.After(now) {
+		return until.Sub(now)
+	}
+	return 0
+}
+
+// lockoutDuration - длительность блокировки после failures неудач подряд:
+// base, 2*base, 4*base, ... но не больше max
+func lockoutDuration(failures int) time.Duration {
+	exponent := failures - cfg.Lockout.MaxFailures
+	if exponent < 0 {
+		return 0
+	}
+	d := float64(cfg.Lockout.BaseDuration.Duration) * math.Pow(2, float64(exponent))
+	if d > float64(cfg.Lockout.MaxDuration.Duration) {
+		return cfg.Lockout.MaxDuration.Duration
+	}
+	return time.Duration(d)
+}
+
+// recordAuthAttempt учитывает попытку входа, блокирует IP после серии неудач
+// и оповещает подключенных администраторов о блокировке
+func recordAuthAttempt(r *http.Request, method, admin, result string) {
+	now := time.Now()
+	ip := clientIP(r)
+	requestID := requestIDFrom(r.Context())
+
+	authMu.Lock()
+	state, exists := authStates[ip]
+	if !exists {
+		state = &ipAuthState{}
+		authStates[ip] = state
+	}
+	// Давние неудачи забываются
+	if state.failures > 0 && now.Sub(state.lastFailure) > cfg.Lockout.MaxDuration.Duration && now.After(state.lockedUntil) {
+		state.failures = 0
+	}
+
+	var alerts []map[string]interface{}
+	switch result {
+	case authResultSuccess:
+		// Успешный вход по заголовку повторяется в каждом запросе, поэтому в журнал
+		// попадает только вход по паролю и первый успех после неудач
+		if state.failures == 0 && method != "body_password" {
+			delete(authStates, ip)
+			authMu.Unlock()
+			return
+		}
+		delete(authStates, ip)
+		state = &ipAuthState{}
+
+	case authResultFailure:
+		state.failures++
+		state.lastFailure = now
+		if d := lockoutDuration(state.failures); d > 0 {
+			state.lockedUntil = now.Add(d)
+			alerts = append(alerts, map[string]interface{}{
+				"scope":    "ip",
+				"ip":       ip,
+				"failures": state.failures,
+				"until":    state.lockedUntil.Unix(),
+				"seconds":  int(d.Seconds()),
+			})
+		}
+
+		// Общий счетчик защищает от перебора с множества адресов
+		cutoff := now.Add(-cfg.Lockout.GlobalWindow.Duration)
+		kept := authGlobalFailures[:0]
+		for _, t := range authGlobalFailures {
+			if t.After(cutoff) {
+				kept = append(kept, t)
+			}
+		}
+		authGlobalFailures = append(kept, now)
+		if cfg.Lockout.GlobalMaxFailures > 0 && len(authGlobalFailures) >= cfg.Lockout.GlobalMaxFailures && now.After(authGlobalLocked) {
+			authGlobalLocked = now.Add(cfg.Lockout.GlobalDuration.Duration)
+			authGlobalFailures = nil
+			alerts = append(alerts, map[string]interface{}{
+				"scope":   "global",
+				"until":   authGlobalLocked.Unix(),
+				"seconds": int(cfg.Lockout.GlobalDuration.Seconds()),
+			})
+		}
+	}
+
+	authAttempts = append(authAttempts, AuthAttempt{
+		Time:      now,
+		IP:        ip,
+		Method:    method,
+		Admin:     admin,
+		Path:      r.URL.Path,
+		Result:    result,
+		Failures:  state.failures,
+		RequestID: requestID,
+		UserAgent: r.UserAgent(),
+	})
+	if len(authAttempts) > maxAuthAttempts {
+		authAttempts = authAttempts[len(authAttempts)-maxAuthAttempts:]
+	}
+	failures := state.failures
+	authMu.Unlock()
+
+	if result != authResultSuccess {
+		logHTTP.WarnContext(r.Context(), "неудачная попытка административного входа",
+			"client_ip", ip, "method", method, "admin", admin, "result", result, "failures", failures)
+	}
+	for _, alert := range alerts {
+		logHTTP.WarnContext(r.Context(), "административный вход заблокирован", "scope", alert["scope"], "ip", ip, "seconds", alert["seconds"])
+		broadcastToAdmins("admin_lockout", alert)
+	}
+}
+
+// pruneAuthStates забывает IP, чья блокировка истекла, а последняя неудача старше max_duration:
+// такой счетчик все равно обнулился бы при следующей попытке
+func pruneAuthStates(now time.Time) int {
+	authMu.Lock()
+	defer authMu.Unlock()
+
+	pruned := 0
+	for ip, state := range authStates {
+		if now.After(state.lockedUntil) && now.Sub(state.lastFailure) > cfg.Lockout.MaxDuration.Duration {
+			delete(authStates, ip)
+			pruned++
+		}
+	}
+	return pruned
+}
+
+// startAuthStateCleanup периодически удаляет счетчики неудач, иначе перебор
+// с меняющихся адресов раздувает authStates без ограничений
+func startAuthStateCleanup(ctx context.Context) {
+	ticker := time.NewTicker(cfg.CleanupInterval.Duration)
+	backgroundWG.Add(1)
+	go func() {
+		defer backgroundWG.Done()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if pruned := pruneAuthStates(time.Now()); pruned > 0 {
+					logHTTP.Debug("очищены счетчики неудачных входов", "count", pruned)
+				}
+			}
+		}
+	}()
+}
+
+// denyAdmin отвечает 429 во время блокировки и 401 в остальных случаях
+func denyAdmin(w http.ResponseWriter, r *http.Request) {
+	if wait := authLockedFor(clientIP(r)); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		sendError(w, http.StatusTooManyRequests, "Too many failed admin attempts, try again later")
+		return
+	}
+	sendError(w, http.StatusUnauthorized, "Admin access required")
+}
+
+// lockedIP - текущая блокировка адреса
+type lockedIP struct {
+	IP       string    `json:"ip"`
+	Failures int       `json:"failures"`
+	Until    time.Time `json:"until"`
+}
+
+// Журнал попыток административного входа
+func apiAuthAttemptsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	query := r.URL.Query()
+	limit := 100
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			sendError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = n
+	}
+	ipFilter := query.Get("ip")
+	resultFilter := query.Get("result")
+
+	sendJSON(w, http.StatusOK, authAttemptsReport(min(limit, maxAuthAttempts), ipFilter, resultFilter))
+}
+
+// authAttemptsReport собирает последние попытки входа и текущие блокировки
+func authAttemptsReport(limit int, ipFilter, resultFilter string) map[string]interface{} {
+	authMu.Lock()
+	defer authMu.Unlock()
+
+	now := time.Now()
+	attempts := make([]AuthAttempt, 0, min(limit, len(authAttempts)))
+	for i := len(authAttempts) - 1; i >= 0 && len(attempts) < limit; i-- {
+		attempt := authAttempts[i]
+		if ipFilter != "" && attempt.IP != ipFilter {
+			continue
+		}
+		if resultFilter != "" && attempt.Result != resultFilter {
+			continue
+		}
+		attempts = append(attempts, attempt)
+	}
+	locked := make([]lockedIP, 0)
+	for ip, state := range authStates {
+		if state.lockedUntil.After(now) {
+			locked = append(locked, lockedIP{IP: ip, Failures: state.failures, Until: state.lockedUntil})
+		}
+	}
+	response := map[string]interface{}{
+		"attempts":        attempts,
+		"locked":          locked,
+		"global_failures": len(authGlobalFailures),
+	}
+	if authGlobalLocked.After(now) {
+		response["global_locked_until"] = authGlobalLocked
+	}
+	return response
+}
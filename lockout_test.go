@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLockoutDuration(t *testing.T) {
+	saved := cfg
+	t.Cleanup(func() { cfg = saved })
+	cfg.Lockout = LockoutConfig{
+		MaxFailures:  5,
+		BaseDuration: Duration{30 * time.Second},
+		MaxDuration:  Duration{5 * time.Minute},
+	}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{4, 0},
+		{5, 30 * time.Second},
+		{6, time.Minute},
+		{7, 2 * time.Minute},
+		{8, 4 * time.Minute},
+		{9, 5 * time.Minute},
+		{1000, 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := lockoutDuration(tt.failures); got != tt.want {
+			t.Errorf("lockoutDuration(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestAuthAttemptsHandlerLimit(t *testing.T) {
+	authMu.Lock()
+	saved := authAttempts
+	authAttempts = []AuthAttempt{
+		{IP: "10.0.0.1", Result: authResultFailure},
+		{IP: "10.0.0.2", Result: authResultSuccess},
+		{IP: "10.0.0.1", Result: authResultFailure},
+	}
+	authMu.Unlock()
+	t.Cleanup(func() {
+		authMu.Lock()
+		authAttempts = saved
+		authMu.Unlock()
+	})
+
+	tests := []struct {
+		query  string
+		status int
+		count  int
+	}{
+		{"", http.StatusOK, 3},
+		{"?limit=1", http.StatusOK, 1},
+		{"?limit=100000000000000", http.StatusOK, 3},
+		{"?limit=9223372036854775807", http.StatusOK, 3},
+		{"?ip=10.0.0.1&limit=5", http.StatusOK, 2},
+		{"?limit=0", http.StatusBadRequest, 0},
+		{"?limit=abc", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		apiAuthAttemptsHandler(rec, httptest.NewRequest(http.MethodGet, "/api/v1/admin/auth/attempts"+tt.query, nil))
+		if rec.Code != tt.status {
+			t.Errorf("%q: status %d, want %d", tt.query, rec.Code, tt.status)
+			continue
+		}
+		if tt.status == http.StatusOK {
+			var body struct {
+				Attempts []AuthAttempt `json:"attempts"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("%q: %v", tt.query, err)
+			}
+			if len(body.Attempts) != tt.count {
+				t.Errorf("%q: %d attempts, want %d", tt.query, len(body.Attempts), tt.count)
+			}
+		}
+		if !authMu.TryLock() {
+			t.Fatalf("%q: authMu left locked", tt.query)
+		}
+		authMu.Unlock()
+	}
+}
+
+func TestLockoutGatesOnlyGuessableSecrets(t *testing.T) {
+	locks := []struct {
+		name string
+		lock func(ip string)
+	}{
+		{"global", func(string) { authGlobalLocked = time.Now().Add(time.Hour) }},
+		{"ip", func(ip string) {
+			authStates[ip] = &ipAuthState{failures: 100, lastFailure: time.Now(), lockedUntil: time.Now().Add(time.Hour)}
+		}},
+	}
+	for _, lock := range locks {
+		t.Run(lock.name, func(t *testing.T) {
+			useTestConfig(t)
+			useTestSessions(t)
+			useTestAPIKeys(t)
+			resetAuthAttempts(t)
+			addTestAdmin(t, "alice", roleAdmin)
+			cfg.AdminToken = strings.Repeat("t", minAdminTokenLength)
+
+			session := issueSession("alice").AccessToken
+			apiKey, _, err := apiKeys.Create("ci", []string{permUsersRead}, nil, "alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			probe := httptest.NewRequest(http.MethodGet, "/api/v1/clients", nil)
+			ip, _, _ := net.SplitHostPort(probe.RemoteAddr)
+			authMu.Lock()
+			lock.lock(ip)
+			authMu.Unlock()
+
+			tests := []struct {
+				name    string
+				headers map[string]string
+				ok      bool
+				result  string // запись журнала; пусто - попытка не записывается
+			}{
+				{"valid session", map[string]string{"Authorization": "Bearer " + session}, true, ""},
+				{"valid api key", map[string]string{"Authorization": "Bearer " + apiKey}, true, ""},
+				{"forged session", map[string]string{"Authorization": "Bearer " + session[:len(session)-2]}, false, authResultFailure},
+				{"static token", map[string]string{"X-Admin-Token": cfg.AdminToken}, false, authResultLocked},
+				{"password", map[string]string{"X-Admin-User": "alice", "X-Admin-Password": "secret"}, false, authResultLocked},
+			}
+			for _, tt := range tests {
+				r := httptest.NewRequest(http.MethodGet, "/api/v1/clients", nil)
+				for name, value := range tt.headers {
+					r.Header.Set(name, value)
+				}
+				authMu.Lock()
+				before := len(authAttempts)
+				authMu.Unlock()
+
+				if _, ok := authenticateThroughMiddleware(r); ok != tt.ok {
+					t.Errorf("%s: authenticated = %v, want %v", tt.name, ok, tt.ok)
+				}
+
+				authMu.Lock()
+				var result string
+				if len(authAttempts) > before {
+					result = authAttempts[len(authAttempts)-1].Result
+				}
+				authMu.Unlock()
+				if result != tt.result {
+					t.Errorf("%s: recorded %q, want %q", tt.name, result, tt.result)
+				}
+			}
+		})
+	}
+}
+
+func TestPruneAuthStates(t *testing.T) {
+	useTestConfig(t)
+	resetAuthAttempts(t)
+	cfg.Lockout.MaxDuration = Duration{5 * time.Minute}
+	now := time.Now()
+
+	states := map[string]struct {
+		state ipAuthState
+		kept  bool
+	}{
+		"recent failure":          {ipAuthState{failures: 2, lastFailure: now.Add(-time.Minute)}, true},
+		"still locked":            {ipAuthState{failures: 9, lastFailure: now.Add(-time.Hour), lockedUntil: now.Add(time.Minute)}, true},
+		"stale failure":           {ipAuthState{failures: 2, lastFailure: now.Add(-10 * time.Minute)}, false},
+		"expired lock, stale":     {ipAuthState{failures: 9, lastFailure: now.Add(-10 * time.Minute), lockedUntil: now.Add(-time.Minute)}, false},
+		"expired lock, not stale": {ipAuthState{failures: 9, lastFailure: now.Add(-4 * time.Minute), lockedUntil: now.Add(-time.Second)}, true},
+	}
+	authMu.Lock()
+	for ip, tt := range states {
+		state := tt.state
+		authStates[ip] = &state
+	}
+	authMu.Unlock()
+
+	if got := pruneAuthStates(now); got != 2 {
+		t.Errorf("pruneAuthStates = %d, want 2", got)
+	}
+	authMu.Lock()
+	defer authMu.Unlock()
+	for ip, tt := range states {
+		if _, exists := authStates[ip]; exists != tt.kept {
+			t.Errorf("%s: kept = %v, want %v", ip, exists, tt.kept)
+		}
+	}
+}
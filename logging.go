@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// Подсистемы журнала с независимыми уровнями
+const (
+	subsystemHTTP = "http"
+	subsystemWS   = "ws"
+	subsystemMode = "mode"
+	subsystemDB   = "db"
+)
+
+var logLevels = map[string]*slog.LevelVar{
+	subsystemHTTP: new(slog.LevelVar),
+	subsystemWS:   new(slog.LevelVar),
+	subsystemMode: new(slog.LevelVar),
+	subsystemDB:   new(slog.LevelVar),
+}
+
+// Логгеры подсистем; до setupLogging пишут текстом в stderr
+var (
+	logHTTP = newSubsystemLogger(slog.NewTextHandler(os.Stderr, nil), subsystemHTTP)
+	logWS   = newSubsystemLogger(slog.NewTextHandler(os.Stderr, nil), subsystemWS)
+	logMode = newSubsystemLogger(slog.NewTextHandler(os.Stderr, nil), subsystemMode)
+	logDB   = newSubsystemLogger(slog.NewTextHandler(os.Stderr, nil), subsystemDB)
+)
+
+// logFile - файл журнала, если журнал пишется не в stdout; закрывается при остановке
+var logFile *rotatingFile
+
+// setupLogging настраивает логгеры подсистем
+func setupLogging(opts LogConfig) error {
+	var out io.Writer = os.Stdout
+	var file *rotatingFile
+	if opts.File != "" {
+		var err error
+		file, err = newRotatingFile(opts.File, int64(opts.MaxSizeMB)*1024*1024, opts.MaxBackups)
+		if err != nil {
+			return err
+		}
+		out = file
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	var base slog.Handler
+	switch opts.Format {
+	case "", "text":
+		base = slog.NewTextHandler(out, handlerOpts)
+	case "json":
+		base = slog.NewJSONHandler(out, handlerOpts)
+	default:
+		if file != nil {
+			file.Close()
+		}
+		return fmt.Errorf("unknown log format %q", opts.Format)
+	}
+
+	for name, levelVar := range logLevels {
+		value := opts.Levels[name]
+		if value == "" {
+			value = opts.Level
+		}
+		if value == "" {
+			value = "info"
+		}
+		if err := levelVar.UnmarshalText([]byte(value)); err != nil {
+			if file != nil {
+				file.Close()
+			}
+			return fmt.Errorf("log level for %s: %w", name, err)
+		}
+	}
+
+	logHTTP = newSubsystemLogger(base, subsystemHTTP)
+	logWS = newSubsystemLogger(base, subsystemWS)
+	logMode = newSubsystemLogger(base, subsystemMode)
+	logDB = newSubsystemLogger(base, subsystemDB)
+	slog.SetDefault(newSubsystemLogger(base, subsystemHTTP))
+	logFile = file
+	return nil
+}
+
+// closeLogFile сбрасывает и закрывает файл журнала; записи после этого отбрасываются
+func closeLogFile() {
+	if logFile == nil {
+		return
+	}
+	if err := logFile.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "ошибка закрытия журнала: %v\n", err)
+	}
+}
+
+func newSubsystemLogger(base slog.Handler, name string) *slog.Logger {
+	handler := base.WithAttrs([]slog.Attr{slog.String("subsystem", name)})
+	return slog.New(&subsystemHandler{level: logLevels[name], inner: handler})
+}
+
+// subsystemHandler фильтрует записи по уровню подсистемы и добавляет request_id из контекста
+type subsystemHandler struct {
+	level *slog.LevelVar
+	inner slog.Handler
+}
+
+func (h *subsystemHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *subsystemHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := requestIDFrom(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	return h.inner.Handle(ctx, record)
+}
+
+func (h *subsystemHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &subsystemHandler{level: h.level, inner: h.inner.WithAttrs(attrs)}
+}
+
+func (h *subsystemHandler) WithGroup(name string) slog.Handler {
+	return &subsystemHandler{level: h.level, inner: h.inner.WithGroup(name)}
+}
+
+// Идентификатор запроса в контексте
+type requestIDKey struct{}
+
+func withRequestIDContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+func requestIDFrom(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// rotatingFile - файл журнала с ротацией по размеру
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func newRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	rf := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+	file, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	rf.file = file
+	rf.size = info.Size()
+	return nil
+}
+
+// rotate сдвигает архивы: log.1 -> log.2 и т.д., текущий файл становится log.1.
+// Если перенос не удался, запись продолжается в прежний файл; если его не удалось
+// и переоткрыть, файл считается закрытым, и Write возвращает os.ErrClosed, а не
+// ошибку закрытого дескриптора
+func (rf *rotatingFile) rotate() error {
+	err := rf.file.Close()
+	if err == nil {
+		err = rf.moveToBackup()
+	}
+	if err != nil {
+		if reopenErr := rf.open(); reopenErr != nil {
+			rf.file = nil
+		}
+		return err
+	}
+	return rf.open()
+}
+
+// moveToBackup сдвигает резервные копии и переименовывает текущий файл в первую из них
+func (rf *rotatingFile) moveToBackup() error {
+	if rf.maxBackups == 0 {
+		return os.Remove(rf.path)
+	}
+	os.Remove(fmt.Sprintf("%s.%d", rf.path, rf.maxBackups))
+	for i := rf.maxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", rf.path, i), fmt.Sprintf("%s.%d", rf.path, i+1))
+	}
+	return os.Rename(rf.path, rf.path+".1")
+}
+
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if rf.maxSize > 0 && rf.size+int64(len(p)) > rf.maxSize && rf.size > 0 {
+		// Запись, не попавшая в новый файл, дописывается в прежний: следующая запись
+		// повторит ротацию
+		if err := rf.rotate(); err != nil && rf.file == nil {
+			return 0, err
+		}
+	}
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// Close сбрасывает файл на диск и закрывает его
+func (rf *rotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.file == nil {
+		return nil
+	}
+	err := rf.file.Sync()
+	if closeErr := rf.file.Close(); err == nil {
+		err = closeErr
+	}
+	rf.file = nil
+	return err
+}
+
+// Просмотр и изменение уровней журнала во время работы (audit:read / settings:write)
+func apiLogLevelsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+
+	case http.MethodPut, http.MethodPost:
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			sendError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+
+		// Сначала проверяем все значения, чтобы не применить изменения частично
+		levels := make(map[string]slog.Level, len(body))
+		for name, value := range body {
+			if _, exists := logLevels[name]; !exists {
+				sendError(w, http.StatusBadRequest, "Unknown subsystem: "+name)
+				return
+			}
+			var level slog.Level
+			if err := level.UnmarshalText([]byte(value)); err != nil {
+				sendError(w, http.StatusBadRequest, "Invalid level for "+name)
+				return
+			}
+			levels[name] = level
+		}
+		for name, level := range levels {
+			logLevels[name].Set(level)
+			logHTTP.InfoContext(r.Context(), "уровень журнала изменен", "target", name, "level", level.String())
+		}
+
+	default:
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	current := make(map[string]string, len(logLevels))
+	for name, levelVar := range logLevels {
+		current[name] = levelVar.Level().String()
+	}
+	sendJSON(w, http.StatusOK, current)
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useTestLogLevels восстанавливает уровни и логгеры подсистем после теста
+func useTestLogLevels(t *testing.T) {
+	t.Helper()
+	saved := make(map[string]slog.Level, len(logLevels))
+	for name, levelVar := range logLevels {
+		saved[name] = levelVar.Level()
+	}
+	savedHTTP, savedWS, savedMode, savedDB := logHTTP, logWS, logMode, logDB
+	savedDefault, savedFile := slog.Default(), logFile
+	t.Cleanup(func() {
+		closeLogFile()
+		for name, level := range saved {
+			logLevels[name].Set(level)
+		}
+		logHTTP, logWS, logMode, logDB = savedHTTP, savedWS, savedMode, savedDB
+		slog.SetDefault(savedDefault)
+		logFile = savedFile
+	})
+}
+
+func TestRotatingFile(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxBackups int
+		writes     []string
+		files      map[string]string // содержимое файлов после записи; "" - файла нет
+	}{
+		{
+			name:       "no rotation below the limit",
+			maxBackups: 2,
+			writes:     []string{"aaaa\n", "bbbb\n"},
+			files:      map[string]string{"app.log": "aaaa\nbbbb\n", "app.log.1": ""},
+		},
+		{
+			name:       "backups shift and the oldest is dropped",
+			maxBackups: 2,
+			writes:     []string{"aaaaaaaa\n", "bbbbbbbb\n", "cccccccc\n", "dddddddd\n"},
+			files: map[string]string{
+				"app.log":   "dddddddd\n",
+				"app.log.1": "cccccccc\n",
+				"app.log.2": "bbbbbbbb\n",
+				"app.log.3": "",
+			},
+		},
+		{
+			name:       "without backups the file is truncated",
+			maxBackups: 0,
+			writes:     []string{"aaaaaaaa\n", "bbbbbbbb\n"},
+			files:      map[string]string{"app.log": "bbbbbbbb\n", "app.log.1": ""},
+		},
+		{
+			name:       "oversized record is written whole",
+			maxBackups: 1,
+			writes:     []string{strings.Repeat("x", 30) + "\n"},
+			files:      map[string]string{"app.log": strings.Repeat("x", 30) + "\n", "app.log.1": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			rf, err := newRotatingFile(filepath.Join(dir, "app.log"), 16, tt.maxBackups)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, line := range tt.writes {
+				if _, err := rf.Write([]byte(line)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := rf.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			for name, want := range tt.files {
+				data, err := os.ReadFile(filepath.Join(dir, name))
+				if want == "" {
+					if !errors.Is(err, os.ErrNotExist) {
+						t.Errorf("%s exists: %q", name, data)
+					}
+					continue
+				}
+				if err != nil || string(data) != want {
+					t.Errorf("%s = %q, %v; want %q", name, data, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRotatingFileAppendsAndClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte("0123456789"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rf, err := newRotatingFile(path, 16, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Размер существующего файла учитывается: запись не помещается и вызывает ротацию
+	rf.Write([]byte("abcdefgh"))
+	if err := rf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path + ".1"); string(data) != "0123456789" {
+		t.Errorf("backup = %q, want the previous contents", data)
+	}
+	if _, err := rf.Write([]byte("late")); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Write after Close = %v, want %v", err, os.ErrClosed)
+	}
+	if err := rf.Close(); err != nil {
+		t.Errorf("second Close = %v", err)
+	}
+}
+
+func TestRotatingFileRenameFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	// Непустой каталог на месте резервной копии не удалить и не заменить переименованием
+	backup := path + ".1"
+	if err := os.MkdirAll(filepath.Join(backup, "keep"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	rf, err := newRotatingFile(path, 16, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+
+	for _, line := range []string{"aaaaaaaa\n", "bbbbbbbb\n", "cccccccc\n"} {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatalf("Write(%q) after failed rotation: %v", line, err)
+		}
+	}
+	if data, _ := os.ReadFile(path); string(data) != "aaaaaaaa\nbbbbbbbb\ncccccccc\n" {
+		t.Errorf("app.log = %q, want all records in the original file", data)
+	}
+
+	// Когда препятствие убрано, следующая запись выполняет ротацию
+	if err := os.RemoveAll(backup); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rf.Write([]byte("dddddddd\n")); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(backup); string(data) != "aaaaaaaa\nbbbbbbbb\ncccccccc\n" {
+		t.Errorf("app.log.1 = %q, want the records written before rotation", data)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "dddddddd\n" {
+		t.Errorf("app.log = %q, want the record after rotation", data)
+	}
+}
+
+func TestSubsystemLevels(t *testing.T) {
+	useTestLogLevels(t)
+	path := filepath.Join(t.TempDir(), "app.log")
+	err := setupLogging(LogConfig{
+		Format: "json",
+		Level:  "warn",
+		Levels: map[string]string{subsystemWS: "debug", subsystemDB: "error"},
+		File:   path,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logHTTP.Info("http info")
+	logHTTP.Warn("http warn")
+	logWS.Debug("ws debug")
+	logMode.Info("mode info")
+	logMode.Error("mode error")
+	logDB.Warn("db warn")
+	logDB.Error("db error")
+	closeLogFile()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("log line %q: %v", line, err)
+		}
+		got = append(got, record["subsystem"].(string)+": "+record["msg"].(string))
+	}
+	want := []string{"http: http warn", "ws: ws debug", "mode: mode error", "db: db error"}
+	if strings.Join(got, "; ") != strings.Join(want, "; ") {
+		t.Errorf("logged %q, want %q", got, want)
+	}
+}
+
+func TestSetupLoggingRejectsInvalidConfig(t *testing.T) {
+	useTestLogLevels(t)
+	for _, opts := range []LogConfig{
+		{Format: "xml"},
+		{Level: "loud"},
+		{Levels: map[string]string{subsystemWS: "verbose"}},
+	} {
+		opts.File = filepath.Join(t.TempDir(), "app.log")
+		if err := setupLogging(opts); err == nil {
+			t.Errorf("setupLogging(%+v) accepted invalid config", opts)
+		}
+	}
+}
+
+func TestLogLevelsHandler(t *testing.T) {
+	useTestLogLevels(t)
+	captureLogs(t)
+	for _, levelVar := range logLevels {
+		levelVar.Set(slog.LevelInfo)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		status int
+		levels map[string]string // уровни после запроса
+	}{
+		{"read", http.MethodGet, "", http.StatusOK, nil},
+		{"unknown subsystem rejects the whole update", http.MethodPut, `{"http": "debug", "cache": "info"}`, http.StatusBadRequest, nil},
+		{"invalid level rejects the whole update", http.MethodPut, `{"http": "debug", "ws": "loud"}`, http.StatusBadRequest, nil},
+		{"invalid JSON", http.MethodPut, `{"http":`, http.StatusBadRequest, nil},
+		{"update", http.MethodPut, `{"http": "debug", "db": "ERROR"}`, http.StatusOK, map[string]string{subsystemHTTP: "DEBUG", subsystemDB: "ERROR"}},
+		{"POST is an update too", http.MethodPost, `{"mode": "warn"}`, http.StatusOK, map[string]string{subsystemMode: "WARN"}},
+		{"other methods", http.MethodDelete, "", http.StatusMethodNotAllowed, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := make(map[string]string, len(logLevels))
+			for name, levelVar := range logLevels {
+				before[name] = levelVar.Level().String()
+			}
+
+			rec := httptest.NewRecorder()
+			apiLogLevelsHandler(rec, httptest.NewRequest(tt.method, "/api/v1/admin/log-levels", bytes.NewBufferString(tt.body)))
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+
+			for name, levelVar := range logLevels {
+				want := before[name]
+				if level, changed := tt.levels[name]; changed {
+					want = level
+				}
+				if got := levelVar.Level().String(); got != want {
+					t.Errorf("%s level = %s, want %s", name, got, want)
+				}
+			}
+			if tt.status == http.StatusOK {
+				var current map[string]string
+				if err := json.Unmarshal(rec.Body.Bytes(), &current); err != nil {
+					t.Fatal(err)
+				}
+				if len(current) != len(logLevels) {
+					t.Errorf("response lists %d subsystems, want %d", len(current), len(logLevels))
+				}
+				for name, levelVar := range logLevels {
+					if current[name] != levelVar.Level().String() {
+						t.Errorf("response %s = %s, want %s", name, current[name], levelVar.Level())
+					}
+				}
+			}
+		})
+	}
+}
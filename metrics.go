@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Границы бакетов гистограмм в секундах (как в клиенте Prometheus по умолчанию)
+var defaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// histogram - потокобезопасная гистограмма Prometheus
+type histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+// Observe добавляет наблюдение
+func (h *histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, bound := range h.buckets {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// write выводит гистограмму в текстовом формате; labels уже отформатированы без скобок
+func (h *histogram) write(w io.Writer, name, labels string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+	for i, bound := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{%s%sle=\"%s\"} %d\n", name, labels, sep, formatFloat(bound), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, sep, h.count)
+	if labels != "" {
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels, formatFloat(h.sum))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, h.count)
+	} else {
+		fmt.Fprintf(w, "%s_sum %s\n", name, formatFloat(h.sum))
+		fmt.Fprintf(w, "%s_count %d\n", name, h.count)
+	}
+}
+
+// requestKey - набор меток HTTP-метрик
+type requestKey struct {
+	route  string
+	method string
+	status int
+}
+
+func (k requestKey) labels() string {
+	return fmt.Sprintf(`route="%s",method="%s",status="%d"`, escapeLabel(k.route), k.method, k.status)
+}
+
+// Метрики сервера
+var (
+	metricsMu        sync.Mutex
+	httpRequests     = make(map[requestKey]uint64)
+	httpDurations    = make(map[requestKey]*histogram)
+	broadcastsByType = make(map[string]uint64)
+
+	broadcastDuration = newHistogram(defaultBuckets)
+	broadcastFailures atomic.Uint64
+	wsConnectsTotal   atomic.Uint64
+)
+
+// responseRecorder запоминает статус и размер ответа
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+// Hijack нужен для обновления соединения до WebSocket
+func (rec *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	if rec.status == 0 {
+		rec.status = http.StatusSwitchingProtocols
+	}
+	return hijacker.Hijack()
+}
+
+func (rec *responseRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Status возвращает код ответа (200, если обработчик ничего не записал)
+func (rec *responseRecorder) Status() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+	return rec.status
+}
+
+// normalizeMethod ограничивает множество значений метки method
+func normalizeMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return "OTHER"
+}
+
+// instrument считает запросы и время их обработки для маршрута
+func instrument(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w}
+
+		next(rec, r)
+
+		observeRequest(route, r.Method, rec.Status(), time.Since(start))
+	}
+}
+
+func observeRequest(route, method string, status int, elapsed time.Duration) {
+	key := requestKey{route: route, method: normalizeMethod(method), status: status}
+
+	metricsMu.Lock()
+	httpRequests[key]++
+	h, exists := httpDurations[key]
+	if !exists {
+		h = newHistogram(defaultBuckets)
+		httpDurations[key] = h
+	}
+	metricsMu.Unlock()
+
+	h.Observe(elapsed.Seconds())
+}
+
+// observeBroadcast учитывает рассылку WebSocket-сообщения
+func observeBroadcast(messageType string, elapsed time.Duration, failures int) {
+	metricsMu.Lock()
+	broadcastsByType[messageType]++
+	metricsMu.Unlock()
+
+	broadcastDuration.Observe(elapsed.Seconds())
+	broadcastFailures.Add(uint64(failures))
+}
+
+// clientCount возвращает число WebSocket-клиентов под блокировкой
+func clientCount() int {
+	clientsMu.RLock()
+	defer clientsMu.RUnlock()
+	return len(clients)
+}
+
+// Count возвращает число пользователей
+func (db *InMemoryDB) Count() int {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	return len(db.users)
+}
+
+func escapeLabel(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return strings.ReplaceAll(value, "\n", `\n`)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Endpoint для Prometheus в текстовом формате
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writeMetrics(w)
+}
+
+func writeMetrics(w io.Writer) {
+	metricsMu.Lock()
+	keys := make([]requestKey, 0, len(httpRequests))
+	for key := range httpRequests {
+		keys = append(keys, key)
+	}
+	requests := make(map[requestKey]uint64, len(httpRequests))
+	durations := make(map[requestKey]*histogram, len(httpDurations))
+	for _, key := range keys {
+		requests[key] = httpRequests[key]
+		durations[key] = httpDurations[key]
+	}
+	types := make([]string, 0, len(broadcastsByType))
+	broadcasts := make(map[string]uint64, len(broadcastsByType))
+	for messageType, count := range broadcastsByType {
+		types = append(types, messageType)
+		broadcasts[messageType] = count
+	}
+	metricsMu.Unlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].status < keys[j].status
+	})
+	sort.Strings(types)
+
+	fmt.Fprintln(w, "# HELP usermanager_http_requests_total Total HTTP requests by route, method and status.")
+	fmt.Fprintln(w, "# TYPE usermanager_http_requests_total counter")
+	for _, key := range keys {
+		fmt.Fprintf(w, "usermanager_http_requests_total{%s} %d\n", key.labels(), requests[key])
+	}
+
+	fmt.Fprintln(w, "# HELP usermanager_http_request_duration_seconds HTTP request latency by route, method and status.")
+	fmt.Fprintln(w, "# TYPE usermanager_http_request_duration_seconds histogram")
+	for _, key := range keys {
+		durations[key].write(w, "usermanager_http_request_duration_seconds", key.labels())
+	}
+
+	fmt.Fprintln(w, "# HELP usermanager_websocket_connections Currently connected WebSocket clients.")
+	fmt.Fprintln(w, "# TYPE usermanager_websocket_connections gauge")
+	fmt.Fprintf(w, "usermanager_websocket_connections %d\n", clientCount())
+
+	fmt.Fprintln(w, "# HELP usermanager_websocket_connects_total Total accepted WebSocket connections.")
+	fmt.Fprintln(w, "# TYPE usermanager_websocket_connects_total counter")
+	fmt.Fprintf(w, "usermanager_websocket_connects_total %d\n", wsConnectsTotal.Load())
+
+	fmt.Fprintln(w, "# HELP usermanager_broadcasts_total Total WebSocket broadcasts by message type.")
+	fmt.Fprintln(w, "# TYPE usermanager_broadcasts_total counter")
+	for _, messageType := range types {
+		fmt.Fprintf(w, "usermanager_broadcasts_total{type=\"%s\"} %d\n", escapeLabel(messageType), broadcasts[messageType])
+	}
+
+	fmt.Fprintln(w, "# HELP usermanager_broadcast_duration_seconds Time spent delivering a broadcast to all clients.")
+	fmt.Fprintln(w, "# TYPE usermanager_broadcast_duration_seconds histogram")
+	broadcastDuration.write(w, "usermanager_broadcast_duration_seconds", "")
+
+	fmt.Fprintln(w, "# HELP usermanager_broadcast_failures_total Failed WebSocket sends during broadcasts.")
+	fmt.Fprintln(w, "# TYPE usermanager_broadcast_failures_total counter")
+	fmt.Fprintf(w, "usermanager_broadcast_failures_total %d\n", broadcastFailures.Load())
+
+	modeMutex.RLock()
+	currentMode := serverMode
+	lastChange := lastModeChange
+	modeMutex.RUnlock()
+
+	// /metrics открыт без входа, а режимы со скрытыми данными не раскрывают и их объем
+	if !modePolicies[currentMode].HideData {
+		fmt.Fprintln(w, "# HELP usermanager_users Number of users in the database.")
+		fmt.Fprintln(w, "# TYPE usermanager_users gauge")
+		fmt.Fprintf(w, "usermanager_users %d\n", db.Count())
+	}
+
+	fmt.Fprintln(w, "# HELP usermanager_mode Current server mode (1 for the active mode).")
+	fmt.Fprintln(w, "# TYPE usermanager_mode gauge")
+	for _, mode := range modeNames() {
+		value := 0
+		if mode == currentMode {
+			value = 1
+		}
+		fmt.Fprintf(w, "usermanager_mode{mode=\"%s\"} %d\n", mode, value)
+	}
+
+	fmt.Fprintln(w, "# HELP usermanager_mode_last_change_timestamp_seconds Unix time of the last mode change.")
+	fmt.Fprintln(w, "# TYPE usermanager_mode_last_change_timestamp_seconds gauge")
+	fmt.Fprintf(w, "usermanager_mode_last_change_timestamp_seconds %d\n", lastChange.Unix())
+
+	fmt.Fprintln(w, "# HELP usermanager_uptime_seconds Seconds since server start.")
+	fmt.Fprintln(w, "# TYPE usermanager_uptime_seconds gauge")
+	fmt.Fprintf(w, "usermanager_uptime_seconds %s\n", formatFloat(time.Since(startTime).Seconds()))
+
+	writeRateLimitMetrics(w)
+	writeRuntimeMetrics(w)
+}
+
+// writeRuntimeMetrics выводит статистику рантайма Go
+func writeRuntimeMetrics(w io.Writer) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	fmt.Fprintln(w, "# HELP go_info Information about the Go environment.")
+	fmt.Fprintln(w, "# TYPE go_info gauge")
+	fmt.Fprintf(w, "go_info{version=\"%s\"} 1\n", runtime.Version())
+
+	fmt.Fprintln(w, "# HELP go_goroutines Number of goroutines that currently exist.")
+	fmt.Fprintln(w, "# TYPE go_goroutines gauge")
+	fmt.Fprintf(w, "go_goroutines %d\n", runtime.NumGoroutine())
+
+	fmt.Fprintln(w, "# HELP go_memstats_alloc_bytes Number of bytes allocated and still in use.")
+	fmt.Fprintln(w, "# TYPE go_memstats_alloc_bytes gauge")
+	fmt.Fprintf(w, "go_memstats_alloc_bytes %d\n", m.Alloc)
+
+	fmt.Fprintln(w, "# HELP go_memstats_heap_inuse_bytes Number of heap bytes that are in use.")
+	fmt.Fprintln(w, "# TYPE go_memstats_heap_inuse_bytes gauge")
+	fmt.Fprintf(w, "go_memstats_heap_inuse_bytes %d\n", m.HeapInuse)
+
+	fmt.Fprintln(w, "# HELP go_memstats_sys_bytes Number of bytes obtained from system.")
+	fmt.Fprintln(w, "# TYPE go_memstats_sys_bytes gauge")
+	fmt.Fprintf(w, "go_memstats_sys_bytes %d\n", m.Sys)
+
+	fmt.Fprintln(w, "# HELP go_memstats_mallocs_total Total number of mallocs.")
+	fmt.Fprintln(w, "# TYPE go_memstats_mallocs_total counter")
+	fmt.Fprintf(w, "go_memstats_mallocs_total %d\n", m.Mallocs)
+
+	fmt.Fprintln(w, "# HELP go_gc_cycles_total Number of completed GC cycles.")
+	fmt.Fprintln(w, "# TYPE go_gc_cycles_total counter")
+	fmt.Fprintf(w, "go_gc_cycles_total %d\n", m.NumGC)
+
+	fmt.Fprintln(w, "# HELP go_gc_pause_seconds_total Total GC stop-the-world pause time.")
+	fmt.Fprintln(w, "# TYPE go_gc_pause_seconds_total counter")
+	fmt.Fprintf(w, "go_gc_pause_seconds_total %s\n", formatFloat(float64(m.PauseTotalNs)/1e9))
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useTestMode включает режим на время теста
+func useTestMode(t *testing.T, mode string) {
+	t.Helper()
+	modeMutex.Lock()
+	saved := serverMode
+	serverMode = mode
+	modeMutex.Unlock()
+	t.Cleanup(func() {
+		modeMutex.Lock()
+		serverMode = saved
+		modeMutex.Unlock()
+	})
+}
+
+func TestWriteMetricsHidesUserCount(t *testing.T) {
+	for _, mode := range modeNames() {
+		t.Run(mode, func(t *testing.T) {
+			useTestMode(t, mode)
+
+			var b strings.Builder
+			writeMetrics(&b)
+			exposed := strings.Contains(b.String(), "\nusermanager_users ")
+			if hidden := modePolicies[mode].HideData; exposed == hidden {
+				t.Errorf("usermanager_users exposed = %v with hide_data = %v", exposed, hidden)
+			}
+		})
+	}
+}
+
+// useTestMetrics начинает счетчики HTTP-запросов с нуля
+func useTestMetrics(t *testing.T) {
+	t.Helper()
+	metricsMu.Lock()
+	savedRequests, savedDurations := httpRequests, httpDurations
+	httpRequests = make(map[requestKey]uint64)
+	httpDurations = make(map[requestKey]*histogram)
+	metricsMu.Unlock()
+	t.Cleanup(func() {
+		metricsMu.Lock()
+		httpRequests, httpDurations = savedRequests, savedDurations
+		metricsMu.Unlock()
+	})
+}
+
+var (
+	metricNamePattern  = `[a-zA-Z_:][a-zA-Z0-9_:]*`
+	metricCommentLine  = regexp.MustCompile(`^# (HELP|TYPE) (` + metricNamePattern + `) (.+)$`)
+	metricSampleLine   = regexp.MustCompile(`^(` + metricNamePattern + `)(?:\{(.*)\})? (\S+)$`)
+	metricLabelPattern = regexp.MustCompile(`^([a-zA-Z_][a-zA-Z0-9_]*)="((?:[^"\\\n]|\\["\\n])*)"(?:,|$)`)
+)
+
+// parseExposition проверяет текстовый формат Prometheus 0.0.4 и возвращает значения
+// серий по строке "имя{метки}"
+func parseExposition(t *testing.T, text string) map[string]float64 {
+	t.Helper()
+	types := make(map[string]string)
+	samples := make(map[string]float64)
+	for i, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		if match := metricCommentLine.FindStringSubmatch(line); match != nil {
+			if match[1] == "TYPE" {
+				if _, declared := types[match[2]]; declared {
+					t.Errorf("line %d: duplicate TYPE for %s", i+1, match[2])
+				}
+				switch match[3] {
+				case "counter", "gauge", "histogram", "summary", "untyped":
+				default:
+					t.Errorf("line %d: unknown type %q", i+1, match[3])
+				}
+				types[match[2]] = match[3]
+			}
+			continue
+		}
+
+		match := metricSampleLine.FindStringSubmatch(line)
+		if match == nil {
+			t.Errorf("line %d is not a valid sample: %q", i+1, line)
+			continue
+		}
+		name, labels := match[1], match[2]
+		for rest := labels; rest != ""; {
+			label := metricLabelPattern.FindStringSubmatch(rest)
+			if label == nil {
+				t.Errorf("line %d: invalid labels %q", i+1, labels)
+				break
+			}
+			rest = rest[len(label[0]):]
+		}
+		value, err := strconv.ParseFloat(match[3], 64)
+		if err != nil {
+			t.Errorf("line %d: invalid value %q", i+1, match[3])
+		}
+
+		family := name
+		for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+			if base := strings.TrimSuffix(name, suffix); base != name && types[base] == "histogram" {
+				family = base
+			}
+		}
+		if _, declared := types[family]; !declared {
+			t.Errorf("line %d: sample %s has no preceding TYPE", i+1, name)
+		}
+		key := name + "{" + labels + "}"
+		if _, duplicate := samples[key]; duplicate {
+			t.Errorf("line %d: duplicate series %s", i+1, key)
+		}
+		samples[key] = value
+	}
+	return samples
+}
+
+func TestMetricsRoute(t *testing.T) {
+	tests := map[string]string{
+		"GET /api/v1/users/{id}": "/api/v1/users/{id}",
+		"/api/v1/users":          "/api/v1/users",
+		"/":                      "/",
+	}
+	for pattern, want := range tests {
+		if got := metricsRoute(pattern); got != want {
+			t.Errorf("metricsRoute(%q) = %q, want %q", pattern, got, want)
+		}
+	}
+}
+
+func TestWriteMetricsAfterRequests(t *testing.T) {
+	useTestMetrics(t)
+	useTestDB(t)
+
+	mux := http.NewServeMux()
+	for _, pattern := range []string{"GET /api/v1/users/{id}", "POST /api/v1/users"} {
+		mux.HandleFunc(pattern, instrument(metricsRoute(pattern), func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.PathValue("id") == "404":
+				sendError(w, http.StatusNotFound, "User not found")
+			case r.Method == http.MethodPost:
+				w.WriteHeader(http.StatusCreated)
+			default:
+				w.Write([]byte("{}"))
+			}
+		}))
+	}
+	for _, request := range []struct{ method, path string }{
+		{http.MethodGet, "/api/v1/users/1"},
+		{http.MethodGet, "/api/v1/users/2"},
+		{http.MethodGet, "/api/v1/users/404"},
+		{http.MethodPost, "/api/v1/users"},
+	} {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(request.method, request.path, nil))
+	}
+
+	// Время обработки задается явно, чтобы проверить границы бакетов
+	for _, elapsed := range []time.Duration{30 * time.Millisecond, 300 * time.Millisecond, 20 * time.Second} {
+		observeRequest("/api/v1/slow", "BREW", http.StatusOK, elapsed)
+	}
+
+	var b strings.Builder
+	writeMetrics(&b)
+	samples := parseExposition(t, b.String())
+
+	series := func(name, route, method string, status int, extra string) string {
+		return fmt.Sprintf(`%s{route="%s",method="%s",status="%d"%s}`, name, route, method, status, extra)
+	}
+	want := map[string]float64{
+		series("usermanager_http_requests_total", "/api/v1/users/{id}", "GET", 200, ""):                         2,
+		series("usermanager_http_requests_total", "/api/v1/users/{id}", "GET", 404, ""):                         1,
+		series("usermanager_http_requests_total", "/api/v1/users", "POST", 201, ""):                             1,
+		series("usermanager_http_requests_total", "/api/v1/slow", "OTHER", 200, ""):                             3,
+		series("usermanager_http_request_duration_seconds_count", "/api/v1/users/{id}", "GET", 200, ""):         2,
+		series("usermanager_http_request_duration_seconds_bucket", "/api/v1/slow", "OTHER", 200, `,le="0.025"`): 0,
+		series("usermanager_http_request_duration_seconds_bucket", "/api/v1/slow", "OTHER", 200, `,le="0.05"`):  1,
+		series("usermanager_http_request_duration_seconds_bucket", "/api/v1/slow", "OTHER", 200, `,le="0.25"`):  1,
+		series("usermanager_http_request_duration_seconds_bucket", "/api/v1/slow", "OTHER", 200, `,le="0.5"`):   2,
+		series("usermanager_http_request_duration_seconds_bucket", "/api/v1/slow", "OTHER", 200, `,le="10"`):    2,
+		series("usermanager_http_request_duration_seconds_bucket", "/api/v1/slow", "OTHER", 200, `,le="+Inf"`):  3,
+		series("usermanager_http_request_duration_seconds_count", "/api/v1/slow", "OTHER", 200, ""):             3,
+	}
+	for key, value := range want {
+		got, exists := samples[key]
+		if !exists {
+			t.Errorf("missing series %s", key)
+		} else if got != value {
+			t.Errorf("%s = %v, want %v", key, got, value)
+		}
+	}
+	sum := samples[series("usermanager_http_request_duration_seconds_sum", "/api/v1/slow", "OTHER", 200, "")]
+	if sum < 20.32 || sum > 20.34 {
+		t.Errorf("duration sum = %v, want 20.33", sum)
+	}
+
+	// Конкретные ID не попадают в метки, а бакеты каждой серии не убывают
+	for key := range samples {
+		if strings.Contains(key, `route="/api/v1/users/1"`) || strings.Contains(key, `route="/api/v1/users/404"`) {
+			t.Errorf("request path leaked into labels: %s", key)
+		}
+	}
+	for _, key := range []requestKey{
+		{"/api/v1/users/{id}", "GET", 200},
+		{"/api/v1/users/{id}", "GET", 404},
+		{"/api/v1/users", "POST", 201},
+		{"/api/v1/slow", "OTHER", 200},
+	} {
+		previous := 0.0
+		for _, bound := range append(defaultBucketLabels(), "+Inf") {
+			value := samples["usermanager_http_request_duration_seconds_bucket{"+key.labels()+`,le="`+bound+`"}`]
+			if value < previous {
+				t.Errorf("%v: bucket le=%s = %v after %v", key, bound, value, previous)
+			}
+			previous = value
+		}
+		if count := samples["usermanager_http_request_duration_seconds_count{"+key.labels()+"}"]; count != previous {
+			t.Errorf("%v: _count = %v, +Inf bucket = %v", key, count, previous)
+		}
+	}
+}
+
+func defaultBucketLabels() []string {
+	labels := make([]string, len(defaultBuckets))
+	for i, bound := range defaultBuckets {
+		labels[i] = formatFloat(bound)
+	}
+	return labels
+}
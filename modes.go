@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Режимы работы сервера
+const (
+	modeServer      = "server"
+	modeLocal       = "local"
+	modeReadonly    = "readonly"
+	modeMaintenance = "maintenance"
+)
+
+// modePolicy - что разрешено в режиме. Политика задается один раз и применяется
+// checkModeMiddleware, правами ролей и обработкой сообщений WebSocket
+type modePolicy struct {
+	Public   []string // разрешения, доступные всем без входа
+	Blocked  []string // разрешения, на которые отвечаем 503
+	Bypass   string   // разрешение, снимающее Blocked; пусто - ограничение для всех
+	HideData bool     // без local:access данные скрываются за 404
+	Message  string   // пояснение для клиентов по умолчанию
+	Warning  string   // что увидят пользователи, для ответа администратору
+}
+
+// modePolicies - единая таблица режимов
+var modePolicies = map[string]modePolicy{
+	modeServer: {
+		Public:  publicPermissions,
+		Warning: "Все пользователи видят данные",
+	},
+	modeLocal: {
+		HideData: true,
+		Warning:  "Обычные пользователи увидят 404 страницу",
+	},
+	modeReadonly: {
+		Public:  []string{permUsersRead},
+		Blocked: []string{permUsersWrite, permUsersBulk},
+		Message: "Сервер работает в режиме только для чтения",
+		Warning: "Данные доступны для чтения, изменения отклоняются с 503",
+	},
+	modeMaintenance: {
+		Blocked: []string{permUsersRead, permUsersWrite, permUsersBulk, permUsersExport},
+		Bypass:  permModeWrite,
+		Message: "Идут технические работы",
+		Warning: "Пользователи увидят страницу технических работ, администраторы продолжают работу",
+	},
+}
+
+// modeNames возвращает режимы по алфавиту
+func modeNames() []string {
+	names := make([]string, 0, len(modePolicies))
+	for mode := range modePolicies {
+		names = append(names, mode)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validMode сообщает, известен ли режим
+func validMode(mode string) bool {
+	_, exists := modePolicies[mode]
+	return exists
+}
+
+// grants сообщает, есть ли разрешение в списке
+func grants(permissions []string, permission string) bool {
+	for _, granted := range permissions {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// modeState - текущий режим с пояснением и ожидаемым временем окончания
+type modeState struct {
+	Mode      string
+	Message   string
+	ETA       *time.Time
+	ChangedAt time.Time
+}
+
+// currentModeState возвращает снимок режима
+func currentModeState() modeState {
+	modeMutex.RLock()
+	defer modeMutex.RUnlock()
+	return modeState{Mode: serverMode, Message: modeMessage, ETA: modeETA, ChangedAt: lastModeChange}
+}
+
+// message возвращает пояснение режима: заданное администратором или из политики
+func (s modeState) message() string {
+	if s.Message != "" {
+		return s.Message
+	}
+	return modePolicies[s.Mode].Message
+}
+
+// info возвращает поля режима для ответов API и сообщений WebSocket
+func (s modeState) info() map[string]interface{} {
+	info := map[string]interface{}{"mode": s.Mode}
+	if message := s.message(); message != "" {
+		info["mode_message"] = message
+	}
+	if s.ETA != nil {
+		info["mode_eta"] = s.ETA.UTC().Format(time.RFC3339)
+	}
+	return info
+}
+
+// modeBlocked сообщает, закрыто ли разрешение режимом для учетной записи
+func modeBlocked(mode, name, role, permission string) bool {
+	policy := modePolicies[mode]
+	if !grants(policy.Blocked, permission) {
+		return false
+	}
+	return policy.Bypass == "" || !allows(name, role, policy.Bypass, mode)
+}
+
+// modeRestricts сообщает, закрывает ли разрешение хотя бы один режим
+func modeRestricts(permission string) bool {
+	for _, policy := range modePolicies {
+		if grants(policy.Blocked, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// setMode переключает режим и рассылает mode_changed и force_reload всем клиентам
+func setMode(newMode, message string, eta *time.Time, changedBy string) string {
+	modeMutex.Lock()
+	oldMode := serverMode
+	serverMode = newMode
+	modeMessage = message
+	modeETA = eta
+	lastModeChange = time.Now()
+	state := modeState{Mode: newMode, Message: message, ETA: eta, ChangedAt: lastModeChange}
+	modeMutex.Unlock()
+
+	changed := state.info()
+	changed["old_mode"] = oldMode
+	changed["new_mode"] = newMode
+	changed["time"] = time.Now().Unix()
+	changed["force_reload"] = true
+	changed["changed_by"] = changedBy
+	broadcastToAll("mode_changed", changed)
+
+	// Небольшая задержка для гарантии отправки
+	time.Sleep(50 * time.Millisecond)
+
+	// Также отправляем команду на принудительную перезагрузку
+	broadcastToAll("force_reload", map[string]interface{}{
+		"reason": "mode_changed_to_" + newMode,
+		"time":   time.Now().Unix(),
+	})
+	return oldMode
+}
+
+// modeUnavailable - ответ 503 на действие, закрытое режимом
+type modeUnavailable struct {
+	Error      string     `json:"error"`
+	Mode       string     `json:"mode"`
+	Message    string     `json:"message"`
+	ETA        *time.Time `json:"eta,omitempty"`
+	Permission string     `json:"permission"`
+	RequestID  string     `json:"request_id,omitempty"`
+}
+
+// retryAfter возвращает секунды до ожидаемого окончания режима
+func (s modeState) retryAfter() int {
+	if s.ETA == nil {
+		return 0
+	}
+	return int(time.Until(*s.ETA).Round(time.Second).Seconds())
+}
+
+// denyMode отвечает 503 с пояснением режима и Retry-After, если известно время окончания
+func denyMode(w http.ResponseWriter, r *http.Request, state modeState, permission string) {
+	if seconds := state.retryAfter(); seconds > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	}
+	logMode.DebugContext(r.Context(), "действие закрыто режимом",
+		"mode", state.Mode, "path", r.URL.Path, "permission", permission, "client_ip", clientIP(r))
+	sendJSON(w, http.StatusServiceUnavailable, modeUnavailable{
+		Error:      "Service unavailable in " + state.Mode + " mode",
+		Mode:       state.Mode,
+		Message:    state.message(),
+		ETA:        state.ETA,
+		Permission: permission,
+		RequestID:  requestIDFrom(r.Context()),
+	})
+}
+
+// maintenancePage отдает страницу технических работ для встроенного фронтенда
+func maintenancePage(w http.ResponseWriter, state modeState) {
+	eta := "Время окончания пока неизвестно."
+	if state.ETA != nil {
+		eta = "Ожидаемое время окончания: " + state.ETA.Local().Format("02.01.2006 15:04") + "."
+	}
+	if seconds := state.retryAfter(); seconds > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html lang="ru">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>503 - Технические работы</title>
+    <style>
+        body { font-family: Arial, sans-serif; color: #333; display: flex; justify-content: center;
+               align-items: center; height: 100vh; margin: 0; text-align: center; }
+        .container { padding: 3rem; max-width: 600px; }
+        h1 { font-size: 4rem; color: #f59e0b; margin-bottom: 1rem; }
+        p { font-size: 1.2rem; color: #6b7280; line-height: 1.6; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <h1>503</h1>
+        <p><strong>%s</strong></p>
+        <p>%s</p>
+    </div>
+    <script>
+        // Страница перезагружается, как только режим технических работ снят
+        setInterval(() => {
+            fetch('/api/v1/check-mode?_=' + Date.now())
+                .then(response => response.json())
+                .then(data => { if (data.mode !== '%s') location.reload(); });
+        }, 5000);
+    </script>
+</body>
+</html>`, html.EscapeString(state.message()), html.EscapeString(eta), modeMaintenance)
+}
+
+// modeSummary перечисляет режимы для сообщения об ошибке
+func modeSummary() string {
+	return "'" + strings.Join(modeNames(), "', '") + "'"
+}
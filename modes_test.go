@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestModeBlocked(t *testing.T) {
+	dataPermissions := []string{permUsersRead, permUsersWrite, permUsersBulk, permUsersExport}
+	readonlyBlocked := []string{permUsersWrite, permUsersBulk}
+	// Закрытые режимом разрешения для каждой роли; остальные разрешения режим не трогает
+	tests := map[string]map[string][]string{
+		modeServer: {},
+		modeLocal:  {},
+		modeReadonly: {
+			roleAnonymous: readonlyBlocked,
+			roleViewer:    readonlyBlocked,
+			roleEditor:    readonlyBlocked,
+			roleAdmin:     readonlyBlocked,
+		},
+		modeMaintenance: {
+			roleAnonymous: dataPermissions,
+			roleViewer:    dataPermissions,
+			roleEditor:    dataPermissions,
+			roleAdmin:     nil, // mode:write снимает ограничение
+		},
+	}
+	for _, mode := range modeNames() {
+		blockedFor, known := tests[mode]
+		if !known {
+			t.Fatalf("mode %q has no expectations", mode)
+		}
+		for _, role := range []string{roleAnonymous, roleViewer, roleEditor, roleAdmin} {
+			name := ""
+			if role != roleAnonymous {
+				name = "alice"
+			}
+			for _, permission := range allPermissions {
+				want := grants(blockedFor[role], permission)
+				if got := modeBlocked(mode, name, role, permission); got != want {
+					t.Errorf("modeBlocked(%s, %s, %s) = %v, want %v", mode, role, permission, got, want)
+				}
+			}
+		}
+	}
+}
+
+// routeClass - маршрут с тем же набором middleware, что и в register
+type routeClass struct {
+	name, method, path, permission string
+}
+
+var modeRouteClasses = []routeClass{
+	{"read", http.MethodGet, "/api/v1/users", permUsersRead},
+	{"write", http.MethodPost, "/api/v1/users", permUsersWrite},
+	{"bulk", http.MethodPost, "/api/v1/admin/users/bulk/preview", permUsersBulk},
+	{"export", http.MethodGet, "/api/v1/admin/users/export", permUsersExport},
+	{"mode", http.MethodPost, "/api/v1/admin/mode/schedules", permModeWrite},
+	{"page", http.MethodGet, "/", ""},
+}
+
+func (c routeClass) handler() http.HandlerFunc {
+	var handler http.HandlerFunc = func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	if c.permission != "" {
+		handler = requirePermission(c.permission, handler)
+	}
+	return withRequestID(checkModeMiddleware(c.permission, handler))
+}
+
+func TestModePolicyRoutes(t *testing.T) {
+	const (
+		ok          = http.StatusOK
+		forbid      = http.StatusForbidden
+		hidden      = http.StatusNotFound
+		unavailable = http.StatusServiceUnavailable
+	)
+	// Статусы по классам маршрутов: read, write, bulk, export, mode, page. Анонимный запрос
+	// без учетных данных получает 403 с ролью anonymous, а не 401
+	tests := []struct {
+		mode, principal string
+		want            [6]int
+	}{
+		{modeServer, "anonymous", [6]int{ok, forbid, forbid, forbid, forbid, ok}},
+		{modeServer, "trusted", [6]int{ok, forbid, forbid, forbid, forbid, ok}},
+		{modeServer, roleViewer, [6]int{ok, forbid, forbid, forbid, forbid, ok}},
+		{modeServer, roleEditor, [6]int{ok, ok, ok, ok, forbid, ok}},
+		{modeServer, roleAdmin, [6]int{ok, ok, ok, ok, ok, ok}},
+
+		{modeLocal, "anonymous", [6]int{hidden, forbid, forbid, forbid, forbid, hidden}},
+		{modeLocal, "trusted", [6]int{ok, forbid, forbid, forbid, forbid, ok}},
+		{modeLocal, roleViewer, [6]int{ok, forbid, forbid, forbid, forbid, ok}},
+		{modeLocal, roleEditor, [6]int{ok, ok, ok, ok, forbid, ok}},
+		{modeLocal, roleAdmin, [6]int{ok, ok, ok, ok, ok, ok}},
+
+		{modeReadonly, "anonymous", [6]int{ok, unavailable, unavailable, forbid, forbid, ok}},
+		{modeReadonly, "trusted", [6]int{ok, unavailable, unavailable, forbid, forbid, ok}},
+		{modeReadonly, roleViewer, [6]int{ok, unavailable, unavailable, forbid, forbid, ok}},
+		{modeReadonly, roleEditor, [6]int{ok, unavailable, unavailable, ok, forbid, ok}},
+		{modeReadonly, roleAdmin, [6]int{ok, unavailable, unavailable, ok, ok, ok}},
+
+		{modeMaintenance, "anonymous", [6]int{unavailable, unavailable, unavailable, unavailable, forbid, unavailable}},
+		{modeMaintenance, "trusted", [6]int{unavailable, unavailable, unavailable, unavailable, forbid, unavailable}},
+		{modeMaintenance, roleViewer, [6]int{unavailable, unavailable, unavailable, unavailable, forbid, unavailable}},
+		{modeMaintenance, roleEditor, [6]int{unavailable, unavailable, unavailable, unavailable, forbid, unavailable}},
+		{modeMaintenance, roleAdmin, [6]int{ok, ok, ok, ok, ok, ok}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode+"/"+tt.principal, func(t *testing.T) {
+			useTestConfig(t)
+			useTestSessions(t)
+			useTestTrustedNetwork(t, "10.0.0.0/8")
+			useTestMode(t, tt.mode)
+			request := modeTestRequester(t, tt.principal)
+
+			for i, class := range modeRouteClasses {
+				rec := httptest.NewRecorder()
+				class.handler()(rec, request(class.method, class.path))
+				if rec.Code != tt.want[i] {
+					t.Errorf("%s %s (%s): status %d, want %d", class.method, class.path, class.name, rec.Code, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// useTestTrustedNetwork делает сеть доверенной на время теста
+func useTestTrustedNetwork(t *testing.T, cidr string) {
+	t.Helper()
+	networks, err := parseNetworks([]string{cidr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	trustedNetworks.Set(networks, "config")
+	t.Cleanup(func() { trustedNetworks.Set(nil, "config") })
+}
+
+// modeTestRequester возвращает конструктор запросов от имени principal: роль учетной
+// записи с сессией, "anonymous" или "trusted" - анонимный запрос из доверенной сети
+func modeTestRequester(t *testing.T, principal string) func(method, path string) *http.Request {
+	t.Helper()
+	var token string
+	switch principal {
+	case "anonymous", "trusted":
+	default:
+		addTestAdmin(t, "alice", principal)
+		token = issueSession("alice").AccessToken
+	}
+	return func(method, path string) *http.Request {
+		r := httptest.NewRequest(method, path, nil)
+		if principal == "trusted" {
+			r.RemoteAddr = "10.1.2.3:5000"
+		}
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		return r
+	}
+}
+
+func TestModeHideDataFiltering(t *testing.T) {
+	for _, mode := range modeNames() {
+		for _, principal := range []string{"anonymous", "trusted", roleViewer} {
+			t.Run(mode+"/"+principal, func(t *testing.T) {
+				useTestConfig(t)
+				useTestSessions(t)
+				useTestDB(t, User{ID: 1, Name: "Иван", Email: "ivan@example.com"})
+				useTestTrustedNetwork(t, "10.0.0.0/8")
+				useTestMode(t, mode)
+				request := modeTestRequester(t, principal)
+				hide := modePolicies[mode].HideData && principal == "anonymous"
+
+				rec := httptest.NewRecorder()
+				apiStatsHandler(rec, request(http.MethodGet, "/api/v1/stats"))
+				var stats map[string]interface{}
+				if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+					t.Fatal(err)
+				}
+				if hidden := stats["total_users"] == float64(0); hidden != hide {
+					t.Errorf("stats total_users = %v, want hidden %v", stats["total_users"], hide)
+				}
+
+				rec = httptest.NewRecorder()
+				apiStatusHandler(rec, request(http.MethodGet, "/api/v1/status"))
+				var status map[string]interface{}
+				if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+					t.Fatal(err)
+				}
+				if blocked := status["blocked"] == true; blocked != hide {
+					t.Errorf("status blocked = %v, want %v", status["blocked"], hide)
+				}
+			})
+		}
+	}
+}
+
+func TestWSMessagesInRestrictedModes(t *testing.T) {
+	// Режимы закрывают только REST: разрешение сообщения, которое закрыл бы режим,
+	// обходило бы его через WebSocket
+	for msgType, permission := range wsMessagePermissions {
+		if modeRestricts(permission) {
+			t.Errorf("WebSocket message %q needs %s, which a mode restricts", msgType, permission)
+		}
+	}
+
+	tests := []struct {
+		role string
+		want string // тип ответа на get_clients
+	}{
+		{roleAnonymous, "error"},
+		{roleViewer, "error"},
+		{roleAuditor, "clients_list"},
+		{roleAdmin, "clients_list"},
+	}
+	for _, mode := range []string{modeReadonly, modeMaintenance} {
+		for _, tt := range tests {
+			t.Run(mode+"/"+tt.role, func(t *testing.T) {
+				useTestConfig(t)
+				useTestMode(t, mode)
+				server, client := testWSPair(t)
+				useTestClients(t)
+				captureLogs(t)
+
+				infoMu.Lock()
+				clientInfo[server] = &ClientData{ClientID: "c1"}
+				infoMu.Unlock()
+				if tt.role != roleAnonymous {
+					addTestAdmin(t, "alice", tt.role)
+					setClientPrincipal(server, "alice", "")
+				}
+				upgrade := httptest.NewRequest(http.MethodGet, "/ws", nil)
+				go handleClientMessages(server, upgrade, logWS)
+
+				if err := client.WriteJSON(map[string]string{"type": "get_clients"}); err != nil {
+					t.Fatal(err)
+				}
+				client.SetReadDeadline(time.Now().Add(time.Second))
+				var msg struct {
+					Type string                 `json:"type"`
+					Data map[string]interface{} `json:"data"`
+				}
+				if err := client.ReadJSON(&msg); err != nil {
+					t.Fatal(err)
+				}
+				if msg.Type != tt.want {
+					t.Fatalf("get_clients answered with %s %v, want %s", msg.Type, msg.Data, tt.want)
+				}
+				if msg.Type == "error" && msg.Data["code"] != "forbidden" {
+					t.Errorf("error code = %v, want forbidden", msg.Data["code"])
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+)
+
+// localAllowlist - сети, запросы из которых в локальном режиме работают как в серверном
+type localAllowlist struct {
+	mu       sync.RWMutex
+	networks []netip.Prefix
+	source   string // "config" или "runtime"
+}
+
+var trustedNetworks = &localAllowlist{source: "config"}
+
+// parseNetworks разбирает CIDR (10.0.0.0/8, fd00::/8, ::ffff:10.0.0.0/104) и отдельные адреса
+func parseNetworks(values []string) ([]netip.Prefix, error) {
+	networks := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if !strings.Contains(value, "/") {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, fmt.Errorf("network %q: must be a CIDR or an IP address", value)
+			}
+			addr = addr.Unmap()
+			networks = append(networks, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("network %q: %w", value, err)
+		}
+		// Адреса клиентов сравниваются без отображения в IPv6, поэтому и
+		// ::ffff:10.0.0.0/104 хранится как 10.0.0.0/8
+		if prefix.Addr().Is4In6() {
+			if prefix.Bits() < 96 {
+				return nil, fmt.Errorf("network %q: IPv4-mapped prefix must be at least /96", value)
+			}
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		networks = append(networks, prefix.Masked())
+	}
+	return networks, nil
+}
+
+// networkStrings возвращает сети в каноническом виде
+func networkStrings(networks []netip.Prefix) []string {
+	values := make([]string, 0, len(networks))
+	for _, network := range networks {
+		values = append(values, network.String())
+	}
+	return values
+}
+
+// Set заменяет список сетей
+func (l *localAllowlist) Set(networks []netip.Prefix, source string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.networks = networks
+	l.source = source
+}
+
+// Snapshot возвращает сети и откуда они взяты
+func (l *localAllowlist) Snapshot() ([]string, string) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return networkStrings(l.networks), l.source
+}
+
+// Contains сообщает, входит ли адрес в одну из сетей
+func (l *localAllowlist) Contains(addr netip.Addr) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, network := range l.networks {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientAddr разбирает адрес клиента из RemoteAddr: IPv6 в скобках, зона интерфейса
+// и IPv4, отображенный в IPv6 (::ffff:192.168.1.5), приводятся к виду, сравнимому с CIDR.
+// Заголовки X-Forwarded-For не учитываются: их может подделать любой клиент
+func clientAddr(r *http.Request) (netip.Addr, bool) {
+	addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addrPort.Addr().Unmap().WithZone(""), true
+}
+
+// trustedRequest сообщает, пришел ли запрос из доверенной сети
+func trustedRequest(r *http.Request) bool {
+	addr, ok := clientAddr(r)
+	return ok && trustedNetworks.Contains(addr)
+}
+
+// setupLocalAllowlist берет сети из data_dir/local_allowlist.json, если администратор
+// менял их во время работы, иначе из конфигурации
+func setupLocalAllowlist() error {
+	var saved []string
+	found, err := loadJSONFile(dataPath("local_allowlist.json"), &saved)
+	if err != nil {
+		return err
+	}
+
+	values, source := cfg.LocalAllowlist, "config"
+	if found {
+		values, source = saved, "runtime"
+	}
+	networks, err := parseNetworks(values)
+	if err != nil {
+		return err
+	}
+	trustedNetworks.Set(networks, source)
+	if len(networks) > 0 {
+		logMode.Info("доверенные сети локального режима", "networks", networkStrings(networks), "source", source)
+	}
+	return nil
+}
+
+// localAllowlistRequest - тело PUT /api/v1/admin/local-allowlist
+type localAllowlistRequest struct {
+	Networks []string `json:"networks"`
+	Reset    bool     `json:"reset,omitempty"` // вернуть сети из конфигурации
+}
+
+// Доверенные сети локального режима: GET - список, PUT - замена
+func apiLocalAllowlistHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut {
+		var body localAllowlistRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			sendError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+
+		values, source := body.Networks, "runtime"
+		if body.Reset {
+			values, source = cfg.LocalAllowlist, "config"
+		}
+		networks, err := parseNetworks(values)
+		if err != nil {
+			sendError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if body.Reset {
+			if err = os.Remove(dataPath("local_allowlist.json")); errors.Is(err, os.ErrNotExist) {
+				err = nil
+			}
+		} else {
+			err = saveJSONFile(dataPath("local_allowlist.json"), networkStrings(networks))
+		}
+		if err != nil {
+			sendError(w, http.StatusInternalServerError, "Failed to save allowlist")
+			return
+		}
+		trustedNetworks.Set(networks, source)
+
+		adminName, _ := requestRole(r)
+		logMode.InfoContext(r.Context(), "доверенные сети локального режима изменены",
+			"networks", networkStrings(networks), "source", source, "admin", adminName)
+	}
+
+	networks, source := trustedNetworks.Snapshot()
+	addr, _ := clientAddr(r)
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"networks":  networks,
+		"source":    source,
+		"client_ip": addr.String(),
+		"trusted":   trustedRequest(r),
+	})
+}
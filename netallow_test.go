@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseNetworks(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		want    []string
+		wantErr bool
+	}{
+		{"ipv4 cidr", []string{"10.0.0.0/8"}, []string{"10.0.0.0/8"}, false},
+		{"host bits are masked", []string{"192.168.1.77/24"}, []string{"192.168.1.0/24"}, false},
+		{"ipv6 cidr", []string{"fd00::/8"}, []string{"fd00::/8"}, false},
+		{"single ipv4", []string{" 203.0.113.5 "}, []string{"203.0.113.5/32"}, false},
+		{"single ipv6", []string{"2001:db8::1"}, []string{"2001:db8::1/128"}, false},
+		{"single ipv4-mapped", []string{"::ffff:192.0.2.1"}, []string{"192.0.2.1/32"}, false},
+		{"ipv4-mapped cidr", []string{"::ffff:10.0.0.0/104"}, []string{"10.0.0.0/8"}, false},
+		{"ipv4-mapped host", []string{"::ffff:10.1.2.3/128"}, []string{"10.1.2.3/32"}, false},
+		{"ipv4-mapped prefix wider than ipv4", []string{"::ffff:0.0.0.0/95"}, nil, true},
+		{"garbage", []string{"not-a-network"}, nil, true},
+		{"bad prefix length", []string{"10.0.0.0/33"}, nil, true},
+		{"empty list", nil, []string{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			networks, err := parseNetworks(tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseNetworks error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(networkStrings(networks), tt.want) {
+				t.Errorf("parseNetworks = %v, want %v", networkStrings(networks), tt.want)
+			}
+		})
+	}
+}
+
+func TestTrustedRequest(t *testing.T) {
+	networks, err := parseNetworks([]string{"10.0.0.0/8", "fd00::/8", "::ffff:192.168.0.0/112", "203.0.113.5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	trustedNetworks.Set(networks, "config")
+	t.Cleanup(func() { trustedNetworks.Set(nil, "config") })
+
+	tests := []struct {
+		remoteAddr   string
+		forwardedFor string
+		want         bool
+	}{
+		{"10.1.2.3:5000", "", true},
+		{"11.0.0.1:5000", "", false},
+		{"[::ffff:10.1.2.3]:5000", "", true},
+		{"[::ffff:192.168.7.7]:5000", "", true},
+		{"192.168.7.7:5000", "", true},
+		{"192.169.0.1:5000", "", false},
+		{"[fd12::1]:5000", "", true},
+		{"[fe80::1%eth0]:5000", "", false},
+		{"203.0.113.5:443", "", true},
+		{"203.0.113.6:443", "", false},
+		{"198.51.100.1:5000", "10.0.0.1", false},
+		{"garbage", "", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		if tt.forwardedFor != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwardedFor)
+		}
+		if got := trustedRequest(r); got != tt.want {
+			t.Errorf("trustedRequest(%s, X-Forwarded-For %q) = %v, want %v", tt.remoteAddr, tt.forwardedFor, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Страница документации, читающая /api/openapi.json
+//
+//go:embed docs.html
+var docsPage []byte
+
+var (
+	openAPIOnce sync.Once
+	openAPIDoc  map[string]interface{}
+)
+
+// openAPISpec строит спецификацию OpenAPI 3 по списку маршрутов один раз
+func openAPISpec() map[string]interface{} {
+	openAPIOnce.Do(func() {
+		openAPIDoc = buildOpenAPISpec(apiRoutes())
+	})
+	return openAPIDoc
+}
+
+// schemaRegistry собирает именованные схемы для components/schemas
+type schemaRegistry struct {
+	schemas map[string]interface{}
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	durationType      = reflect.TypeOf(Duration{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// schemaFor возвращает схему для типа; именованные структуры выносятся в components
+func (reg *schemaRegistry) schemaFor(t reflect.Type) map[string]interface{} {
+	if t.Kind() == reflect.Pointer {
+		return reg.schemaFor(t.Elem())
+	}
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == durationType:
+		return map[string]interface{}{"type": "string", "format": "duration", "example": "1h30m"}
+	case t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType):
+		// Собственный MarshalJSON: поля структуры не описывают то, что уходит в JSON
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": reg.schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": reg.schemaFor(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return reg.structSchema(t)
+		}
+		if _, exists := reg.schemas[t.Name()]; !exists {
+			// Заглушка защищает от бесконечной рекурсии на ссылающихся на себя типах
+			reg.schemas[t.Name()] = map[string]interface{}{}
+			reg.schemas[t.Name()] = reg.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// structSchema описывает поля структуры по тегам json
+func (reg *schemaRegistry) structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := []string{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = reg.schemaFor(field.Type)
+		if !strings.Contains(options, "omitempty") && field.Type.Kind() != reflect.Pointer {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// jsonContent оборачивает схему в описание содержимого application/json
+func jsonContent(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{"schema": schema},
+	}
+}
+
+// buildOpenAPISpec формирует документ OpenAPI 3.0 из маршрутов
+func buildOpenAPISpec(routes []apiRoute) map[string]interface{} {
+	reg := &schemaRegistry{schemas: make(map[string]interface{})}
+	errorSchema := reg.schemaFor(reflect.TypeOf(errorResponse{}))
+	errorReply := func(description string) map[string]interface{} {
+		return map[string]interface{}{"description": description, "content": jsonContent(errorSchema)}
+	}
+	forbiddenReply := map[string]interface{}{
+		"description": "Role lacks the required permission",
+		"content":     jsonContent(reg.schemaFor(reflect.TypeOf(forbidden{}))),
+	}
+	unavailableReply := map[string]interface{}{
+		"description": "Action is closed by the current mode (readonly or maintenance)",
+		"content":     jsonContent(reg.schemaFor(reflect.TypeOf(modeUnavailable{}))),
+	}
+	adminSecurity := []map[string][]string{
+		{"adminSession": {}},
+		{"adminUser": {}, "adminPassword": {}},
+		{"adminToken": {}},
+	}
+
+	paths := make(map[string]interface{})
+	for _, route := range routes {
+		if route.Hidden {
+			continue
+		}
+
+		item := make(map[string]interface{})
+		for _, op := range route.Operations {
+			status := op.Status
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			success := map[string]interface{}{"description": http.StatusText(status)}
+			switch {
+			case status == http.StatusNoContent || status == http.StatusSwitchingProtocols:
+			case op.ContentType != "":
+				success["content"] = map[string]interface{}{
+					op.ContentType: map[string]interface{}{"schema": map[string]interface{}{"type": "string"}},
+				}
+			case op.Response != nil:
+				success["content"] = jsonContent(reg.schemaFor(reflect.TypeOf(op.Response)))
+			default:
+				success["content"] = jsonContent(map[string]interface{}{"type": "object"})
+			}
+
+			responses := map[string]interface{}{
+				strconv.Itoa(status): success,
+				"default":            errorReply("Error"),
+			}
+			if op.Request != nil {
+				responses["400"] = errorReply("Invalid request")
+			}
+			if op.Permission != "" {
+				responses["401"] = errorReply("Invalid credentials")
+				responses["403"] = forbiddenReply
+				if modeRestricts(op.Permission) {
+					responses["503"] = unavailableReply
+				}
+			}
+			if route.ModeCheck {
+				responses["404"] = errorReply("Not found or local mode is active")
+			}
+
+			operation := map[string]interface{}{
+				"summary":     op.Summary,
+				"operationId": operationID(op.Method, route.docPath()),
+				"responses":   responses,
+			}
+			if route.Tag != "" {
+				operation["tags"] = []string{route.Tag}
+			}
+			switch {
+			case op.Permission == "":
+			case isPublicPermission(op.Permission):
+				// В серверном режиме доступно без входа, в локальном - ролям с local:access
+				operation["security"] = append(append([]map[string][]string{}, adminSecurity...), map[string][]string{})
+				operation["description"] = "Permission " + op.Permission + "; public while the server mode is active"
+			default:
+				operation["security"] = adminSecurity
+				operation["description"] = "Permission " + op.Permission + ", roles: " + strings.Join(rolesWith(op.Permission), ", ")
+			}
+
+			if len(op.Params) > 0 {
+				params := make([]map[string]interface{}, 0, len(op.Params))
+				for _, p := range op.Params {
+					schema := map[string]interface{}{"type": p.Type}
+					if p.Format != "" {
+						schema["format"] = p.Format
+					}
+					params = append(params, map[string]interface{}{
+						"name":        p.Name,
+						"in":          p.In,
+						"required":    p.In == "path",
+						"description": p.Description,
+						"schema":      schema,
+					})
+				}
+				operation["parameters"] = params
+			}
+
+			if op.Request != nil {
+				operation["requestBody"] = map[string]interface{}{
+					"required": true,
+					"content":  jsonContent(reg.schemaFor(reflect.TypeOf(op.Request))),
+				}
+			}
+
+			item[strings.ToLower(op.Method)] = operation
+		}
+		paths[route.docPath()] = item
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "UserManager Pro API",
+			"description": "Go Backend API for UserManager Pro",
+			"version":     appVersion(),
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": reg.schemas,
+			"securitySchemes": map[string]interface{}{
+				"adminSession":  map[string]string{"type": "http", "scheme": "bearer", "description": "access_token из /api/v1/auth/login или API-ключ umk_..."},
+				"adminUser":     map[string]string{"type": "apiKey", "in": "header", "name": "X-Admin-User"},
+				"adminPassword": map[string]string{"type": "apiKey", "in": "header", "name": "X-Admin-Password"},
+				"adminToken":    map[string]string{"type": "apiKey", "in": "header", "name": "X-Admin-Token"},
+			},
+		},
+	}
+}
+
+// operationID строит идентификатор операции из метода и пути: GET /api/users/{id} -> getApiUsersId
+func operationID(method, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool {
+		return r == '/' || r == '{' || r == '}' || r == '-' || r == '.'
+	}) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+// Спецификация OpenAPI
+func apiOpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	sendJSON(w, http.StatusOK, openAPISpec())
+}
+
+// Страница документации API
+func apiDocsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(docsPage)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestSchemaForCustomJSON(t *testing.T) {
+	reg := &schemaRegistry{schemas: make(map[string]interface{})}
+	tests := []struct {
+		name  string
+		value interface{}
+		want  map[string]interface{}
+	}{
+		{"time", ModeSchedule{}.CreatedAt, map[string]interface{}{"type": "string", "format": "date-time"}},
+		{"duration", Duration{}, map[string]interface{}{"type": "string", "format": "duration", "example": "1h30m"}},
+		{"duration pointer", &Duration{}, map[string]interface{}{"type": "string", "format": "duration", "example": "1h30m"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reg.schemaFor(reflect.TypeOf(tt.value)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("schemaFor = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	reg.schemaFor(reflect.TypeOf(ModeSchedule{}))
+	properties := reg.schemas["ModeSchedule"].(map[string]interface{})["properties"].(map[string]interface{})
+	if got := properties["duration"].(map[string]interface{})["type"]; got != "string" {
+		t.Errorf("ModeSchedule.duration type = %v, want string", got)
+	}
+}
+
+func TestUserSchemas(t *testing.T) {
+	spec := buildOpenAPISpec(apiRoutes())
+	schemas := spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	required := func(name string) []string {
+		r, _ := schemas[name].(map[string]interface{})["required"].([]string)
+		return r
+	}
+
+	// Ответ описывает назначенные сервером поля, тело запроса - нет
+	if r := required("User"); !slices.Contains(r, "id") || !slices.Contains(r, "created_at") {
+		t.Errorf("User.required = %v, want id and created_at", r)
+	}
+	if r := required("userRequest"); slices.Contains(r, "id") || slices.Contains(r, "created_at") {
+		t.Errorf("userRequest.required = %v, must not contain server-assigned fields", r)
+	}
+
+	paths := spec["paths"].(map[string]interface{})
+	for path, method := range map[string]string{"/api/v1/users": "post", "/api/v1/users/{id}": "put"} {
+		operation := paths[path].(map[string]interface{})[method].(map[string]interface{})
+		body := operation["requestBody"].(map[string]interface{})["content"].(map[string]interface{})
+		schema := body["application/json"].(map[string]interface{})["schema"].(map[string]interface{})
+		if ref := schema["$ref"]; ref != "#/components/schemas/userRequest" {
+			t.Errorf("%s %s body = %v, want userRequest", method, path, ref)
+		}
+	}
+}
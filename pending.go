@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Самая долгая отсрочка смены режима
+const maxModeGrace = 15 * time.Minute
+
+var (
+	errModeChangePending = errors.New("another mode change is pending")
+	errNoPendingChange   = errors.New("no pending mode change")
+)
+
+// PendingModeChange - смена режима, ожидающая окончания отсрочки
+type PendingModeChange struct {
+	ID           string    `json:"id"`
+	Mode         string    `json:"mode"`
+	Message      string    `json:"message,omitempty"`
+	ChangedBy    string    `json:"changed_by"`
+	StartedAt    time.Time `json:"started_at"`
+	EffectiveAt  time.Time `json:"effective_at"`
+	Acknowledged []string  `json:"acknowledged"` // client_id подключений, приславших save_complete
+
+	change modeChange
+	// Подтверждения учитываются по соединению: client_id клиент выбирает сам,
+	// и одно соединение не должно подтверждать за другие
+	acks map[*websocket.Conn]time.Time
+	done chan struct{} // закрывается при отмене
+}
+
+var (
+	pendingMu   sync.Mutex
+	pendingMode *PendingModeChange
+)
+
+// parseGrace разбирает отсрочку смены режима
+func parseGrace(value string) (time.Duration, error) {
+	grace, err := parseOptionalDuration("grace", value, 0)
+	if err != nil {
+		return 0, err
+	}
+	if grace > maxModeGrace {
+		return 0, errors.New("grace must not exceed " + maxModeGrace.String())
+	}
+	return grace, nil
+}
+
+// acknowledged возвращает client_id подтвердивших подключений, которые еще открыты;
+// pendingMu должен быть захвачен
+func (p *PendingModeChange) acknowledged() []string {
+	ids := make([]string, 0, len(p.acks))
+	infoMu.RLock()
+	for conn := range p.acks {
+		if info, exists := clientInfo[conn]; exists {
+			ids = append(ids, info.ClientID)
+		}
+	}
+	infoMu.RUnlock()
+	sort.Strings(ids)
+	return ids
+}
+
+// snapshot возвращает копию для ответов API; pendingMu должен быть захвачен
+func (p *PendingModeChange) snapshot() PendingModeChange {
+	snapshot := *p
+	snapshot.Acknowledged = p.acknowledged()
+	return snapshot
+}
+
+// countdown возвращает данные сообщения mode_change_pending; pendingMu должен быть захвачен
+func (p *PendingModeChange) countdown(now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"id":           p.ID,
+		"mode":         p.Mode,
+		"message":      p.Message,
+		"changed_by":   p.ChangedBy,
+		"effective_at": p.EffectiveAt.UTC().Format(time.RFC3339),
+		"seconds_left": max(0, int(p.EffectiveAt.Sub(now).Round(time.Second).Seconds())),
+		"acknowledged": len(p.acknowledged()),
+		"clients":      clientCount(),
+	}
+}
+
+// startPendingMode откладывает смену режима на grace с обратным отсчетом для клиентов
+func startPendingMode(change modeChange, grace time.Duration) (PendingModeChange, error) {
+	now := time.Now()
+	pending := &PendingModeChange{
+		ID:          randomHex(6),
+		Mode:        change.Mode,
+		Message:     change.Message,
+		ChangedBy:   change.ChangedBy,
+		StartedAt:   now.UTC(),
+		EffectiveAt: now.Add(grace).UTC().Round(time.Second),
+		change:      change,
+		acks:        make(map[*websocket.Conn]time.Time),
+		done:        make(chan struct{}),
+	}
+
+	pendingMu.Lock()
+	if pendingMode != nil {
+		pendingMu.Unlock()
+		return PendingModeChange{}, errModeChangePending
+	}
+	pendingMode = pending
+	snapshot := pending.snapshot()
+	countdown := pending.countdown(now)
+	pendingMu.Unlock()
+
+	broadcastToAll("mode_change_pending", countdown)
+	backgroundWG.Add(1)
+	go func() {
+		defer backgroundWG.Done()
+		runPendingMode(backgroundCtx, pending)
+	}()
+	return snapshot, nil
+}
+
+// runPendingMode раз в секунду рассылает обратный отсчет и применяет смену режима,
+// когда отсрочка истекла. Подтверждения save_complete отсрочку не сокращают: до конца
+// отсчета администратор может отменить смену. При остановке сервера смена режима
+// не применяется: после перезапуска сервер все равно начнет с режима по умолчанию
+func runPendingMode(ctx context.Context, pending *PendingModeChange) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	timer := time.NewTimer(time.Until(pending.EffectiveAt))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-pending.done:
+			return
+		case <-timer.C:
+			finishPendingMode(pending)
+			return
+		case now := <-ticker.C:
+			pendingMu.Lock()
+			if pendingMode != pending {
+				pendingMu.Unlock()
+				return
+			}
+			countdown := pending.countdown(now)
+			pendingMu.Unlock()
+			broadcastToAll("mode_change_pending", countdown)
+		}
+	}
+}
+
+// finishPendingMode применяет отложенную смену режима, если ее не отменили
+func finishPendingMode(pending *PendingModeChange) {
+	pendingMu.Lock()
+	if pendingMode != pending {
+		pendingMu.Unlock()
+		return
+	}
+	pendingMode = nil
+	acknowledged := len(pending.acks)
+	pendingMu.Unlock()
+
+	change := pending.change
+	if change.Source == modeSourceAPI {
+		change.Source = modeSourceGrace
+	}
+	oldMode, _ := switchMode(change)
+	logMode.Info("отложенная смена режима применена",
+		"change_id", pending.ID, "old_mode", oldMode, "new_mode", pending.Mode,
+		"admin", pending.ChangedBy, "acknowledged", acknowledged, "clients", clientCount())
+}
+
+// cancelPendingMode отменяет ожидающую смену режима и сообщает об этом клиентам
+func cancelPendingMode(cancelledBy string) (PendingModeChange, error) {
+	pendingMu.Lock()
+	pending := pendingMode
+	if pending == nil {
+		pendingMu.Unlock()
+		return PendingModeChange{}, errNoPendingChange
+	}
+	pendingMode = nil
+	close(pending.done)
+	snapshot := pending.snapshot()
+	pendingMu.Unlock()
+
+	broadcastToAll("mode_change_cancelled", map[string]interface{}{
+		"id":           pending.ID,
+		"mode":         pending.Mode,
+		"cancelled_by": cancelledBy,
+		"time":         time.Now().Unix(),
+	})
+	return snapshot, nil
+}
+
+// currentPendingMode возвращает ожидающую смену режима
+func currentPendingMode() (PendingModeChange, bool) {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+	if pendingMode == nil {
+		return PendingModeChange{}, false
+	}
+	return pendingMode.snapshot(), true
+}
+
+// acknowledgePendingMode отмечает save_complete соединения; число подтверждений
+// видно администраторам в обратном отсчете и GET /api/v1/admin/mode/pending
+func acknowledgePendingMode(changeID string, conn *websocket.Conn) bool {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+	pending := pendingMode
+	if pending == nil || (changeID != "" && changeID != pending.ID) {
+		return false
+	}
+	infoMu.RLock()
+	_, connected := clientInfo[conn]
+	infoMu.RUnlock()
+	if !connected {
+		return false
+	}
+	pending.acks[conn] = time.Now()
+	return true
+}
+
+// GET /api/v1/admin/mode/pending
+func getPendingModeHandler(w http.ResponseWriter, r *http.Request) {
+	pending, exists := currentPendingMode()
+	if !exists {
+		sendError(w, http.StatusNotFound, "No pending mode change")
+		return
+	}
+	sendJSON(w, http.StatusOK, pending)
+}
+
+// DELETE /api/v1/admin/mode/pending
+func cancelPendingModeHandler(w http.ResponseWriter, r *http.Request) {
+	adminName, _ := requestRole(r)
+	pending, err := cancelPendingMode(adminName)
+	if err != nil {
+		sendError(w, http.StatusNotFound, "No pending mode change")
+		return
+	}
+
+	logMode.InfoContext(r.Context(), "отложенная смена режима отменена",
+		"change_id", pending.ID, "mode", pending.Mode, "admin", adminName, "acknowledged", len(pending.Acknowledged))
+	sendJSON(w, http.StatusOK, pending)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// useTestClients регистрирует подключения с заданными client_id без настоящих соединений
+func useTestClients(t *testing.T, clientIDs ...string) []*websocket.Conn {
+	t.Helper()
+	conns := make([]*websocket.Conn, len(clientIDs))
+	infoMu.Lock()
+	saved := clientInfo
+	clientInfo = make(map[*websocket.Conn]*ClientData)
+	for i, clientID := range clientIDs {
+		conns[i] = new(websocket.Conn)
+		clientInfo[conns[i]] = &ClientData{ClientID: clientID}
+	}
+	infoMu.Unlock()
+	t.Cleanup(func() {
+		infoMu.Lock()
+		clientInfo = saved
+		infoMu.Unlock()
+	})
+	return conns
+}
+
+// usePendingChange делает change ожидающей сменой режима без горутины обратного отсчета
+func usePendingChange(t *testing.T, id string) *PendingModeChange {
+	t.Helper()
+	pending := &PendingModeChange{
+		ID:   id,
+		Mode: modeMaintenance,
+		acks: make(map[*websocket.Conn]time.Time),
+		done: make(chan struct{}),
+	}
+	pendingMu.Lock()
+	pendingMode = pending
+	pendingMu.Unlock()
+	t.Cleanup(func() {
+		pendingMu.Lock()
+		pendingMode = nil
+		pendingMu.Unlock()
+	})
+	return pending
+}
+
+func TestAcknowledgePendingMode(t *testing.T) {
+	type ack struct {
+		changeID string
+		conn     int // индекс подключения; -1 - неизвестное соединение
+		accepted bool
+	}
+	tests := []struct {
+		name    string
+		clients []string
+		acks    []ack
+		acked   int
+	}{
+		{
+			name:    "all connections acknowledged",
+			clients: []string{"a", "b"},
+			acks:    []ack{{"change", 0, true}, {"", 1, true}},
+			acked:   2,
+		},
+		{
+			name:    "one connection does not acknowledge for others with the same client_id",
+			clients: []string{"same", "same", "same"},
+			acks:    []ack{{"change", 0, true}, {"change", 0, true}},
+			acked:   1,
+		},
+		{
+			name:    "repeated acknowledgement of one connection",
+			clients: []string{"a", "b"},
+			acks:    []ack{{"change", 1, true}, {"change", 1, true}},
+			acked:   1,
+		},
+		{
+			name:    "stale change id is rejected",
+			clients: []string{"a"},
+			acks:    []ack{{"previous", 0, false}},
+			acked:   0,
+		},
+		{
+			name:    "unknown connection is rejected",
+			clients: []string{"a"},
+			acks:    []ack{{"change", -1, false}},
+			acked:   0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conns := useTestClients(t, tt.clients...)
+			usePendingChange(t, "change")
+
+			for _, a := range tt.acks {
+				conn := new(websocket.Conn)
+				if a.conn >= 0 {
+					conn = conns[a.conn]
+				}
+				if got := acknowledgePendingMode(a.changeID, conn); got != a.accepted {
+					t.Errorf("acknowledgePendingMode(%q, #%d) = %v, want %v", a.changeID, a.conn, got, a.accepted)
+				}
+			}
+			if snapshot, _ := currentPendingMode(); len(snapshot.Acknowledged) != tt.acked {
+				t.Errorf("acknowledged = %v, want %d connections", snapshot.Acknowledged, tt.acked)
+			}
+		})
+	}
+}
+
+func TestPendingCountdownIgnoresDisconnectedAcks(t *testing.T) {
+	conns := useTestClients(t, "a", "b", "c")
+	pending := usePendingChange(t, "change")
+	for _, conn := range conns[:2] {
+		if !acknowledgePendingMode("change", conn) {
+			t.Fatal("acknowledgement rejected")
+		}
+	}
+
+	// Подтвердившее подключение закрылось до конца отсчета
+	infoMu.Lock()
+	delete(clientInfo, conns[0])
+	infoMu.Unlock()
+
+	pendingMu.Lock()
+	countdown := pending.countdown(time.Now())
+	snapshot := pending.snapshot()
+	pendingMu.Unlock()
+	if countdown["acknowledged"] != 1 {
+		t.Errorf("countdown acknowledged = %v, want 1", countdown["acknowledged"])
+	}
+	if len(snapshot.Acknowledged) != 1 || snapshot.Acknowledged[0] != "b" {
+		t.Errorf("snapshot acknowledged = %v, want [b]", snapshot.Acknowledged)
+	}
+}
+
+func TestRunPendingModeStopsOnShutdown(t *testing.T) {
+	useTestClients(t)
+	pending := usePendingChange(t, "change")
+	pending.EffectiveAt = time.Now().Add(time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := make(chan struct{})
+	go func() {
+		runPendingMode(ctx, pending)
+		close(finished)
+	}()
+	cancel()
+
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("runPendingMode did not stop after the context was cancelled")
+	}
+	if currentModeState().Mode == modeMaintenance {
+		t.Fatal("pending change was applied during shutdown")
+	}
+}
+
+func TestRunPendingModeWaitsForGraceAfterAllAcknowledged(t *testing.T) {
+	conns := useTestClients(t, "admin", "viewer")
+	pending := usePendingChange(t, "change")
+	pending.EffectiveAt = time.Now().Add(time.Hour)
+	for _, conn := range conns {
+		acknowledgePendingMode("change", conn)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := make(chan struct{})
+	go func() {
+		runPendingMode(ctx, pending)
+		close(finished)
+	}()
+	defer func() {
+		cancel()
+		<-finished
+	}()
+
+	// Первый тик обратного отсчета приходит через секунду
+	time.Sleep(1200 * time.Millisecond)
+	if current, exists := currentPendingMode(); !exists || current.ID != "change" {
+		t.Fatal("change was applied before the grace period ended")
+	}
+	if currentModeState().Mode == modeMaintenance {
+		t.Fatal("mode changed before the grace period ended")
+	}
+}
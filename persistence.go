@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// dataPath возвращает путь к файлу в каталоге данных
+func dataPath(name string) string {
+	return filepath.Join(cfg.DataDir, name)
+}
+
+// saveJSONFile атомарно записывает v в файл через временный файл и переименование
+func saveJSONFile(path string, v interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// loadJSONFile читает файл в v; отсутствие файла не считается ошибкой
+func loadJSONFile(path string, v interface{}) (bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+// dbSnapshot - сохраняемое состояние базы
+type dbSnapshot struct {
+	NextID int    `json:"next_id"`
+	Users  []User `json:"users"`
+}
+
+// Save сохраняет пользователей в файл
+func (db *InMemoryDB) Save(path string) error {
+	db.mutex.RLock()
+	snapshot := dbSnapshot{NextID: db.nextID, Users: make([]User, 0, len(db.users))}
+	for _, user := range db.users {
+		snapshot.Users = append(snapshot.Users, user)
+	}
+	db.mutex.RUnlock()
+
+	return saveJSONFile(path, snapshot)
+}
+
+// Load заменяет содержимое базы данными из файла, если он существует
+func (db *InMemoryDB) Load(path string) (bool, error) {
+	var snapshot dbSnapshot
+	found, err := loadJSONFile(path, &snapshot)
+	if err != nil || !found {
+		return false, err
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	db.users = make(map[int]User, len(snapshot.Users))
+	db.nextID = snapshot.NextID
+	for _, user := range snapshot.Users {
+		db.users[user.ID] = user
+		if user.ID >= db.nextID {
+			db.nextID = user.ID + 1
+		}
+	}
+	return true, nil
+}
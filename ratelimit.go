@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Классы маршрутов с отдельными лимитами
+const (
+	rateClassRead      = "read"
+	rateClassWrite     = "write"
+	rateClassAdmin     = "admin"
+	rateClassWSConnect = "ws_connect"
+)
+
+var rateClasses = []string{rateClassRead, rateClassWrite, rateClassAdmin, rateClassWSConnect}
+
+// RateLimit - параметры token bucket для одного класса маршрутов
+type RateLimit struct {
+	PerMinute int `json:"per_minute"` // скорость пополнения; 0 - без ограничения
+	Burst     int `json:"burst"`      // емкость корзины
+}
+
+// RateLimitConfig - лимиты запросов с одного IP
+type RateLimitConfig struct {
+	Enabled   bool      `json:"enabled"`
+	Read      RateLimit `json:"read"`
+	Write     RateLimit `json:"write"`
+	Admin     RateLimit `json:"admin"`
+	WSConnect RateLimit `json:"ws_connect"`
+}
+
+// class возвращает лимит класса маршрутов
+func (c *RateLimitConfig) class(name string) *RateLimit {
+	switch name {
+	case rateClassRead:
+		return &c.Read
+	case rateClassWrite:
+		return &c.Write
+	case rateClassAdmin:
+		return &c.Admin
+	case rateClassWSConnect:
+		return &c.WSConnect
+	}
+	return nil
+}
+
+// tokenBucket - корзина одного клиента
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// rateLimiter ограничивает запросы одного класса по IP клиента
+type rateLimiter struct {
+	limit    RateLimit
+	mu       sync.Mutex
+	buckets  map[string]*tokenBucket
+	rejected uint64
+}
+
+// rateLimiters создаются в setupRateLimits; пустая карта - ограничения выключены
+var rateLimiters = map[string]*rateLimiter{}
+
+// setupRateLimits создает ограничители по конфигурации
+func setupRateLimits(c RateLimitConfig) {
+	limiters := make(map[string]*rateLimiter)
+	if c.Enabled {
+		for _, class := range rateClasses {
+			limit := *c.class(class)
+			if limit.PerMinute > 0 {
+				limiters[class] = &rateLimiter{limit: limit, buckets: make(map[string]*tokenBucket)}
+			}
+		}
+	}
+	rateLimiters = limiters
+}
+
+// ratePerSecond - скорость пополнения корзины
+func (l *rateLimiter) ratePerSecond() float64 {
+	return float64(l.limit.PerMinute) / 60
+}
+
+// refill пополняет корзину на момент now
+func (l *rateLimiter) refill(bucket *tokenBucket, now time.Time) {
+	elapsed := now.Sub(bucket.updated).Seconds()
+	bucket.tokens = math.Min(float64(l.limit.Burst), bucket.tokens+elapsed*l.ratePerSecond())
+	bucket.updated = now
+}
+
+// allow списывает токен; при отказе возвращает время до появления следующего токена
+func (l *rateLimiter) allow(key string, now time.Time) (bool, int, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket, exists := l.buckets[key]
+	if !exists {
+		bucket = &tokenBucket{tokens: float64(l.limit.Burst), updated: now}
+		l.buckets[key] = bucket
+	}
+	l.refill(bucket, now)
+
+	if bucket.tokens < 1 {
+		l.rejected++
+		wait := time.Duration((1 - bucket.tokens) / l.ratePerSecond() * float64(time.Second))
+		return false, 0, wait
+	}
+	bucket.tokens--
+	return true, int(bucket.tokens), 0
+}
+
+// prune удаляет полностью пополнившиеся корзины, чтобы карта не росла бесконечно
+func (l *rateLimiter) prune(now time.Time) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	removed := 0
+	for key, bucket := range l.buckets {
+		l.refill(bucket, now)
+		if bucket.tokens >= float64(l.limit.Burst) {
+			delete(l.buckets, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// rateLimitStats - состояние ограничителя для /api/stats
+type rateLimitStats struct {
+	PerMinute int      `json:"per_minute"`
+	Burst     int      `json:"burst"`
+	Tracked   int      `json:"tracked_clients"`
+	Throttled int      `json:"throttled_clients"`
+	Clients   []string `json:"throttled_ips,omitempty"` // только для администратора
+	Rejected  uint64   `json:"rejected_total"`
+}
+
+func (l *rateLimiter) stats(now time.Time, withClients bool) rateLimitStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stats := rateLimitStats{
+		PerMinute: l.limit.PerMinute,
+		Burst:     l.limit.Burst,
+		Tracked:   len(l.buckets),
+		Rejected:  l.rejected,
+	}
+	for key, bucket := range l.buckets {
+		l.refill(bucket, now)
+		if bucket.tokens < 1 {
+			stats.Throttled++
+			if withClients {
+				stats.Clients = append(stats.Clients, key)
+			}
+		}
+	}
+	sort.Strings(stats.Clients)
+	return stats
+}
+
+// rateLimitSnapshot возвращает состояние всех ограничителей; IP клиентов - только по запросу
+func rateLimitSnapshot(withClients bool) map[string]rateLimitStats {
+	now := time.Now()
+	snapshot := make(map[string]rateLimitStats, len(rateLimiters))
+	for class, limiter := range rateLimiters {
+		snapshot[class] = limiter.stats(now, withClients)
+	}
+	return snapshot
+}
+
+// rateLimit ограничивает частоту запросов класса class с одного IP
+func rateLimit(class string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limiter, exists := rateLimiters[class]
+		if !exists {
+			next(w, r)
+			return
+		}
+
+		ip := clientIP(r)
+		allowed, remaining, retryAfter := limiter.allow(ip, time.Now())
+
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limiter.limit.Burst))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("X-RateLimit-Policy", fmt.Sprintf("%d;w=60;burst=%d", limiter.limit.PerMinute, limiter.limit.Burst))
+
+		if !allowed {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			w.Header().Set("X-RateLimit-Reset", strconv.Itoa(seconds))
+			logHTTP.DebugContext(r.Context(), "превышен лимит запросов",
+				"class", class, "client_ip", ip, "path", r.URL.Path, "retry_after", seconds)
+			sendError(w, http.StatusTooManyRequests, "Too many requests")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// startRateLimitCleanup периодически удаляет корзины неактивных клиентов
+func startRateLimitCleanup(ctx context.Context) {
+	if len(rateLimiters) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(cfg.CleanupInterval.Duration)
+	backgroundWG.Add(1)
+	go func() {
+		defer backgroundWG.Done()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				now := time.Now()
+				for _, limiter := range rateLimiters {
+					limiter.prune(now)
+				}
+			}
+		}
+	}()
+}
+
+// writeRateLimitMetrics выводит счетчики отказов по классам
+func writeRateLimitMetrics(w io.Writer) {
+	fmt.Fprintln(w, "# HELP usermanager_rate_limited_total Requests rejected by the per-IP rate limiter.")
+	fmt.Fprintln(w, "# TYPE usermanager_rate_limited_total counter")
+	for _, class := range rateClasses {
+		limiter, exists := rateLimiters[class]
+		if !exists {
+			continue
+		}
+		limiter.mu.Lock()
+		rejected := limiter.rejected
+		limiter.mu.Unlock()
+		fmt.Fprintf(w, "usermanager_rate_limited_total{class=\"%s\"} %d\n", class, rejected)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	start := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	type step struct {
+		after     time.Duration // от начала теста
+		key       string
+		allowed   bool
+		remaining int
+		wait      time.Duration
+	}
+	tests := []struct {
+		name  string
+		limit RateLimit
+		steps []step
+	}{
+		{
+			name:  "burst then reject",
+			limit: RateLimit{PerMinute: 60, Burst: 3},
+			steps: []step{
+				{0, "a", true, 2, 0},
+				{0, "a", true, 1, 0},
+				{0, "a", true, 0, 0},
+				{0, "a", false, 0, time.Second},
+				{500 * time.Millisecond, "a", false, 0, 500 * time.Millisecond},
+			},
+		},
+		{
+			name:  "refill one token per interval",
+			limit: RateLimit{PerMinute: 60, Burst: 1},
+			steps: []step{
+				{0, "a", true, 0, 0},
+				{time.Second, "a", true, 0, 0},
+				{time.Second, "a", false, 0, time.Second},
+			},
+		},
+		{
+			name:  "refill never exceeds burst",
+			limit: RateLimit{PerMinute: 600, Burst: 2},
+			steps: []step{
+				{0, "a", true, 1, 0},
+				{time.Hour, "a", true, 1, 0},
+				{time.Hour, "a", true, 0, 0},
+				{time.Hour, "a", false, 0, 100 * time.Millisecond},
+			},
+		},
+		{
+			name:  "clients have separate buckets",
+			limit: RateLimit{PerMinute: 1, Burst: 1},
+			steps: []step{
+				{0, "a", true, 0, 0},
+				{0, "a", false, 0, time.Minute},
+				{0, "b", true, 0, 0},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := &rateLimiter{limit: tt.limit, buckets: make(map[string]*tokenBucket)}
+			for i, s := range tt.steps {
+				allowed, remaining, wait := limiter.allow(s.key, start.Add(s.after))
+				if allowed != s.allowed || remaining != s.remaining || wait.Round(time.Millisecond) != s.wait {
+					t.Errorf("step %d: allow = %v, %d, %v; want %v, %d, %v",
+						i, allowed, remaining, wait, s.allowed, s.remaining, s.wait)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterPrune(t *testing.T) {
+	start := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	limiter := &rateLimiter{limit: RateLimit{PerMinute: 60, Burst: 5}, buckets: make(map[string]*tokenBucket)}
+	limiter.allow("idle", start)
+	limiter.allow("busy", start.Add(4*time.Second))
+	for i := 0; i < 5; i++ {
+		limiter.allow("busy", start.Add(5*time.Second))
+	}
+
+	limiter.prune(start.Add(5 * time.Second))
+	if _, exists := limiter.buckets["idle"]; exists {
+		t.Error("refilled bucket was not pruned")
+	}
+	if _, exists := limiter.buckets["busy"]; !exists {
+		t.Error("drained bucket was pruned")
+	}
+}
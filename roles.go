@@ -0,0 +1,237 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Роли учетных записей
+const (
+	roleViewer  = "viewer"
+	roleEditor  = "editor"
+	roleAdmin   = "admin"
+	roleAuditor = "auditor"
+
+	// Роли, которые не назначаются учетным записям: запрос без учетных данных
+	// и API-ключ, права которого задаются его scopes
+	roleAnonymous = "anonymous"
+	roleAPIKey    = "apikey"
+)
+
+// Разрешения, проверяемые middleware маршрутов
+const (
+	permUsersRead     = "users:read"
+	permUsersWrite    = "users:write"
+	permUsersBulk     = "users:bulk"
+	permUsersExport   = "users:export"
+	permModeWrite     = "mode:write"
+	permClientsRead   = "clients:read"
+	permAuditRead     = "audit:read"
+	permSettingsWrite = "settings:write"
+	permAPIKeysManage = "apikeys:manage"
+
+	// Доступ к данным в локальном режиме
+	permLocalAccess = "local:access"
+)
+
+// rolePermissions - матрица разрешений ролей
+var rolePermissions = map[string][]string{
+	roleViewer:  {permUsersRead, permLocalAccess},
+	roleEditor:  {permUsersRead, permUsersWrite, permUsersBulk, permUsersExport, permLocalAccess},
+	roleAuditor: {permUsersRead, permUsersExport, permClientsRead, permAuditRead, permLocalAccess},
+	roleAdmin: {
+		permUsersRead, permUsersWrite, permUsersBulk, permUsersExport, permModeWrite,
+		permClientsRead, permAuditRead, permSettingsWrite, permAPIKeysManage, permLocalAccess,
+	},
+}
+
+// publicPermissions есть у всех, пока действует серверный режим. Изменение пользователей
+// требует роли не ниже editor: иначе роли viewer и editor ничем бы не отличались
+var publicPermissions = []string{permUsersRead}
+
+// validRole сообщает, можно ли назначить роль учетной записи
+func validRole(role string) bool {
+	_, exists := rolePermissions[role]
+	return exists
+}
+
+// roleNames возвращает назначаемые роли по алфавиту
+func roleNames() []string {
+	names := make([]string, 0, len(rolePermissions))
+	for role := range rolePermissions {
+		names = append(names, role)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// isPublicPermission сообщает, доступно ли разрешение без входа в серверном режиме
+func isPublicPermission(permission string) bool {
+	return grants(publicPermissions, permission)
+}
+
+// isAdminPermission сообщает, относится ли разрешение к администрированию, а не к
+// работе с данными пользователей, которая доступна роли editor
+func isAdminPermission(permission string) bool {
+	return !grants(rolePermissions[roleEditor], permission)
+}
+
+// permissionsFor возвращает разрешения учетной записи или ключа с учетом режима
+func permissionsFor(name, role, mode string) []string {
+	set := make(map[string]bool)
+	for _, permission := range rolePermissions[role] {
+		set[permission] = true
+	}
+	if id, ok := apiKeyPrincipal(name); ok && role == roleAPIKey {
+		if key, exists := apiKeys.Get(id); exists && key.active(time.Now()) {
+			for _, scope := range key.Scopes {
+				set[scope] = true
+			}
+			set[permLocalAccess] = true
+		}
+	}
+	for _, permission := range modePolicies[mode].Public {
+		set[permission] = true
+	}
+
+	permissions := make([]string, 0, len(set))
+	for permission := range set {
+		permissions = append(permissions, permission)
+	}
+	sort.Strings(permissions)
+	return permissions
+}
+
+// requestRole возвращает имя и роль автора запроса; без верных учетных данных - anonymous
+func requestRole(r *http.Request) (string, string) {
+	name, ok := authenticateAdmin(r)
+	if !ok {
+		return "", roleAnonymous
+	}
+	return name, roleOf(name)
+}
+
+// roleOf возвращает роль подтвержденной учетной записи; admin_token действует как admin
+func roleOf(name string) string {
+	if name == adminTokenName {
+		return roleAdmin
+	}
+	if _, ok := apiKeyPrincipal(name); ok {
+		return roleAPIKey
+	}
+	return admins.Role(name)
+}
+
+// allows сообщает, есть ли разрешение у учетной записи или ключа в режиме mode
+func allows(name, role, permission, mode string) bool {
+	if role == roleAPIKey && apiKeyAllows(name, permission) {
+		return true
+	}
+	if roleAllows(role, permission) {
+		return true
+	}
+	return grants(modePolicies[mode].Public, permission)
+}
+
+// roleAllows сообщает, выдано ли разрешение роли без учета режима
+func roleAllows(role, permission string) bool {
+	return grants(rolePermissions[role], permission)
+}
+
+// hasPermission проверяет разрешение автора запроса в текущем режиме
+func hasPermission(r *http.Request, permission string) bool {
+	modeMutex.RLock()
+	currentMode := serverMode
+	modeMutex.RUnlock()
+
+	name, role := requestRole(r)
+	if allows(name, role, permission, currentMode) {
+		return true
+	}
+	return trustedAllows(r, permission, currentMode)
+}
+
+// trustedAllows - доверенная сеть работает в режиме, скрывающем данные, как в серверном
+func trustedAllows(r *http.Request, permission, mode string) bool {
+	if !modePolicies[mode].HideData || !trustedRequest(r) {
+		return false
+	}
+	return permission == permLocalAccess || isPublicPermission(permission)
+}
+
+// hasAdminCredentials сообщает, передал ли запрос учетные данные
+func hasAdminCredentials(r *http.Request) bool {
+	return r.Header.Get("Authorization") != "" || r.Header.Get("X-Admin-Token") != "" ||
+		r.Header.Get("X-Admin-Password") != ""
+}
+
+// forbidden - единый ответ на отказ в доступе
+type forbidden struct {
+	Error      string `json:"error"`
+	Permission string `json:"permission"`
+	Role       string `json:"role"`
+	RequestID  string `json:"request_id,omitempty"`
+}
+
+// forbid отвечает 403 с недостающим разрешением и ролью запроса
+func forbid(w http.ResponseWriter, r *http.Request, permission string) {
+	name, role := requestRole(r)
+	forbidRole(w, r, name, role, permission)
+}
+
+// forbidRole отвечает 403 для уже известной учетной записи (например, вошедшей паролем в теле)
+func forbidRole(w http.ResponseWriter, r *http.Request, name, role, permission string) {
+	logHTTP.InfoContext(r.Context(), "доступ запрещен",
+		"path", r.URL.Path, "permission", permission, "role", role, "admin", name, "client_ip", clientIP(r))
+	sendJSON(w, http.StatusForbidden, forbidden{
+		Error:      "Forbidden",
+		Permission: permission,
+		Role:       role,
+		RequestID:  requestIDFrom(r.Context()),
+	})
+}
+
+// requirePermission пропускает запрос только с разрешением. Неверные учетные данные
+// и блокировка по-прежнему дают 401/429, данные локального режима скрываются за 404
+func requirePermission(permission string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if hasPermission(r, permission) {
+			next(w, r)
+			return
+		}
+		switch {
+		case hasAdminCredentials(r) && !checkAuthenticated(r):
+			denyAdmin(w, r)
+		case isPublicPermission(permission) && localModeDenied(w, r):
+		default:
+			forbid(w, r, permission)
+		}
+	}
+}
+
+// checkAuthenticated сообщает, подтверждены ли учетные данные запроса
+func checkAuthenticated(r *http.Request) bool {
+	_, ok := authenticateAdmin(r)
+	return ok
+}
+
+// permissionSummary описывает требование разрешения для /api/info
+func permissionSummary(permission string) string {
+	if isPublicPermission(permission) {
+		return ""
+	}
+	return " (requires " + permission + ": " + strings.Join(rolesWith(permission), ", ") + ")"
+}
+
+// rolesWith возвращает роли, которым выдано разрешение
+func rolesWith(permission string) []string {
+	roles := make([]string, 0)
+	for _, role := range roleNames() {
+		if roleAllows(role, permission) {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// allPermissions - все разрешения, проверяемые middleware
+var allPermissions = []string{
+	permUsersRead, permUsersWrite, permUsersBulk, permUsersExport, permModeWrite,
+	permClientsRead, permAuditRead, permSettingsWrite, permAPIKeysManage, permLocalAccess,
+}
+
+func TestRolePermissionMatrix(t *testing.T) {
+	tests := []struct {
+		role string
+		mode string
+		want []string
+	}{
+		{roleAnonymous, modeServer, []string{permUsersRead}},
+		{roleAnonymous, modeReadonly, []string{permUsersRead}},
+		{roleAnonymous, modeLocal, nil},
+		{roleAnonymous, modeMaintenance, nil},
+		{roleViewer, modeServer, []string{permUsersRead, permLocalAccess}},
+		{roleEditor, modeServer, []string{permUsersRead, permUsersWrite, permUsersBulk, permUsersExport, permLocalAccess}},
+		{roleAuditor, modeServer, []string{permUsersRead, permUsersExport, permClientsRead, permAuditRead, permLocalAccess}},
+		{roleAdmin, modeServer, allPermissions},
+		// Режим не отнимает разрешения роли: ограничения режима проверяет modeBlocked
+		{roleViewer, modeLocal, []string{permUsersRead, permLocalAccess}},
+		{roleEditor, modeReadonly, []string{permUsersRead, permUsersWrite, permUsersBulk, permUsersExport, permLocalAccess}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.role+"/"+tt.mode, func(t *testing.T) {
+			want := make(map[string]bool)
+			for _, permission := range tt.want {
+				want[permission] = true
+			}
+			for _, permission := range allPermissions {
+				if got := allows("", tt.role, permission, tt.mode); got != want[permission] {
+					t.Errorf("allows(%s, %s) = %v, want %v", tt.role, permission, got, want[permission])
+				}
+			}
+
+			expected := append([]string(nil), tt.want...)
+			sort.Strings(expected)
+			if got := permissionsFor("", tt.role, tt.mode); strings.Join(got, ",") != strings.Join(expected, ",") {
+				t.Errorf("permissionsFor = %v, want %v", got, expected)
+			}
+		})
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	useTestConfig(t)
+	useTestSessions(t)
+	resetAuthAttempts(t)
+	cfg.AdminToken = strings.Repeat("t", minAdminTokenLength)
+	sessions := make(map[string]string)
+	for _, role := range roleNames() {
+		addTestAdmin(t, role+"-user", role)
+		sessions[role] = issueSession(role + "-user").AccessToken
+	}
+	bearer := func(role string) map[string]string {
+		return map[string]string{"Authorization": "Bearer " + sessions[role]}
+	}
+
+	tests := []struct {
+		name       string
+		mode       string
+		permission string
+		headers    map[string]string
+		status     int
+		role       string // роль в теле 403
+	}{
+		{"anonymous reads users", modeServer, permUsersRead, nil, http.StatusOK, ""},
+		{"anonymous cannot write users", modeServer, permUsersWrite, nil, http.StatusForbidden, roleAnonymous},
+		{"viewer cannot write users", modeServer, permUsersWrite, bearer(roleViewer), http.StatusForbidden, roleViewer},
+		{"editor writes users", modeServer, permUsersWrite, bearer(roleEditor), http.StatusOK, ""},
+		{"auditor cannot write users", modeServer, permUsersWrite, bearer(roleAuditor), http.StatusForbidden, roleAuditor},
+		{"editor cannot change mode", modeServer, permModeWrite, bearer(roleEditor), http.StatusForbidden, roleEditor},
+		{"auditor reads clients", modeServer, permClientsRead, bearer(roleAuditor), http.StatusOK, ""},
+		{"admin changes settings", modeServer, permSettingsWrite, bearer(roleAdmin), http.StatusOK, ""},
+		{"static token acts as admin", modeServer, permAPIKeysManage, map[string]string{"X-Admin-Token": cfg.AdminToken}, http.StatusOK, ""},
+		{"wrong static token", modeServer, permUsersWrite, map[string]string{"X-Admin-Token": "wrong"}, http.StatusUnauthorized, ""},
+		{"forged session", modeServer, permUsersWrite, map[string]string{"Authorization": "Bearer forged.token"}, http.StatusUnauthorized, ""},
+		{"local mode hides data from anonymous", modeLocal, permUsersRead, nil, http.StatusNotFound, ""},
+		{"local mode shows data to viewer", modeLocal, permUsersRead, bearer(roleViewer), http.StatusOK, ""},
+		{"local mode anonymous admin route", modeLocal, permClientsRead, nil, http.StatusForbidden, roleAnonymous},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestMode(t, tt.mode)
+			handler := requirePermission(tt.permission, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/test", nil)
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			rec := httptest.NewRecorder()
+			withRequestID(handler)(rec, r)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.status == http.StatusForbidden {
+				var body forbidden
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+					t.Fatal(err)
+				}
+				if body.Error != "Forbidden" || body.Permission != tt.permission || body.Role != tt.role || body.RequestID == "" {
+					t.Errorf("403 body = %+v", body)
+				}
+			}
+		})
+	}
+}
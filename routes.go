@@ -0,0 +1,471 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiParam - параметр пути или строки запроса
+type apiParam struct {
+	Name        string
+	In          string // "path" или "query"
+	Type        string // тип OpenAPI: string, integer, boolean
+	Format      string
+	Description string
+}
+
+// apiOperation - метод маршрута с обработчиком и описанием для /api/info и OpenAPI
+type apiOperation struct {
+	Method      string
+	Summary     string
+	Handler     http.HandlerFunc
+	Permission  string // проверяется requirePermission; публичные разрешения доступны без входа в серверном режиме
+	Params      []apiParam
+	Request     interface{} // значение типа тела запроса
+	Response    interface{} // значение типа тела ответа; nil - произвольный объект
+	ContentType string      // тип ответа, по умолчанию application/json
+	Status      int         // код успешного ответа, по умолчанию 200
+}
+
+// apiRoute - путь API с набором методов
+type apiRoute struct {
+	Path       string // путь внутри версии (/users/{id}) или полный путь для маршрутов вне версий
+	Version    string // версия API ("v1"); пусто - маршрут вне версий (/ws, /metrics, /)
+	Legacy     bool   // старый путь /api<Path> остается устаревшим псевдонимом
+	Tag        string
+	ModeCheck  bool // страница фронтенда проверяется checkModeMiddleware; маршруты с Permission - всегда
+	NoCORS     bool
+	CORS       string // политика CORS: corsDefault, corsAdmin, corsPublic; для /admin/ и /auth/ - corsAdmin
+	WebSocket  bool
+	AnyMethod  bool // регистрируется без метода, обработчик сам проверяет метод
+	Hidden     bool // не попадает в OpenAPI
+	Operations []apiOperation
+}
+
+// docPath возвращает полный путь маршрута
+func (route apiRoute) docPath() string {
+	if route.Version == "" {
+		return route.Path
+	}
+	return "/api/" + route.Version + route.Path
+}
+
+// legacyPath возвращает старый путь без версии
+func (route apiRoute) legacyPath() string {
+	return "/api" + route.Path
+}
+
+// Старые пути без версии объявлены устаревшими и будут удалены после legacySunset
+var (
+	legacyDeprecatedAt = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	legacySunset       = time.Date(2027, time.April, 1, 0, 0, 0, 0, time.UTC)
+)
+
+var userIDParam = apiParam{Name: "id", In: "path", Type: "integer", Description: "ID пользователя"}
+
+// apiRoutes - единый список маршрутов: по нему регистрируются обработчики,
+// строятся /api/info и /api/openapi.json. Новая версия API добавляется маршрутами
+// с Version: "v2", старые версии продолжают работать параллельно
+func apiRoutes() []apiRoute {
+	return []apiRoute{
+		{
+			Path: "", Version: "v1", Tag: "server",
+			Operations: []apiOperation{{Method: http.MethodGet, Summary: "API summary", Handler: homeHandler}},
+		},
+		{
+			Path: "/users", Version: "v1", Legacy: true, Tag: "users", ModeCheck: true,
+			Operations: []apiOperation{
+				{Method: http.MethodGet, Summary: "Get all users", Handler: listUsersHandler, Permission: permUsersRead, Response: []User{}},
+				{Method: http.MethodPost, Summary: "Create user", Handler: createUserHandler, Permission: permUsersWrite, Request: userRequest{}, Response: User{}, Status: http.StatusCreated},
+			},
+		},
+		{
+			Path: "/users/{id}", Version: "v1", Legacy: true, Tag: "users", ModeCheck: true,
+			Operations: []apiOperation{
+				{Method: http.MethodGet, Summary: "Get user by ID", Handler: getUserHandler, Permission: permUsersRead, Params: []apiParam{userIDParam}, Response: User{}},
+				{Method: http.MethodPut, Summary: "Update user", Handler: updateUserHandler, Permission: permUsersWrite, Params: []apiParam{userIDParam}, Request: userRequest{}, Response: User{}},
+				{Method: http.MethodDelete, Summary: "Delete user", Handler: deleteUserHandler, Permission: permUsersWrite, Params: []apiParam{userIDParam}, Status: http.StatusNoContent},
+			},
+		},
+		{
+			Path: "/stats", Version: "v1", Legacy: true, Tag: "stats",
+			Operations: []apiOperation{{Method: http.MethodGet, Summary: "Server statistics", Handler: apiStatsHandler}},
+		},
+		{
+			Path: "/stats/users", Version: "v1", Legacy: true, Tag: "stats",
+			Operations: []apiOperation{{
+				Method:     http.MethodGet,
+				Summary:    "User analytics: signups, domains, growth, cohorts",
+				Handler:    apiUserStatsHandler,
+				Permission: permUsersRead,
+				Params: []apiParam{
+					{Name: "interval", In: "query", Type: "string", Description: "day, week или month"},
+					{Name: "from", In: "query", Type: "string", Format: "date", Description: "Начало периода (YYYY-MM-DD или RFC 3339)"},
+					{Name: "to", In: "query", Type: "string", Format: "date", Description: "Конец периода (YYYY-MM-DD или RFC 3339)"},
+					{Name: "top", In: "query", Type: "integer", Description: "Число доменов в рейтинге"},
+				},
+			}},
+		},
+		{
+			Path: "/info", Version: "v1", Legacy: true, Tag: "server",
+			Operations: []apiOperation{{Method: http.MethodGet, Summary: "This info", Handler: apiInfoHandler}},
+		},
+		{
+			Path: "/version", Version: "v1", Legacy: true, Tag: "server", CORS: corsPublic,
+			Operations: []apiOperation{{Method: http.MethodGet, Summary: "Build version, VCS revision, Go version and changelog", Handler: apiVersionHandler, Response: VersionInfo{}}},
+		},
+		{
+			Path: "/openapi.json", Version: "v1", Legacy: true, Tag: "server", CORS: corsPublic,
+			Operations: []apiOperation{{Method: http.MethodGet, Summary: "OpenAPI 3 specification", Handler: apiOpenAPIHandler}},
+		},
+		{
+			Path: "/docs", Version: "v1", Legacy: true, Tag: "server", CORS: corsPublic,
+			Operations: []apiOperation{{Method: http.MethodGet, Summary: "API documentation page", Handler: apiDocsHandler, ContentType: "text/html"}},
+		},
+		{
+			Path: "/health", Version: "v1", Legacy: true, Tag: "server", CORS: corsPublic,
+			Operations: []apiOperation{{Method: http.MethodGet, Summary: "Health check", Handler: apiHealthHandler}},
+		},
+		{
+			Path: "/admin/mode", Version: "v1", Legacy: true, Tag: "mode",
+			Operations: []apiOperation{{Method: http.MethodPost, Summary: "Change mode (session or admin password in body, requires mode:write)", Handler: apiAdminModeHandler, Request: modeChangeRequest{}}},
+		},
+		{
+			Path: "/admin/mode/history", Version: "v1", Legacy: true, Tag: "mode",
+			Operations: []apiOperation{{
+				Method:     http.MethodGet,
+				Summary:    "Mode transition history, newest first",
+				Handler:    apiModeHistoryHandler,
+				Permission: permAuditRead,
+				Params: []apiParam{
+					{Name: "mode", In: "query", Type: "string", Description: "Только переходы из этого режима или в него"},
+					{Name: "changed_by", In: "query", Type: "string", Description: "Только смены этой учетной записью"},
+					{Name: "source", In: "query", Type: "string", Description: "api, grace, schedule, revert или restart"},
+					{Name: "since", In: "query", Type: "string", Format: "date-time", Description: "Не раньше (RFC 3339)"},
+					{Name: "until", In: "query", Type: "string", Format: "date-time", Description: "Не позже (RFC 3339)"},
+					{Name: "limit", In: "query", Type: "integer", Description: "Число записей, по умолчанию 100"},
+				},
+			}},
+		},
+		{
+			Path: "/admin/mode/pending", Version: "v1", Tag: "mode",
+			Operations: []apiOperation{
+				{Method: http.MethodGet, Summary: "Pending mode change with grace-period countdown and acknowledgements", Handler: getPendingModeHandler, Permission: permAuditRead, Response: PendingModeChange{}},
+				{Method: http.MethodDelete, Summary: "Cancel the pending mode change before it takes effect", Handler: cancelPendingModeHandler, Permission: permModeWrite, Response: PendingModeChange{}},
+			},
+		},
+		{
+			Path: "/admin/mode/schedules", Version: "v1", Tag: "mode",
+			Operations: []apiOperation{
+				{Method: http.MethodGet, Summary: "List scheduled mode changes and pending auto-reverts", Handler: listModeSchedulesHandler, Permission: permAuditRead},
+				{Method: http.MethodPost, Summary: "Schedule a one-off or recurring mode change", Handler: createModeScheduleHandler, Permission: permModeWrite, Request: modeScheduleRequest{}, Response: ModeSchedule{}, Status: http.StatusCreated},
+			},
+		},
+		{
+			Path: "/admin/mode/schedules/{id}", Version: "v1", Tag: "mode",
+			Operations: []apiOperation{{
+				Method:     http.MethodDelete,
+				Summary:    "Cancel a scheduled mode change",
+				Handler:    cancelModeScheduleHandler,
+				Permission: permModeWrite,
+				Params:     []apiParam{{Name: "id", In: "path", Type: "string", Description: "ID расписания"}},
+				Response:   ModeSchedule{},
+			}},
+		},
+		{
+			Path: "/mode", Version: "v1", Legacy: true, Tag: "mode",
+			Operations: []apiOperation{{Method: http.MethodGet, Summary: "Get current mode", Handler: apiGetModeHandler}},
+		},
+		{
+			Path: "/status", Version: "v1", Legacy: true, Tag: "mode",
+			Operations: []apiOperation{{Method: http.MethodGet, Summary: "Check status and mode", Handler: apiStatusHandler}},
+		},
+		{
+			Path: "/check-mode", Version: "v1", Legacy: true, Tag: "mode",
+			Operations: []apiOperation{{
+				Method:  http.MethodGet,
+				Summary: "Check if mode changed",
+				Handler: apiCheckModeHandler,
+				Params:  []apiParam{{Name: "last_check", In: "query", Type: "integer", Description: "Время последней проверки клиента (Unix, секунды)"}},
+			}},
+		},
+		{
+			Path: "/clients", Version: "v1", Legacy: true, Tag: "server",
+			Operations: []apiOperation{{Method: http.MethodGet, Summary: "Get connected clients", Handler: apiClientsHandler, Permission: permClientsRead}},
+		},
+		{
+			Path: "/admin/users/export", Version: "v1", Tag: "admin",
+			Operations: []apiOperation{{
+				Method:      http.MethodGet,
+				Summary:     "Export all users as CSV or JSON",
+				Handler:     usersExportHandler,
+				Permission:  permUsersExport,
+				Params:      []apiParam{{Name: "format", In: "query", Type: "string", Description: "csv (по умолчанию) или json"}},
+				ContentType: "text/csv",
+			}},
+		},
+		{
+			Path: "/admin/users/bulk/preview", Version: "v1", Legacy: true, Tag: "admin",
+			Operations: []apiOperation{{Method: http.MethodPost, Summary: "Preview bulk update/delete by filter", Handler: apiBulkPreviewHandler, Permission: permUsersBulk, Request: bulkPreviewRequest{}}},
+		},
+		{
+			Path: "/admin/users/bulk/apply", Version: "v1", Legacy: true, Tag: "admin",
+			Operations: []apiOperation{{Method: http.MethodPost, Summary: "Apply previewed bulk operation", Handler: apiBulkApplyHandler, Permission: permUsersBulk, Request: bulkApplyRequest{}}},
+		},
+		{
+			Path: "/admin/log-levels", Version: "v1", Legacy: true, Tag: "admin",
+			Operations: []apiOperation{
+				{Method: http.MethodGet, Summary: "Get log levels per subsystem", Handler: apiLogLevelsHandler, Permission: permAuditRead, Response: map[string]string{}},
+				{Method: http.MethodPut, Summary: "Change log levels at runtime", Handler: apiLogLevelsHandler, Permission: permSettingsWrite, Request: map[string]string{}, Response: map[string]string{}},
+			},
+		},
+		{
+			Path: "/admin/local-allowlist", Version: "v1", Tag: "admin",
+			Operations: []apiOperation{
+				{Method: http.MethodGet, Summary: "Networks trusted in local mode and whether the caller is in one", Handler: apiLocalAllowlistHandler, Permission: permAuditRead},
+				{Method: http.MethodPut, Summary: "Replace networks trusted in local mode (CIDR or IP, IPv4 and IPv6)", Handler: apiLocalAllowlistHandler, Permission: permSettingsWrite, Request: localAllowlistRequest{}},
+			},
+		},
+		{
+			Path: "/admin/auth/attempts", Version: "v1", Tag: "admin",
+			Operations: []apiOperation{{
+				Method:     http.MethodGet,
+				Summary:    "Admin login attempts and active lockouts",
+				Handler:    apiAuthAttemptsHandler,
+				Permission: permAuditRead,
+				Params: []apiParam{
+					{Name: "ip", In: "query", Type: "string", Description: "Только попытки с этого IP"},
+					{Name: "result", In: "query", Type: "string", Description: "success, failure или locked"},
+					{Name: "limit", In: "query", Type: "integer", Description: "Число записей, по умолчанию 100"},
+				},
+			}},
+		},
+		{
+			Path: "/auth/login", Version: "v1", Tag: "auth",
+			Operations: []apiOperation{{
+				Method:   http.MethodPost,
+				Summary:  "Admin login, returns signed session tokens",
+				Handler:  apiLoginHandler,
+				Request:  loginRequest{},
+				Response: sessionTokens{},
+			}},
+		},
+		{
+			Path: "/auth/refresh", Version: "v1", Tag: "auth",
+			Operations: []apiOperation{{
+				Method:   http.MethodPost,
+				Summary:  "Exchange a refresh token for a new session",
+				Handler:  apiRefreshHandler,
+				Request:  refreshRequest{},
+				Response: sessionTokens{},
+			}},
+		},
+		{
+			Path: "/auth/logout", Version: "v1", Tag: "auth",
+			Operations: []apiOperation{{
+				Method:  http.MethodPost,
+				Summary: "Revoke the current session (Bearer access token or refresh_token in body)",
+				Handler: apiLogoutHandler,
+				Status:  http.StatusNoContent,
+			}},
+		},
+		{
+			Path: "/admin/sessions/revoke", Version: "v1", Tag: "admin",
+			Operations: []apiOperation{{
+				Method:     http.MethodPost,
+				Summary:    "Revoke a session by id or all sessions of an admin",
+				Handler:    apiRevokeSessionsHandler,
+				Permission: permSettingsWrite,
+				Request:    revokeSessionsRequest{},
+			}},
+		},
+		{
+			Path: "/ws-ticket", Version: "v1", Tag: "realtime",
+			Operations: []apiOperation{{
+				Method:   http.MethodPost,
+				Summary:  "Issue a single-use ticket for /ws?ticket= or an in-band auth message",
+				Handler:  apiWSTicketHandler,
+				Response: wsTicketResponse{},
+			}},
+		},
+		{
+			Path: "/admin/api-keys", Version: "v1", Tag: "admin",
+			Operations: []apiOperation{
+				{Method: http.MethodGet, Summary: "List API keys with scopes, expiry and last use", Handler: listAPIKeysHandler, Permission: permAPIKeysManage},
+				{Method: http.MethodPost, Summary: "Issue a scoped API key (the key is shown only once)", Handler: createAPIKeyHandler, Permission: permAPIKeysManage, Request: apiKeyRequest{}, Response: apiKeyCreated{}, Status: http.StatusCreated},
+			},
+		},
+		{
+			Path: "/admin/api-keys/{id}", Version: "v1", Tag: "admin",
+			Operations: []apiOperation{{
+				Method:     http.MethodDelete,
+				Summary:    "Revoke an API key",
+				Handler:    revokeAPIKeyHandler,
+				Permission: permAPIKeysManage,
+				Params:     []apiParam{{Name: "id", In: "path", Type: "string", Description: "ID ключа"}},
+				Response:   APIKey{},
+			}},
+		},
+		{
+			// Корень /api перечисляет версии и не считается устаревшим
+			Path: "/api", Tag: "server",
+			Operations: []apiOperation{{Method: http.MethodGet, Summary: "API summary and available versions", Handler: homeHandler}},
+		},
+		{
+			Path: "/ws", Tag: "realtime", WebSocket: true,
+			Operations: []apiOperation{{
+				Method:  http.MethodGet,
+				Summary: "WebSocket for real-time updates",
+				Handler: handleWebSocket,
+				Params: []apiParam{
+					{Name: "clientId", In: "query", Type: "string", Description: "Идентификатор клиента"},
+					{Name: "ticket", In: "query", Type: "string", Description: "Одноразовый билет из /api/v1/ws-ticket"},
+				},
+				Status: http.StatusSwitchingProtocols,
+			}},
+		},
+		{
+			Path: "/metrics", Tag: "server", NoCORS: true,
+			Operations: []apiOperation{{Method: http.MethodGet, Summary: "Prometheus metrics", Handler: metricsHandler, ContentType: "text/plain"}},
+		},
+		{
+			// Встроенный фронтенд; в локальном режиме страницы блокируются checkModeMiddleware.
+			// Шаблон "GET /" конфликтовал бы с путями без метода, поэтому метод проверяет обработчик
+			Path: "/", ModeCheck: true, NoCORS: true, AnyMethod: true, Hidden: true,
+			Operations: []apiOperation{{Method: http.MethodGet, Summary: "Embedded frontend", Handler: frontendHandler, ContentType: "text/html"}},
+		},
+	}
+}
+
+// registerRoutes регистрирует методы каждого маршрута по шаблонам "METHOD /path",
+// ответ 405 для остальных методов и устаревшие псевдонимы без версии
+func registerRoutes() {
+	for _, route := range apiRoutes() {
+		route.register(route.docPath(), nil)
+		if route.Legacy {
+			route.register(route.legacyPath(), deprecatedAlias(route.Version))
+		}
+	}
+}
+
+// register регистрирует маршрут по указанному пути
+func (route apiRoute) register(path string, wrap func(http.HandlerFunc) http.HandlerFunc) {
+	decorate := func(handler http.HandlerFunc, class, permission string) http.HandlerFunc {
+		if permission != "" {
+			handler = requirePermission(permission, handler)
+		}
+		if route.ModeCheck || permission != "" {
+			handler = checkModeMiddleware(permission, handler)
+		}
+		if class != "" {
+			handler = rateLimit(class, handler)
+		}
+		if !route.NoCORS {
+			handler = enableCORS(route.corsPolicy(), handler)
+		}
+		if wrap != nil {
+			handler = wrap(handler)
+		}
+		return handler
+	}
+
+	if route.AnyMethod {
+		handle(path, decorate(route.Operations[0].Handler, "", route.Operations[0].Permission))
+		return
+	}
+
+	allowed := make([]string, 0, len(route.Operations)+2)
+	for _, op := range route.Operations {
+		handle(op.Method+" "+path, decorate(op.Handler, route.rateClass(op), op.Permission))
+		allowed = append(allowed, op.Method)
+		if op.Method == http.MethodGet {
+			allowed = append(allowed, http.MethodHead)
+		}
+	}
+	if !route.NoCORS {
+		allowed = append(allowed, http.MethodOptions)
+	}
+	handle(path, decorate(methodNotAllowed(allowed), "", ""))
+}
+
+// corsPolicy возвращает политику CORS маршрута
+func (route apiRoute) corsPolicy() string {
+	if route.CORS != "" {
+		return route.CORS
+	}
+	if strings.HasPrefix(route.Path, "/admin/") || strings.HasPrefix(route.Path, "/auth/") {
+		return corsAdmin
+	}
+	return corsDefault
+}
+
+// rateClass определяет класс лимита запросов для метода маршрута
+func (route apiRoute) rateClass(op apiOperation) string {
+	switch {
+	case route.WebSocket:
+		return rateClassWSConnect
+	case (op.Permission != "" && isAdminPermission(op.Permission)) || strings.HasPrefix(route.Path, "/admin/") || route.Path == "/auth/login":
+		return rateClassAdmin
+	case op.Method == http.MethodGet:
+		return rateClassRead
+	default:
+		return rateClassWrite
+	}
+}
+
+// methodNotAllowed отвечает 405 с заголовком Allow; предзапросы CORS обрабатывает enableCORS
+func methodNotAllowed(allowed []string) http.HandlerFunc {
+	allow := strings.Join(allowed, ", ")
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", allow)
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// deprecatedAlias помечает старый путь заголовками Deprecation, Sunset и ссылкой на путь в версии
+func deprecatedAlias(version string) func(http.HandlerFunc) http.HandlerFunc {
+	deprecation := "@" + strconv.FormatInt(legacyDeprecatedAt.Unix(), 10)
+	sunset := legacySunset.Format(http.TimeFormat)
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			successor := "/api/" + version + strings.TrimPrefix(r.URL.Path, "/api")
+			w.Header().Set("Deprecation", deprecation)
+			w.Header().Set("Sunset", sunset)
+			w.Header().Set("Link", "<"+successor+">; rel=\"successor-version\"")
+			logHTTP.DebugContext(r.Context(), "запрос к устаревшему пути", "path", r.URL.Path, "successor", successor)
+			next(w, r)
+		}
+	}
+}
+
+// routeEndpoints возвращает краткий список методов для /api/info
+func routeEndpoints() map[string]string {
+	endpoints := make(map[string]string)
+	for _, route := range apiRoutes() {
+		for _, op := range route.Operations {
+			method := op.Method
+			if route.WebSocket {
+				method = "WS"
+			}
+			summary := op.Summary
+			if op.Permission != "" {
+				summary += permissionSummary(op.Permission)
+			}
+			endpoints[method+" "+route.docPath()] = summary
+		}
+	}
+	return endpoints
+}
+
+// apiVersions возвращает корневые пути всех версий API
+func apiVersions() map[string]string {
+	versions := make(map[string]string)
+	for _, route := range apiRoutes() {
+		if route.Version != "" {
+			versions[route.Version] = "/api/" + route.Version
+		}
+	}
+	return versions
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// registerRoutes пишет в http.DefaultServeMux, повторная регистрация паникует
+var registerRoutesOnce sync.Once
+
+func TestLegacyAliases(t *testing.T) {
+	useTestConfig(t)
+	useTestMode(t, modeServer)
+	useTestDB(t, User{ID: 1, Name: "Иван", Email: "ivan@example.com", CreatedAt: time.Now()})
+	registerRoutesOnce.Do(registerRoutes)
+
+	deprecation := "@" + strconv.FormatInt(legacyDeprecatedAt.Unix(), 10)
+	sunset := legacySunset.Format(http.TimeFormat)
+	tests := []struct {
+		path      string
+		successor string // пусто - путь не устаревший
+	}{
+		{"/api/users", "/api/v1/users"},
+		{"/api/users/1", "/api/v1/users/1"},
+		{"/api/status", "/api/v1/status"},
+		{"/api/v1/users", ""},
+		{"/api/v1/users/1", ""},
+		{"/api/v1/status", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			http.DefaultServeMux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+			}
+
+			header := rec.Header()
+			if tt.successor == "" {
+				for _, name := range []string{"Deprecation", "Sunset", "Link"} {
+					if value := header.Get(name); value != "" {
+						t.Errorf("versioned path sets %s: %q", name, value)
+					}
+				}
+				return
+			}
+			if got := header.Get("Deprecation"); got != deprecation {
+				t.Errorf("Deprecation = %q, want %q", got, deprecation)
+			}
+			if got := header.Get("Sunset"); got != sunset {
+				t.Errorf("Sunset = %q, want %q", got, sunset)
+			}
+			if got, want := header.Get("Link"), "<"+tt.successor+">; rel=\"successor-version\""; got != want {
+				t.Errorf("Link = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestRouteRateClasses(t *testing.T) {
+	want := map[string]string{
+		"GET /users":         rateClassRead,
+		"GET /users/{id}":    rateClassRead,
+		"GET /stats/users":   rateClassRead,
+		"POST /users":        rateClassWrite,
+		"PUT /users/{id}":    rateClassWrite,
+		"DELETE /users/{id}": rateClassWrite,
+		"GET /clients":       rateClassAdmin,
+		"POST /auth/login":   rateClassAdmin,
+		"POST /admin/mode":   rateClassAdmin,
+		"GET /ws":            rateClassWSConnect,
+	}
+	for _, route := range apiRoutes() {
+		for _, op := range route.Operations {
+			key := op.Method + " " + route.Path
+			class, pinned := want[key]
+			if !pinned {
+				continue
+			}
+			delete(want, key)
+			if got := route.rateClass(op); got != class {
+				t.Errorf("%s: rate class %s, want %s", key, got, class)
+			}
+		}
+	}
+	for key := range want {
+		t.Errorf("route %s not found", key)
+	}
+}
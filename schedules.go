@@ -0,0 +1,554 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Имя, под которым планировщик меняет режим: в changed_by и журналах
+const schedulerPrincipalPrefix = "scheduler:"
+
+var errScheduleNotFound = errors.New("schedule not found")
+
+// scheduleDays - дни недели повторяющихся расписаний
+var scheduleDays = map[string]time.Weekday{
+	"mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday, "thu": time.Thursday,
+	"fri": time.Friday, "sat": time.Saturday, "sun": time.Sunday,
+}
+
+// ModeSchedule - плановая смена режима: однократная (At) или повторяющаяся (Time, Days)
+type ModeSchedule struct {
+	ID        string     `json:"id"`
+	Mode      string     `json:"mode"`
+	Message   string     `json:"message,omitempty"`
+	At        *time.Time `json:"at,omitempty"`        // однократное переключение
+	Time      string     `json:"time,omitempty"`      // "15:04" по времени сервера для повторяющихся
+	Days      []string   `json:"days,omitempty"`      // mon..sun; пусто - каждый день
+	Duration  Duration   `json:"duration"`            // через сколько вернуть режим; 0 - не возвращать
+	RevertTo  string     `json:"revert_to,omitempty"` // режим возврата; пусто - действовавший до переключения
+	Announce  Duration   `json:"announce"`            // за сколько предупредить клиентов
+	Grace     Duration   `json:"grace"`               // отсрочка с обратным отсчетом перед переключением
+	Revert    bool       `json:"revert,omitempty"`    // автоматический возврат после TTL
+	FromMode  string     `json:"from_mode,omitempty"` // для возврата: временный режим, который он завершает
+	CreatedBy string     `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	NextRun   time.Time  `json:"next_run"`
+	LastRun   *time.Time `json:"last_run,omitempty"`
+
+	announced time.Time // NextRun, о котором клиенты уже предупреждены
+}
+
+// recurring сообщает, повторяется ли расписание
+func (s ModeSchedule) recurring() bool {
+	return s.Time != ""
+}
+
+// next возвращает ближайший запуск повторяющегося расписания после after
+func (s ModeSchedule) next(after time.Time) time.Time {
+	clock, _ := time.Parse("15:04", s.Time)
+	local := after.Local()
+	for day := 0; day <= 7; day++ {
+		candidate := time.Date(local.Year(), local.Month(), local.Day()+day, clock.Hour(), clock.Minute(), 0, 0, time.Local)
+		if !candidate.After(after) {
+			continue
+		}
+		if len(s.Days) == 0 {
+			return candidate
+		}
+		for _, name := range s.Days {
+			if scheduleDays[name] == candidate.Weekday() {
+				return candidate
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// modeScheduler - расписания, сохраняемые в data_dir/mode_schedules.json
+type modeScheduler struct {
+	mu        sync.Mutex
+	schedules map[string]*ModeSchedule
+}
+
+var modeSchedules = &modeScheduler{schedules: make(map[string]*ModeSchedule)}
+
+// Load читает расписания. Повторяющиеся переносятся на ближайший запуск, однократные,
+// окно которых закончилось, пока сервер не работал, отбрасываются. Режим не переживает
+// перезапуск, поэтому возврат сохраняется, только если действует режим, который он завершает
+func (s *modeScheduler) Load(path string) error {
+	var schedules []ModeSchedule
+	found, err := loadJSONFile(path, &schedules)
+	if err != nil || !found {
+		return err
+	}
+
+	now := time.Now()
+	current := currentModeState().Mode
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schedules = make(map[string]*ModeSchedule, len(schedules))
+	for i := range schedules {
+		schedule := &schedules[i]
+		switch {
+		case schedule.recurring() && schedule.NextRun.Before(now):
+			schedule.NextRun = schedule.next(now)
+		case !schedule.recurring() && schedule.Duration.Duration > 0 && !schedule.NextRun.Add(schedule.Duration.Duration).After(now):
+			logMode.Warn("пропущено плановое переключение режима", "schedule_id", schedule.ID, "mode", schedule.Mode, "at", schedule.NextRun)
+			continue
+		case schedule.Revert && schedule.FromMode != current:
+			logMode.Warn("возврат режима отброшен: после перезапуска действует другой режим",
+				"schedule_id", schedule.ID, "from_mode", schedule.FromMode, "mode", current, "revert_to", schedule.Mode)
+			continue
+		}
+		s.schedules[schedule.ID] = schedule
+	}
+	return s.saveLocked()
+}
+
+// saveLocked записывает расписания в файл; s.mu должен быть захвачен
+func (s *modeScheduler) saveLocked() error {
+	schedules := make([]ModeSchedule, 0, len(s.schedules))
+	for _, schedule := range s.schedules {
+		schedules = append(schedules, *schedule)
+	}
+	sort.Slice(schedules, func(i, j int) bool { return schedules[i].CreatedAt.Before(schedules[j].CreatedAt) })
+	return saveJSONFile(dataPath("mode_schedules.json"), schedules)
+}
+
+// Add сохраняет новое расписание
+func (s *modeScheduler) Add(schedule ModeSchedule) (ModeSchedule, error) {
+	schedule.ID = randomHex(6)
+	schedule.CreatedAt = time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schedules[schedule.ID] = &schedule
+	if err := s.saveLocked(); err != nil {
+		delete(s.schedules, schedule.ID)
+		return ModeSchedule{}, err
+	}
+	return schedule, nil
+}
+
+// Cancel удаляет расписание
+func (s *modeScheduler) Cancel(id string) (ModeSchedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	schedule, exists := s.schedules[id]
+	if !exists {
+		return ModeSchedule{}, errScheduleNotFound
+	}
+	delete(s.schedules, id)
+	if err := s.saveLocked(); err != nil {
+		s.schedules[id] = schedule
+		return ModeSchedule{}, err
+	}
+	return *schedule, nil
+}
+
+// CancelReverts удаляет ожидающие автоматические возвраты: новая смена режима их отменяет
+func (s *modeScheduler) CancelReverts() []ModeSchedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var cancelled []ModeSchedule
+	for id, schedule := range s.schedules {
+		if schedule.Revert {
+			cancelled = append(cancelled, *schedule)
+			delete(s.schedules, id)
+		}
+	}
+	if len(cancelled) > 0 {
+		if err := s.saveLocked(); err != nil {
+			logMode.Error("ошибка сохранения расписаний режима", "error", err)
+		}
+	}
+	return cancelled
+}
+
+// List возвращает расписания в порядке запуска
+func (s *modeScheduler) List() []ModeSchedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	schedules := make([]ModeSchedule, 0, len(s.schedules))
+	for _, schedule := range s.schedules {
+		schedules = append(schedules, *schedule)
+	}
+	// При равном времени запуска - по ID: порядок обхода map случаен
+	sort.Slice(schedules, func(i, j int) bool {
+		if !schedules[i].NextRun.Equal(schedules[j].NextRun) {
+			return schedules[i].NextRun.Before(schedules[j].NextRun)
+		}
+		return schedules[i].ID < schedules[j].ID
+	})
+	return schedules
+}
+
+// due отбирает расписания, о которых пора предупредить, и те, что пора выполнить.
+// Выполненные однократные удаляются, повторяющиеся переносятся на следующий запуск
+func (s *modeScheduler) due(now time.Time) (announce, run []ModeSchedule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := false
+	for id, schedule := range s.schedules {
+		switch {
+		case !schedule.NextRun.After(now):
+			run = append(run, *schedule)
+			changed = true
+			if !schedule.recurring() {
+				delete(s.schedules, id)
+				continue
+			}
+			lastRun := now.UTC()
+			schedule.LastRun = &lastRun
+			schedule.NextRun = schedule.next(now)
+		case schedule.Announce.Duration > 0 && !schedule.announced.Equal(schedule.NextRun) &&
+			!now.Before(schedule.NextRun.Add(-schedule.Announce.Duration)):
+			schedule.announced = schedule.NextRun
+			announce = append(announce, *schedule)
+		}
+	}
+	if changed {
+		if err := s.saveLocked(); err != nil {
+			logMode.Error("ошибка сохранения расписаний режима", "error", err)
+		}
+	}
+	sort.Slice(run, func(i, j int) bool { return run[i].NextRun.Before(run[j].NextRun) })
+	return announce, run
+}
+
+// loadModeSchedules загружает расписания при старте
+func loadModeSchedules() error {
+	return modeSchedules.Load(dataPath("mode_schedules.json"))
+}
+
+// modeChange - запрошенная смена режима: вручную, по расписанию или после отсрочки
+type modeChange struct {
+	Mode      string
+	Message   string
+	ETA       *time.Time    // сообщаемое клиентам окончание, если нет TTL
+	TTL       time.Duration // через сколько после переключения вернуть режим; 0 - не возвращать
+	RevertAt  time.Time     // когда вернуть режим независимо от момента переключения; вместо TTL
+	RevertTo  string        // режим возврата; пусто - прежний
+	ChangedBy string
+
+	// Для журнала смен режима
+	Source    string
+	Reason    string
+	IP        string
+	RequestID string
+}
+
+// switchMode применяет смену режима. Ожидающий возврат отменяется; при TTL > 0 или
+// заданном RevertAt планируется возврат в RevertTo (пусто - в прежний режим). Время
+// возврата считается в момент переключения, то есть уже после отсрочки
+func switchMode(change modeChange) (string, *ModeSchedule) {
+	if pending, err := cancelPendingMode(change.ChangedBy); err == nil {
+		logMode.Info("отложенная смена режима заменена новой", "change_id", pending.ID, "mode", pending.Mode)
+	}
+	for _, cancelled := range modeSchedules.CancelReverts() {
+		logMode.Info("автоматический возврат режима отменен", "schedule_id", cancelled.ID, "mode", cancelled.Mode)
+	}
+
+	eta := change.ETA
+	ttl := change.TTL
+	if !change.RevertAt.IsZero() {
+		ttl = revertTTL(change.RevertAt, time.Now())
+	}
+	if ttl > 0 {
+		at := time.Now().Add(ttl).UTC().Round(time.Second)
+		eta = &at
+	}
+	oldMode := setMode(change.Mode, change.Message, eta, change.ChangedBy)
+	recordModeTransition(ModeTransition{
+		Time:      time.Now().UTC(),
+		OldMode:   oldMode,
+		NewMode:   change.Mode,
+		ChangedBy: change.ChangedBy,
+		Source:    change.Source,
+		Reason:    change.Reason,
+		IP:        change.IP,
+		Clients:   clientCount(),
+		RequestID: change.RequestID,
+	})
+	if ttl <= 0 {
+		return oldMode, nil
+	}
+
+	revertTo := change.RevertTo
+	if revertTo == "" {
+		revertTo = oldMode
+	}
+	revert, err := modeSchedules.Add(ModeSchedule{
+		Mode:      revertTo,
+		At:        eta,
+		Announce:  Duration{min(cfg.ModeAnnounce.Duration, ttl)},
+		Revert:    true,
+		FromMode:  change.Mode,
+		CreatedBy: change.ChangedBy,
+		NextRun:   *eta,
+	})
+	if err != nil {
+		logMode.Error("ошибка сохранения возврата режима", "error", err)
+		return oldMode, nil
+	}
+	return oldMode, &revert
+}
+
+// Самое короткое окно запоздавшего расписания: даже если запуск опоздал на все окно,
+// временный режим должен вернуться, а не остаться навсегда
+const minScheduleTTL = time.Second
+
+// scheduleTTL возвращает, сколько осталось от окна расписания к моменту now: окно
+// отсчитывается от запланированного времени, а не от фактического запуска
+func scheduleTTL(schedule ModeSchedule, now time.Time) time.Duration {
+	if schedule.Duration.Duration <= 0 {
+		return 0
+	}
+	return revertTTL(schedule.NextRun.Add(schedule.Duration.Duration), now)
+}
+
+// revertTTL - сколько осталось до возврата режима, но не меньше minScheduleTTL
+func revertTTL(revertAt, now time.Time) time.Duration {
+	return max(revertAt.Sub(now), minScheduleTTL)
+}
+
+// runSchedule выполняет расписание
+func runSchedule(schedule ModeSchedule) {
+	changedBy := schedulerPrincipalPrefix + schedule.ID
+	if current := currentModeState().Mode; schedule.Revert && current == schedule.Mode {
+		logMode.Info("режим уже активен, возврат не нужен", "schedule_id", schedule.ID, "mode", current)
+		return
+	} else if schedule.Revert && current != schedule.FromMode {
+		logMode.Warn("возврат режима пропущен: действует другой режим",
+			"schedule_id", schedule.ID, "from_mode", schedule.FromMode, "mode", current)
+		return
+	}
+
+	if ttl := scheduleTTL(schedule, time.Now()); ttl > 0 && ttl < schedule.Duration.Duration {
+		logMode.Warn("плановая смена режима запоздала, окно сокращено",
+			"schedule_id", schedule.ID, "at", schedule.NextRun, "ttl", ttl.String())
+	}
+	change := modeChange{
+		Mode:      schedule.Mode,
+		Message:   schedule.Message,
+		RevertTo:  schedule.RevertTo,
+		ChangedBy: changedBy,
+		Source:    modeSourceSchedule,
+		Reason:    "расписание, созданное " + schedule.CreatedBy,
+	}
+	if schedule.Revert {
+		change.Source = modeSourceRevert
+		change.Reason = "автоматический возврат, заданный " + schedule.CreatedBy
+	}
+	if schedule.Duration.Duration > 0 {
+		// Отсрочка входит в окно: режим возвращается в конце окна, а не через duration после отсчета
+		change.RevertAt = schedule.NextRun.Add(schedule.Duration.Duration)
+	}
+	if schedule.Grace.Duration > 0 {
+		if pending, err := startPendingMode(change, schedule.Grace.Duration); err != nil {
+			logMode.Warn("плановая смена режима пропущена", "schedule_id", schedule.ID, "error", err)
+		} else {
+			logMode.Info("плановая смена режима ожидает отсрочки", "schedule_id", schedule.ID, "change_id", pending.ID, "effective_at", pending.EffectiveAt)
+		}
+		return
+	}
+	oldMode, revert := switchMode(change)
+
+	attrs := []any{"schedule_id", schedule.ID, "old_mode", oldMode, "new_mode", schedule.Mode, "clients", clientCount()}
+	if revert != nil {
+		attrs = append(attrs, "revert_at", revert.NextRun, "revert_to", revert.Mode)
+	}
+	logMode.Info("режим изменен по расписанию", attrs...)
+}
+
+// announceSchedule предупреждает клиентов о скорой смене режима
+func announceSchedule(schedule ModeSchedule) {
+	broadcastToAll("mode_change_upcoming", map[string]interface{}{
+		"schedule_id": schedule.ID,
+		"mode":        schedule.Mode,
+		"message":     schedule.Message,
+		"at":          schedule.NextRun.UTC().Format(time.RFC3339),
+		"in_seconds":  int(time.Until(schedule.NextRun).Round(time.Second).Seconds()),
+		"duration":    schedule.Duration.String(),
+		"revert":      schedule.Revert,
+	})
+	logMode.Info("клиенты предупреждены о смене режима", "schedule_id", schedule.ID, "mode", schedule.Mode, "at", schedule.NextRun)
+}
+
+// startModeScheduler раз в секунду выполняет наступившие расписания
+func startModeScheduler(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	backgroundWG.Add(1)
+	go func() {
+		defer backgroundWG.Done()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				announce, run := modeSchedules.due(now)
+				for _, schedule := range announce {
+					announceSchedule(schedule)
+				}
+				for _, schedule := range run {
+					runSchedule(schedule)
+				}
+			}
+		}
+	}()
+}
+
+// modeScheduleRequest - тело запроса создания расписания
+type modeScheduleRequest struct {
+	Mode     string     `json:"mode"`
+	Message  string     `json:"message,omitempty"`
+	At       *time.Time `json:"at,omitempty"`        // однократно в указанное время
+	Time     string     `json:"time,omitempty"`      // или ежедневно в "HH:MM" по времени сервера
+	Days     []string   `json:"days,omitempty"`      // только в эти дни: mon..sun
+	Duration string     `json:"duration,omitempty"`  // вернуть режим через ("8h")
+	RevertTo string     `json:"revert_to,omitempty"` // режим возврата, по умолчанию прежний
+	Announce string     `json:"announce,omitempty"`  // за сколько предупредить, по умолчанию mode_announce
+	Grace    string     `json:"grace,omitempty"`     // отсрочка с обратным отсчетом ("2m")
+}
+
+// parseOptionalDuration разбирает необязательную неотрицательную длительность
+func parseOptionalDuration(name, value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%s must be a duration like '8h'", name)
+	}
+	return d, nil
+}
+
+// schedule проверяет запрос и строит расписание
+func (body modeScheduleRequest) schedule(createdBy string) (ModeSchedule, error) {
+	if !validMode(body.Mode) {
+		return ModeSchedule{}, errors.New("mode must be one of " + modeSummary())
+	}
+	if (body.At == nil) == (body.Time == "") {
+		return ModeSchedule{}, errors.New("exactly one of 'at' (one-off) or 'time' (recurring) is required")
+	}
+	duration, err := parseOptionalDuration("duration", body.Duration, 0)
+	if err != nil {
+		return ModeSchedule{}, err
+	}
+	announce, err := parseOptionalDuration("announce", body.Announce, cfg.ModeAnnounce.Duration)
+	if err != nil {
+		return ModeSchedule{}, err
+	}
+	grace, err := parseGrace(body.Grace)
+	if err != nil {
+		return ModeSchedule{}, err
+	}
+	if body.RevertTo != "" && (!validMode(body.RevertTo) || duration == 0) {
+		return ModeSchedule{}, errors.New("revert_to must be a known mode and requires duration")
+	}
+	if duration > 0 && grace >= duration {
+		// Отсрочка отсчитывается внутри окна duration
+		return ModeSchedule{}, errors.New("grace must be shorter than duration")
+	}
+
+	schedule := ModeSchedule{
+		Mode:      body.Mode,
+		Message:   strings.TrimSpace(body.Message),
+		Duration:  Duration{duration},
+		RevertTo:  body.RevertTo,
+		Announce:  Duration{announce},
+		Grace:     Duration{grace},
+		CreatedBy: createdBy,
+	}
+	if body.At != nil {
+		if !body.At.After(time.Now()) {
+			return ModeSchedule{}, errors.New("at must be in the future")
+		}
+		if len(body.Days) > 0 {
+			return ModeSchedule{}, errors.New("days apply only to recurring schedules")
+		}
+		at := body.At.UTC()
+		schedule.At = &at
+		schedule.NextRun = at
+		return schedule, nil
+	}
+
+	if _, err := time.Parse("15:04", body.Time); err != nil {
+		return ModeSchedule{}, errors.New("time must be HH:MM")
+	}
+	if duration >= 24*time.Hour {
+		return ModeSchedule{}, errors.New("duration of a recurring schedule must be shorter than 24h")
+	}
+	for _, day := range body.Days {
+		day = strings.ToLower(day)
+		if _, ok := scheduleDays[day]; !ok {
+			return ModeSchedule{}, fmt.Errorf("unknown day %q, expected one of: mon, tue, wed, thu, fri, sat, sun", day)
+		}
+		schedule.Days = append(schedule.Days, day)
+	}
+	schedule.Time = body.Time
+	schedule.NextRun = schedule.next(time.Now())
+	return schedule, nil
+}
+
+// GET /api/v1/admin/mode/schedules
+func listModeSchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	schedules := modeSchedules.List()
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"schedules": schedules,
+		"total":     len(schedules),
+		"mode":      currentModeState().Mode,
+		"timezone":  time.Now().Format("MST -07:00"),
+	})
+}
+
+// POST /api/v1/admin/mode/schedules
+func createModeScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	var body modeScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		sendError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	adminName, _ := requestRole(r)
+	schedule, err := body.schedule(adminName)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if schedule, err = modeSchedules.Add(schedule); err != nil {
+		sendError(w, http.StatusInternalServerError, "Failed to save schedule")
+		return
+	}
+
+	logMode.InfoContext(r.Context(), "запланирована смена режима",
+		"schedule_id", schedule.ID, "mode", schedule.Mode, "next_run", schedule.NextRun,
+		"recurring", schedule.recurring(), "duration", schedule.Duration.String(), "admin", adminName)
+	sendJSON(w, http.StatusCreated, schedule)
+}
+
+// DELETE /api/v1/admin/mode/schedules/{id}
+func cancelModeScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	schedule, err := modeSchedules.Cancel(r.PathValue("id"))
+	switch {
+	case err == errScheduleNotFound:
+		sendError(w, http.StatusNotFound, "Schedule not found")
+		return
+	case err != nil:
+		sendError(w, http.StatusInternalServerError, "Failed to save schedule")
+		return
+	}
+
+	adminName, _ := requestRole(r)
+	logMode.InfoContext(r.Context(), "расписание смены режима отменено",
+		"schedule_id", schedule.ID, "mode", schedule.Mode, "admin", adminName)
+	sendJSON(w, http.StatusOK, schedule)
+}
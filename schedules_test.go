@@ -0,0 +1,147 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestModeScheduleNext(t *testing.T) {
+	// 19.10.2026 - понедельник
+	monday := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 10, 19+day, hour, minute, 0, 0, time.Local)
+	}
+	tests := []struct {
+		name     string
+		schedule ModeSchedule
+		after    time.Time
+		want     time.Time
+	}{
+		{"later today", ModeSchedule{Time: "22:00"}, monday(0, 10, 0), monday(0, 22, 0)},
+		{"already passed today", ModeSchedule{Time: "09:30"}, monday(0, 10, 0), monday(1, 9, 30)},
+		{"exactly now is not next", ModeSchedule{Time: "10:00"}, monday(0, 10, 0), monday(1, 10, 0)},
+		{"next listed weekday", ModeSchedule{Time: "03:00", Days: []string{"wed", "fri"}}, monday(0, 10, 0), monday(2, 3, 0)},
+		{"same weekday next week", ModeSchedule{Time: "03:00", Days: []string{"mon"}}, monday(0, 10, 0), monday(7, 3, 0)},
+		{"weekend", ModeSchedule{Time: "00:00", Days: []string{"sat", "sun"}}, monday(0, 0, 0), monday(5, 0, 0)},
+		{"today on a listed day", ModeSchedule{Time: "23:59", Days: []string{"mon"}}, monday(0, 10, 0), monday(0, 23, 59)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.schedule.next(tt.after); !got.Equal(tt.want) {
+				t.Errorf("next(%s) = %s, want %s", tt.after, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleTTL(t *testing.T) {
+	at := time.Date(2026, 10, 19, 3, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		duration time.Duration
+		now      time.Time
+		want     time.Duration
+	}{
+		{"no revert", 0, at, 0},
+		{"on time", time.Hour, at, time.Hour},
+		{"late start shortens the window", time.Hour, at.Add(10 * time.Minute), 50 * time.Minute},
+		{"whole window missed still reverts", time.Hour, at.Add(2 * time.Hour), minScheduleTTL},
+		{"window ends exactly now", time.Hour, at.Add(time.Hour), minScheduleTTL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule := ModeSchedule{NextRun: at, Duration: Duration{tt.duration}}
+			if got := scheduleTTL(schedule, tt.now); got != tt.want {
+				t.Errorf("scheduleTTL = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// useTestSchedules подменяет планировщик пустым на время теста
+func useTestSchedules(t *testing.T) {
+	t.Helper()
+	saved := modeSchedules
+	modeSchedules = &modeScheduler{schedules: make(map[string]*ModeSchedule)}
+	t.Cleanup(func() { modeSchedules = saved })
+}
+
+func TestLoadDropsRevertsOfAnotherMode(t *testing.T) {
+	useTestConfig(t)
+	useTestSchedules(t)
+	useTestMode(t, modeServer)
+
+	now := time.Now()
+	revert := func(id, from string) ModeSchedule {
+		return ModeSchedule{ID: id, Mode: modeLocal, Revert: true, FromMode: from, NextRun: now.Add(time.Hour), CreatedAt: now}
+	}
+	saved := []ModeSchedule{
+		revert("matching", modeServer),
+		revert("other-mode", modeMaintenance),
+		revert("legacy", ""), // сохранен до появления from_mode
+		{ID: "one-off", Mode: modeMaintenance, NextRun: now.Add(time.Hour), CreatedAt: now},
+	}
+	path := dataPath("mode_schedules.json")
+	if err := saveJSONFile(path, saved); err != nil {
+		t.Fatal(err)
+	}
+	if err := modeSchedules.Load(path); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, schedule := range modeSchedules.List() {
+		ids = append(ids, schedule.ID)
+	}
+	if strings.Join(ids, ",") != "matching,one-off" {
+		t.Fatalf("loaded schedules %v, want [matching one-off]", ids)
+	}
+}
+
+func TestSwitchModeRevertsAtWindowEnd(t *testing.T) {
+	useTestConfig(t)
+	useTestSchedules(t)
+	useTestMode(t, modeServer)
+	useTestModeHistory(t)
+
+	// Переключение после отсрочки: окно заканчивается в RevertAt, а не через TTL после переключения
+	revertAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	_, revert := switchMode(modeChange{Mode: modeMaintenance, TTL: 2 * time.Hour, RevertAt: revertAt, ChangedBy: "alice"})
+	if revert == nil {
+		t.Fatal("no revert scheduled")
+	}
+	if !revert.NextRun.Equal(revertAt) {
+		t.Errorf("revert at %s, want %s", revert.NextRun, revertAt)
+	}
+	if revert.Mode != modeServer || revert.FromMode != modeMaintenance {
+		t.Errorf("revert %s -> %s, want %s -> %s", revert.FromMode, revert.Mode, modeMaintenance, modeServer)
+	}
+
+	// Режим сменился вручную: возврат из maintenance больше не применяется
+	useTestMode(t, modeReadonly)
+	runSchedule(*revert)
+	if mode := currentModeState().Mode; mode != modeReadonly {
+		t.Errorf("stale revert switched %s to %s", modeReadonly, mode)
+	}
+}
+
+func TestModeScheduleRequestGrace(t *testing.T) {
+	useTestConfig(t)
+	tests := []struct {
+		name    string
+		body    modeScheduleRequest
+		wantErr bool
+	}{
+		{"grace inside window", modeScheduleRequest{Mode: modeMaintenance, Time: "03:00", Duration: "1h", Grace: "5m"}, false},
+		{"grace without window", modeScheduleRequest{Mode: modeMaintenance, Time: "03:00", Grace: "5m"}, false},
+		{"grace as long as window", modeScheduleRequest{Mode: modeMaintenance, Time: "03:00", Duration: "5m", Grace: "5m"}, true},
+		{"grace longer than window", modeScheduleRequest{Mode: modeMaintenance, Time: "03:00", Duration: "1m", Grace: "5m"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.body.schedule("alice"); (err != nil) != tt.wantErr {
+				t.Errorf("schedule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
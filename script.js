@@ -40,14 +40,28 @@
             const timestamp = Date.now();
             url = url + separator + '_t=' + timestamp;
         }
-        return originalFetch.call(this, url, options);
+        const request = originalFetch.call(this, url, options);
+        // Изменяющие запросы учитываются до завершения: save_complete отправляется только после них
+        if (options.method && options.method !== 'GET') {
+            pendingWrites.add(request);
+            request.finally(() => pendingWrites.delete(request)).catch(() => {});
+        }
+        return request;
     };
 })();
 
+// Страница, открытая по HTTPS, обращается к серверу по HTTPS и wss://
+const SERVER_SECURE = window.location.protocol === 'https:';
+
+// Фронтенд, встроенный в Go-сервер, обращается к своему origin; копия на GitHub Pages - к локальному серверу
+const SERVER_ORIGIN = window.location.protocol.startsWith('http') && !window.location.hostname.endsWith('github.io')
+    ? window.location.origin
+    : (SERVER_SECURE ? 'https' : 'http') + '://localhost:8068';
+
 const CONFIG = {
     USE_REAL_API: true,
-    API_URL: 'http://localhost:8068/api',
-    WS_URL: 'ws://localhost:8068/ws',
+    API_URL: SERVER_ORIGIN + '/api/v1',
+    WS_URL: SERVER_ORIGIN.replace(/^http/, 'ws') + '/ws',
     STORAGE_KEY: 'usermanager_local_data',
     VERSION: '2.1.0',
     LAST_UPDATE: new Date().toISOString(),
@@ -70,6 +84,9 @@ let pingInterval = null;
 let connectionTimeout = null;
 let isReloading = false;
 let clientId = null;
+let acknowledgedModeChange = null;
+const pendingWrites = new Set(); // изменяющие запросы, на которые еще нет ответа
+let trustedNetwork = false; // запрос из сети, доверенной в локальном режиме
 
 // Генерация уникального ID клиента
 function generateClientId() {
@@ -230,6 +247,11 @@ function connectWebSocket() {
                 ws.send(JSON.stringify(connectData));
             }
 
+            // Права администратора передаются одноразовым билетом, а не в URL
+            if (isAdmin) {
+                authenticateWebSocket();
+            }
+
             // Запускаем ping
             startPingInterval();
 
@@ -266,6 +288,22 @@ function connectWebSocket() {
     }
 }
 
+// Получает билет по сессии администратора и повышает права текущего WebSocket
+async function authenticateWebSocket() {
+    try {
+        const response = await fetch(`${CONFIG.API_URL}/ws-ticket`, {
+            method: 'POST',
+            headers: await adminAuthHeaders()
+        });
+        if (!response.ok) return;
+
+        const { ticket } = await response.json();
+        sendWebSocketMessage({ type: 'auth', ticket: ticket });
+    } catch (error) {
+        console.error('Ошибка получения билета WebSocket:', error);
+    }
+}
+
 function handleWebSocketMessage(data) {
     console.log('📨 WebSocket сообщение:', data.type);
 
@@ -273,11 +311,12 @@ function handleWebSocketMessage(data) {
         case 'connected':
             console.log('✅ Подтверждение подключения');
             currentServerMode = data.data.mode || 'server';
+            trustedNetwork = Boolean(data.data.trusted_network);
             updateCurrentMode(currentServerMode);
             updateClientsCount(data.data.clients || 1);
 
             // Проверяем, не заблокирован ли пользователь
-            if (currentServerMode === 'local' && !isAdmin) {
+            if (currentServerMode === 'local' && !canSeeLocalData()) {
                 console.log('🚫 Обычный пользователь в локальном режиме - показываем блокировку');
                 showBlockPage();
                 isBlocked = true;
@@ -291,7 +330,7 @@ function handleWebSocketMessage(data) {
             updateAdminButtons();
 
             // КРИТИЧЕСКО ВАЖНО: Если режим стал локальным и пользователь не админ
-            if (currentServerMode === 'local' && !isAdmin) {
+            if (currentServerMode === 'local' && !canSeeLocalData()) {
                 console.log('🚫 Режим изменился на локальный - блокируем обычного пользователя');
                 showBlockPage();
                 isBlocked = true;
@@ -332,12 +371,79 @@ function handleWebSocketMessage(data) {
             updateClientsCount(data.data.clients);
             break;
 
+        case 'app_version':
+            if (typeof updateChecker !== 'undefined') {
+                updateChecker.handleServerVersion(data.data);
+            }
+            break;
+
+        case 'server_shutdown':
+            // Сервер перезапускается: сбрасываем счетчик, чтобы переподключение не исчерпало попытки
+            console.log('🛑 Сервер останавливается, ожидаемый простой:', data.data.expected_downtime_seconds, 'с');
+            reconnectAttempts = 0;
+            updateConnectionStatus('reconnecting');
+            break;
+
+        case 'users_bulk_changed':
+            console.log('🧹 Массовая операция:', data.data.action, data.data.count);
+            if (!isBlocked) {
+                loadUsers();
+            }
+            break;
+
+        case 'admin_lockout':
+            // Сервер рассылает это сообщение только администраторам
+            if (data.data.scope === 'global') {
+                console.warn(`🔒 Административный вход заблокирован для всех на ${data.data.seconds} с`);
+            } else {
+                console.warn(`🔒 Заблокирован IP ${data.data.ip} после ${data.data.failures} неудачных попыток на ${data.data.seconds} с`);
+            }
+            break;
+
+        case 'auth_result':
+            console.log(`🔑 WebSocket: роль ${data.data.role}`);
+            break;
+
+        case 'mode_change_pending':
+            // Отсрочка перед сменой режима: показываем отсчет и подтверждаем сохранение один раз,
+            // когда сервер ответил на все отправленные изменения
+            showModeCountdown(data.data);
+            if (acknowledgedModeChange !== data.data.id) {
+                const changeId = data.data.id;
+                acknowledgedModeChange = changeId;
+                flushPendingWrites().then(() => {
+                    sendWebSocketMessage({ type: 'save_complete', change_id: changeId });
+                });
+            }
+            break;
+
+        case 'mode_change_cancelled':
+            console.log('↩️ Смена режима отменена:', data.data.cancelled_by);
+            document.getElementById('modeAnnouncement')?.remove();
+            break;
+
+        case 'save_ack':
+            console.log('💾 Сервер получил подтверждение сохранения:', data.data.accepted);
+            break;
+
+        case 'mode_change_upcoming':
+            console.log('⏰ Плановая смена режима:', data.data);
+            showModeAnnouncement(data.data);
+            break;
+
         case 'error':
-            console.error('❌ Ошибка сервера:', data.message);
+            console.error('❌ Ошибка сервера:', data.message || data.data);
             break;
     }
 }
 
+// Ожидание ответов на все изменяющие запросы, включая начатые во время ожидания
+async function flushPendingWrites() {
+    while (pendingWrites.size > 0) {
+        await Promise.allSettled([...pendingWrites]);
+    }
+}
+
 function sendWebSocketMessage(message) {
     if (ws && ws.readyState === WebSocket.OPEN) {
         try {
@@ -423,6 +529,28 @@ function updateConnectionStatus(status) {
 }
 
 // ============================ ФУНКЦИИ ДЛЯ АДМИНИСТРАТОРА ============================
+// Сессию выдает сервер: usermanager_admin_session хранит подписанный access-токен,
+// usermanager_admin_expiry - срок refresh-токена, то есть всей сессии
+const ADMIN_SESSION_KEYS = [
+    'usermanager_admin_session',
+    'usermanager_admin_refresh',
+    'usermanager_admin_expiry',
+    'usermanager_admin_access_expiry'
+];
+
+function saveAdminSession(tokens) {
+    localStorage.setItem('usermanager_admin_session', tokens.access_token);
+    localStorage.setItem('usermanager_admin_refresh', tokens.refresh_token);
+    localStorage.setItem('usermanager_admin_expiry', Date.parse(tokens.refresh_expires_at).toString());
+    localStorage.setItem('usermanager_admin_access_expiry', Date.parse(tokens.expires_at).toString());
+    isAdmin = true;
+}
+
+function clearAdminSession() {
+    ADMIN_SESSION_KEYS.forEach(key => localStorage.removeItem(key));
+    isAdmin = false;
+}
+
 function checkAdminAccess() {
     const savedAdmin = localStorage.getItem('usermanager_admin_session');
     const expiry = localStorage.getItem('usermanager_admin_expiry');
@@ -433,9 +561,7 @@ function checkAdminAccess() {
             return true;
         } else {
             // Очищаем просроченную сессию
-            localStorage.removeItem('usermanager_admin_session');
-            localStorage.removeItem('usermanager_admin_expiry');
-            isAdmin = false;
+            clearAdminSession();
             return false;
         }
     }
@@ -443,23 +569,60 @@ function checkAdminAccess() {
     return false;
 }
 
-function createAdminSession() {
-    const sessionId = 'admin_' + Date.now() + '_' + Math.random().toString(36).substr(2, 9);
-    const expiryTime = Date.now() + (24 * 60 * 60 * 1000);
+async function refreshAdminSession() {
+    const refreshToken = localStorage.getItem('usermanager_admin_refresh');
+    if (!refreshToken) {
+        clearAdminSession();
+        return false;
+    }
+
+    try {
+        const response = await fetch(`${CONFIG.API_URL}/auth/refresh`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ refresh_token: refreshToken })
+        });
+        if (!response.ok) {
+            // Сессия отозвана или истекла - нужен повторный вход
+            clearAdminSession();
+            updateAdminButtons();
+            return false;
+        }
+        saveAdminSession(await response.json());
+        return true;
+    } catch (error) {
+        console.error('Ошибка обновления сессии:', error);
+        return false;
+    }
+}
 
-    localStorage.setItem('usermanager_admin_session', sessionId);
-    localStorage.setItem('usermanager_admin_expiry', expiryTime.toString());
+// Заголовки администратора; access-токен обновляется за минуту до истечения
+async function adminAuthHeaders() {
+    if (!checkAdminAccess()) return {};
 
-    isAdmin = true;
-    console.log('✅ Администратор: новая сессия создана');
+    const accessExpiry = parseInt(localStorage.getItem('usermanager_admin_access_expiry') || '0');
+    if (Date.now() > accessExpiry - 60 * 1000 && !(await refreshAdminSession())) {
+        return {};
+    }
+    return { 'Authorization': 'Bearer ' + localStorage.getItem('usermanager_admin_session') };
 }
 
-function logoutAdmin() {
+async function logoutAdmin() {
     if (confirm('Вы уверены, что хотите выйти из режима администратора?')) {
-        localStorage.removeItem('usermanager_admin_session');
-        localStorage.removeItem('usermanager_admin_expiry');
+        try {
+            await fetch(`${CONFIG.API_URL}/auth/logout`, {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json',
+                    'Authorization': 'Bearer ' + localStorage.getItem('usermanager_admin_session')
+                },
+                body: JSON.stringify({ refresh_token: localStorage.getItem('usermanager_admin_refresh') || '' })
+            });
+        } catch (error) {
+            console.error('Ошибка завершения сессии на сервере:', error);
+        }
 
-        isAdmin = false;
+        clearAdminSession();
         updateAdminButtons();
 
         alert('✅ Вы вышли из режима администратора.');
@@ -576,20 +739,27 @@ function showAdminLoginModal() {
     }, 100);
 }
 
-function processAdminLogin() {
+async function processAdminLogin() {
     const passwordInput = document.getElementById('adminPasswordInput');
     const errorDiv = document.getElementById('loginError');
 
-    if (!passwordInput) return;
+    if (!passwordInput || passwordInput.value === '') return;
 
-    if (passwordInput.value === "D607206fd-") {
-        // Создаем сессию
-        const sessionId = 'admin_' + Date.now() + '_' + Math.random().toString(36).substr(2, 9);
-        const expiryTime = Date.now() + (24 * 60 * 60 * 1000);
+    let response;
+    try {
+        response = await fetch(`${CONFIG.API_URL}/auth/login`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ password: passwordInput.value })
+        });
+    } catch (error) {
+        alert(`❌ Ошибка: ${error.message}\n\nПроверьте подключение к серверу.`);
+        return;
+    }
 
-        localStorage.setItem('usermanager_admin_session', sessionId);
-        localStorage.setItem('usermanager_admin_expiry', expiryTime.toString());
-        isAdmin = true;
+    if (response.ok) {
+        // Сохраняем выданную сервером сессию
+        saveAdminSession(await response.json());
 
         // Обновляем интерфейс
         updateAdminButtons();
@@ -604,13 +774,18 @@ function processAdminLogin() {
             document.body.classList.remove('blocked');
         }
 
-        // Перезагружаем данные
+        // Перезагружаем данные и повышаем права открытого WebSocket
         loadInitialData();
+        authenticateWebSocket();
 
         // Показываем уведомление
         alert('✅ Успешный вход как администратор!');
 
-    } else if (passwordInput.value !== '') {
+    } else {
+        if (response.status === 429) {
+            const error = await response.json();
+            errorDiv.textContent = error.error || 'Слишком много попыток, попробуйте позже';
+        }
         errorDiv.style.display = 'block';
         passwordInput.value = '';
         passwordInput.focus();
@@ -631,19 +806,19 @@ async function toggleServerMode() {
     }
 
     try {
+        // Из режимов только для чтения и технических работ кнопка возвращает серверный режим
         const newMode = currentServerMode === "server" ? "local" : "server";
 
         console.log(`🔄 Администратор переключает режим на: ${newMode}`);
 
-        const response = await fetch('http://localhost:8068/api/admin/mode', {
+        const response = await fetch(`${CONFIG.API_URL}/admin/mode`, {
             method: 'POST',
             headers: {
                 'Content-Type': 'application/json',
-                'X-Admin-Password': 'D607206fd-'
+                ...(await adminAuthHeaders())
             },
             body: JSON.stringify({
-                mode: newMode,
-                password: 'D607206fd-'
+                mode: newMode
             })
         });
 
@@ -674,26 +849,42 @@ async function toggleServerMode() {
 }
 
 // ============================ ОБНОВЛЕНИЕ ИНТЕРФЕЙСА ============================
+// Данные локального режима видят администраторы и клиенты из доверенных сетей
+function canSeeLocalData() {
+    return isAdmin || trustedNetwork;
+}
+
+const MODE_LABELS = {
+    server: 'Серверный',
+    local: 'Локальный',
+    readonly: 'Только чтение',
+    maintenance: 'Технические работы'
+};
+
+function modeLabel(mode) {
+    return MODE_LABELS[mode] || mode;
+}
+
 function updateCurrentMode(mode) {
     const modeText = document.getElementById('currentModeText');
     const statusValue = document.getElementById('statusValue');
 
     if (modeText) {
-        if (mode === 'local' && !isAdmin) {
+        if (mode === 'local' && !canSeeLocalData()) {
             modeText.textContent = 'Режим: Локальный (доступ закрыт)';
             modeText.style.color = '#ef4444';
         } else {
-            modeText.textContent = `Режим: ${mode === 'local' ? 'Локальный' : 'Серверный'}`;
-            modeText.style.color = mode === 'local' ? '#f59e0b' : '#4ade80';
+            modeText.textContent = `Режим: ${modeLabel(mode)}`;
+            modeText.style.color = mode === 'server' ? '#4ade80' : '#f59e0b';
         }
     }
 
     if (statusValue) {
-        if (mode === 'local' && !isAdmin) {
+        if (mode === 'local' && !canSeeLocalData()) {
             statusValue.textContent = 'Заблокирован';
             statusValue.style.color = '#ef4444';
         } else {
-            statusValue.textContent = mode === 'server' ? 'Онлайн' : 'Локально';
+            statusValue.textContent = mode === 'server' ? 'Онлайн' : modeLabel(mode);
             statusValue.style.color = mode === 'server' ? '#4ade80' : '#f59e0b';
         }
     }
@@ -711,7 +902,7 @@ function updateAdminButtons() {
             // Обновляем текст кнопки
             adminBtn.innerHTML = `
                 <i class="fas fa-cogs"></i>
-                <span>Режим: ${currentServerMode === 'local' ? 'Локальный' : 'Серверный'}</span>
+                <span>Режим: ${modeLabel(currentServerMode)}</span>
             `;
         } else {
             adminBtn.style.display = 'none';
@@ -742,11 +933,12 @@ async function loadInitialData() {
         if (statusResponse.ok) {
             const status = await statusResponse.json();
             currentServerMode = status.mode;
+            trustedNetwork = Boolean(status.trusted_network);
             updateCurrentMode(status.mode);
             updateClientsCount(status.clients || 1);
 
             // КРИТИЧЕСКО ВАЖНО: Проверяем блокировку
-            if (status.mode === 'local' && !isAdmin) {
+            if (status.mode === 'local' && !canSeeLocalData()) {
                 console.log('🚫 Обычный пользователь в локальном режиме - показываем блокировку');
                 showBlockPage();
                 isBlocked = true;
@@ -849,9 +1041,10 @@ function updateStats(stats) {
 }
 
 // ============================ УТИЛИТЫ ============================
-function fetchWithTimeout(url, timeout = 5000) {
+async function fetchWithTimeout(url, timeout = 5000) {
+    const headers = await adminAuthHeaders();
     return Promise.race([
-        fetch(url + (url.includes('?') ? '&' : '?') + '_t=' + Date.now()),
+        fetch(url + (url.includes('?') ? '&' : '?') + '_t=' + Date.now(), { headers }),
         new Promise((_, reject) =>
             setTimeout(() => reject(new Error('Таймаут запроса')), timeout)
         )
@@ -877,6 +1070,33 @@ function clearCache() {
     }
 }
 
+// Баннер о скорой смене режима
+function modeBanner() {
+    let banner = document.getElementById('modeAnnouncement');
+    if (!banner) {
+        banner = document.createElement('div');
+        banner.id = 'modeAnnouncement';
+        banner.style.cssText = 'position:fixed;top:0;left:0;right:0;z-index:10000;padding:0.75rem;' +
+            'background:#f59e0b;color:#1f2937;text-align:center;font-weight:600;';
+        document.body.appendChild(banner);
+    }
+    return banner;
+}
+
+// Обратный отсчет отложенной смены режима
+function showModeCountdown(info) {
+    modeBanner().textContent = `Через ${info.seconds_left} с режим сменится на «${modeLabel(info.mode)}»` +
+        (info.message ? `: ${info.message}` : '');
+}
+
+function showModeAnnouncement(info) {
+    const banner = modeBanner();
+    const minutes = Math.max(1, Math.round(info.in_seconds / 60));
+    banner.textContent = `Через ${minutes} мин. режим сменится на «${modeLabel(info.mode)}»` +
+        (info.message ? `: ${info.message}` : '');
+    setTimeout(() => banner.remove(), Math.max(info.in_seconds, 5) * 1000);
+}
+
 function showBlockPage() {
     if (document.body.classList.contains('blocked')) return;
 
@@ -2,14 +2,24 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 	
 	"github.com/gorilla/websocket"
@@ -23,6 +33,12 @@ type User struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// userRequest - тело POST и PUT /api/v1/users: id и created_at назначает сервер
+type userRequest struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
 // InMemoryDB простая база данных в памяти
 type InMemoryDB struct {
 	users  map[int]User
@@ -32,25 +48,28 @@ type InMemoryDB struct {
 
 var db *InMemoryDB
 
+// errClientGone - соединение уже удалено из списка клиентов
+var errClientGone = errors.New("websocket client disconnected")
+
 // Глобальные переменные для управления режимом и клиентами
 var (
-	serverMode     = "server" // "server" или "local"
+	serverMode     = modeServer // один из modePolicies
+	modeMessage    string       // пояснение режима от администратора
+	modeETA        *time.Time   // ожидаемое окончание режима
 	modeMutex      sync.RWMutex
 	lastModeChange time.Time
 	startTime      time.Time
 	
 	// WebSocket
 	upgrader = websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool {
-			return true
-		},
+		CheckOrigin:      checkWSOrigin,
 		HandshakeTimeout: 5 * time.Second,
 		ReadBufferSize:   1024,
 		WriteBufferSize:  1024,
 	}
 	
-	// Клиенты WebSocket
-	clients    = make(map[*websocket.Conn]bool)
+	// Клиенты WebSocket; значение - блокировка записи в соединение
+	clients    = make(map[*websocket.Conn]*sync.Mutex)
 	clientsMu  sync.RWMutex
 	
 	// Клиентская информация
@@ -61,9 +80,13 @@ var (
 type ClientData struct {
 	IP        string
 	IsAdmin   bool
+	Name      string // учетная запись или apikey:<id>; пусто - аноним
+	Role      string
 	LastSeen  time.Time
 	UserAgent string
 	ClientID  string
+
+	session string // access-токен сессии, давшей права; сверяется перед привилегированными действиями
 }
 
 func init() {
@@ -83,11 +106,13 @@ func init() {
 
 // Функция отправки сообщения всем клиентам с оптимизацией
 func broadcastToAll(messageType string, data interface{}) {
+	started := time.Now()
+
 	// Создаем копию клиентов для безопасной итерации
 	clientsMu.RLock()
-	clientsCopy := make([]*websocket.Conn, 0, len(clients))
-	for client := range clients {
-		clientsCopy = append(clientsCopy, client)
+	clientsCopy := make(map[*websocket.Conn]*sync.Mutex, len(clients))
+	for client, writeMu := range clients {
+		clientsCopy[client] = writeMu
 	}
 	clientsMu.RUnlock()
 	
@@ -100,17 +125,17 @@ func broadcastToAll(messageType string, data interface{}) {
 	
 	jsonMessage, err := json.Marshal(message)
 	if err != nil {
-		log.Printf("❌ Ошибка маршалинга сообщения: %v", err)
+		logWS.Error("ошибка маршалинга сообщения", "type", messageType, "error", err)
 		return
 	}
 	
 	activeClients := 0
 	deadClients := make([]*websocket.Conn, 0)
 	
-	for _, client := range clientsCopy {
+	for client, writeMu := range clientsCopy {
 		// Проверяем, существует ли еще соединение
 		clientsMu.RLock()
-		exists := clients[client]
+		_, exists := clients[client]
 		clientsMu.RUnlock()
 		
 		if !exists {
@@ -124,27 +149,26 @@ func broadcastToAll(messageType string, data interface{}) {
 		}
 		infoMu.Unlock()
 		
-		// Устанавливаем таймаут на запись
-		client.SetWriteDeadline(time.Now().Add(3 * time.Second))
-		
 		// Отправляем сообщение
-		err := client.WriteMessage(websocket.TextMessage, jsonMessage)
+		err := writeToClient(client, writeMu, jsonMessage)
 		
 		if err != nil {
-			log.Printf("❌ Ошибка отправки клиенту: %v", err)
+			logWS.Warn("ошибка отправки клиенту", "type", messageType, "error", err)
 			deadClients = append(deadClients, client)
 		} else {
 			activeClients++
 		}
 	}
 	
+	observeBroadcast(messageType, time.Since(started), len(deadClients))
+	
 	// Удаляем мертвых клиентов
 	if len(deadClients) > 0 {
 		go cleanupDeadClients(deadClients)
 	}
 	
 	if activeClients > 0 {
-		log.Printf("📢 Отправлено сообщение '%s' для %d/%d клиентов", messageType, activeClients, len(clientsCopy))
+		logWS.Debug("сообщение разослано", "type", messageType, "delivered", activeClients, "clients", len(clientsCopy))
 	}
 }
 
@@ -162,7 +186,7 @@ func cleanupDeadClients(deadClients []*websocket.Conn) {
 	infoMu.Unlock()
 	clientsMu.Unlock()
 	
-	log.Printf("🧹 Очищено %d мертвых клиентов", len(deadClients))
+	logWS.Info("очищены мертвые клиенты", "count", len(deadClients))
 }
 
 // Функция отправки сообщения конкретному клиенту с таймаутом
@@ -178,23 +202,66 @@ func sendToClient(client *websocket.Conn, messageType string, data interface{})
 		return err
 	}
 	
+	clientsMu.RLock()
+	writeMu, exists := clients[client]
+	clientsMu.RUnlock()
+	if !exists {
+		return errClientGone
+	}
+	return writeToClient(client, writeMu, jsonMessage)
+}
+
+// writeToClient пишет сообщение под блокировкой соединения: gorilla/websocket допускает
+// только одного писателя, а пишут обработчик сообщений, рассылки и фоновые задачи
+func writeToClient(client *websocket.Conn, writeMu *sync.Mutex, message []byte) error {
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	
 	// Устанавливаем таймаут на запись
 	client.SetWriteDeadline(time.Now().Add(3 * time.Second))
-	return client.WriteMessage(websocket.TextMessage, jsonMessage)
+	return client.WriteMessage(websocket.TextMessage, message)
+}
+
+// broadcastToAdmins отправляет сообщение только клиентам с правами администратора
+func broadcastToAdmins(messageType string, data interface{}) {
+	infoMu.RLock()
+	admins := make([]*websocket.Conn, 0)
+	for client, info := range clientInfo {
+		if info.IsAdmin {
+			admins = append(admins, client)
+		}
+	}
+	infoMu.RUnlock()
+
+	for _, client := range admins {
+		// Сессия могла закончиться после подключения
+		if _, role, exists := clientPrincipal(client); !exists || role != roleAdmin {
+			continue
+		}
+		if err := sendToClient(client, messageType, data); err != nil {
+			logWS.Warn("ошибка отправки администратору", "type", messageType, "error", err)
+		}
+	}
 }
 
 // Обработчик WebSocket с оптимизациями
 func handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	// Во время остановки новые подключения не принимаем
+	if shuttingDown.Load() {
+		sendError(w, http.StatusServiceUnavailable, "Server is shutting down")
+		return
+	}
+	
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("❌ Ошибка обновления WebSocket: %v", err)
+		logWS.WarnContext(r.Context(), "ошибка обновления WebSocket", "error", err)
 		return
 	}
 	
 	// Устанавливаем таймауты
-	conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	conn.SetReadDeadline(time.Now().Add(cfg.ReadDeadline.Duration))
 	conn.SetPongHandler(func(string) error {
-		conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		conn.SetReadDeadline(time.Now().Add(cfg.ReadDeadline.Duration))
 		
 		// Обновляем время последней активности
 		infoMu.Lock()
@@ -208,8 +275,9 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	
 	// Регистрируем клиента
 	clientsMu.Lock()
-	clients[conn] = true
+	clients[conn] = new(sync.Mutex)
 	clientsMu.Unlock()
+	wsConnectsTotal.Add(1)
 	
 	// Получаем или генерируем ClientID
 	clientID := r.URL.Query().Get("clientId")
@@ -217,54 +285,68 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		clientID = "client_" + strconv.FormatInt(time.Now().UnixNano(), 10)
 	}
 	
-	// Сохраняем информацию о клиенте
-	ip := strings.Split(r.RemoteAddr, ":")[0]
+	// Сохраняем информацию о клиенте; права определяются один раз при подключении
+	// и дальше меняются только сообщениями auth
+	ip := clientIP(r)
+	principal, session := wsPrincipal(r)
+	role := roleAnonymous
+	if principal != "" {
+		role = roleOf(principal)
+	}
 	infoMu.Lock()
 	clientInfo[conn] = &ClientData{
 		IP:        ip,
-		IsAdmin:   checkAdminAccess(r),
+		IsAdmin:   role == roleAdmin,
+		Name:      principal,
+		Role:      role,
 		LastSeen:  time.Now(),
 		UserAgent: r.UserAgent(),
 		ClientID:  clientID,
+		session:   session,
 	}
 	infoMu.Unlock()
 	
-	log.Printf("🔗 Новый WebSocket клиент подключен: %s (ID: %s, Всего: %d)", ip, clientID, len(clients))
+	clientLog := logWS.With("client_id", clientID, "ip", ip, "request_id", requestIDFrom(r.Context()))
+	clientLog.Info("WebSocket клиент подключен", "role", role, "user", principal, "clients", clientCount())
 	
 	// Отправляем приветственное сообщение с таймаутом
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
 	
 	go func() {
+		// Контекст отменяется горутиной, а не обработчиком, который завершается сразу
+		defer cancel()
+		
 		select {
 		case <-ctx.Done():
-			log.Printf("⚠️ Таймаут отправки приветственного сообщения клиенту %s", clientID)
+			clientLog.Warn("таймаут отправки приветственного сообщения")
 			return
 		default:
-			modeMutex.RLock()
-			currentMode := serverMode
-			modeMutex.RUnlock()
+			welcomeMsg := currentModeState().info()
+			welcomeMsg["clients"] = clientCount()
+			welcomeMsg["is_admin"] = role == roleAdmin
+			welcomeMsg["role"] = role
+			welcomeMsg["trusted_network"] = trustedRequest(r)
+			welcomeMsg["server_time"] = time.Now().Format("2006-01-02 15:04:05")
+			welcomeMsg["client_id"] = clientID
 			
-			welcomeMsg := map[string]interface{}{
-				"mode":        currentMode,
-				"clients":     len(clients),
-				"is_admin":    checkAdminAccess(r),
-				"server_time": time.Now().Format("2006-01-02 15:04:05"),
-				"client_id":   clientID,
+			if err := sendToClient(conn, "connected", welcomeMsg); err != nil {
+				clientLog.Warn("ошибка отправки приветствия", "error", err)
+				return
 			}
 			
-			if err := sendToClient(conn, "connected", welcomeMsg); err != nil {
-				log.Printf("❌ Ошибка отправки приветствия клиенту %s: %v", clientID, err)
+			// Версия сервера позволяет фронтенду обнаружить, что он устарел
+			if err := sendToClient(conn, "app_version", versionInfo()); err != nil {
+				clientLog.Warn("ошибка отправки версии", "error", err)
 			}
 		}
 	}()
 	
 	// Обрабатываем сообщения от клиента
-	go handleClientMessages(conn, ip, clientID)
+	go handleClientMessages(conn, r, clientLog)
 }
 
 // Обработка сообщений от клиента
-func handleClientMessages(conn *websocket.Conn, ip, clientID string) {
+func handleClientMessages(conn *websocket.Conn, upgrade *http.Request, clientLog *slog.Logger) {
 	defer func() {
 		// Удаляем клиента при отключении
 		clientsMu.Lock()
@@ -275,14 +357,14 @@ func handleClientMessages(conn *websocket.Conn, ip, clientID string) {
 		infoMu.Unlock()
 		conn.Close()
 		
-		log.Printf("🔗 WebSocket клиент отключен: %s (ID: %s, Осталось: %d)", ip, clientID, len(clients))
+		clientLog.Info("WebSocket клиент отключен", "clients", clientCount())
 	}()
 	
 	for {
 		messageType, message, err := conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("❌ WebSocket ошибка чтения от %s: %v", clientID, err)
+				clientLog.Warn("ошибка чтения WebSocket", "error", err)
 			}
 			break
 		}
@@ -290,11 +372,53 @@ func handleClientMessages(conn *websocket.Conn, ip, clientID string) {
 		if messageType == websocket.TextMessage {
 			var msg map[string]interface{}
 			if err := json.Unmarshal(message, &msg); err != nil {
-				log.Printf("❌ Ошибка парсинга сообщения от %s: %v", clientID, err)
+				clientLog.Warn("ошибка парсинга сообщения", "error", err)
+				continue
+			}
+			
+			msgType, _ := msg["type"].(string)
+			if permission, restricted := wsMessagePermissions[msgType]; restricted && !clientAllows(conn, permission) {
+				clientLog.Warn("отклонено сообщение без разрешения", "type", msgType, "permission", permission)
+				sendToClient(conn, "error", map[string]interface{}{
+					"code":       "forbidden",
+					"type":       msgType,
+					"permission": permission,
+				})
 				continue
 			}
 			
-			switch msg["type"] {
+			switch msgType {
+			case "auth":
+				name, role, ok := handleWSAuth(conn, upgrade, msg)
+				if !ok {
+					clientLog.Warn("отклонена аутентификация WebSocket")
+					sendToClient(conn, "error", map[string]interface{}{"code": "auth_failed"})
+					continue
+				}
+				clientLog.Info("права WebSocket клиента изменены", "role", role, "user", name)
+				sendToClient(conn, "auth_result", map[string]interface{}{
+					"user":     name,
+					"role":     role,
+					"is_admin": role == roleAdmin,
+				})
+				
+			case "save_complete":
+				// Клиент сохранил работу перед отложенной сменой режима
+				changeID, _ := msg["change_id"].(string)
+				accepted := acknowledgePendingMode(changeID, conn)
+				clientLog.Debug("клиент сохранил работу", "change_id", changeID, "accepted", accepted)
+				sendToClient(conn, "save_ack", map[string]interface{}{
+					"change_id": changeID,
+					"accepted":  accepted,
+				})
+				
+			case "get_clients":
+				clientsList := clientsSnapshot()
+				sendToClient(conn, "clients_list", map[string]interface{}{
+					"clients": clientsList,
+					"total":   len(clientsList),
+				})
+				
 			case "ping":
 				// Обновляем время последней активности
 				infoMu.Lock()
@@ -311,7 +435,7 @@ func handleClientMessages(conn *websocket.Conn, ip, clientID string) {
 				
 			case "pong":
 				// Обновляем таймаут чтения
-				conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+				conn.SetReadDeadline(time.Now().Add(cfg.ReadDeadline.Duration))
 				infoMu.Lock()
 				if info, exists := clientInfo[conn]; exists {
 					info.LastSeen = time.Now()
@@ -330,14 +454,9 @@ func handleClientMessages(conn *websocket.Conn, ip, clientID string) {
 				
 			case "get_mode":
 				// Отправляем текущий режим
-				modeMutex.RLock()
-				currentMode := serverMode
-				modeMutex.RUnlock()
-				
-				sendToClient(conn, "mode_info", map[string]interface{}{
-					"mode":    currentMode,
-					"clients": len(clients),
-				})
+				modeInfo := currentModeState().info()
+				modeInfo["clients"] = clientCount()
+				sendToClient(conn, "mode_info", modeInfo)
 				
 			default:
 				// Обновляем время последней активности для любого сообщения
@@ -352,17 +471,39 @@ func handleClientMessages(conn *websocket.Conn, ip, clientID string) {
 }
 
 // CORS middleware
-func enableCORS(next http.HandlerFunc) http.HandlerFunc {
+func enableCORS(policy string, next http.HandlerFunc) http.HandlerFunc {
+	maxAge := strconv.Itoa(int(cfg.CORS.MaxAge.Seconds()))
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Admin-Password, X-Admin-Token")
 		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 		w.Header().Set("Pragma", "no-cache")
 		w.Header().Set("Expires", "0")
+		w.Header().Add("Vary", "Origin")
+
+		// Запрос с чужого origin не выполняется: браузер все равно не отдал бы ответ,
+		// а изменяющие запросы сработали бы как CSRF
+		if !originAllowed(r, policy) {
+			rejectOrigin(r, policy)
+			sendError(w, http.StatusForbidden, "Origin not allowed")
+			return
+		}
+
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if policy == corsPublic {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				if cfg.CORS.AllowCredentials {
+					w.Header().Set("Access-Control-Allow-Credentials", "true")
+				}
+			}
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Admin-User, X-Admin-Password, X-Admin-Token, X-Request-ID")
+			w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
+		}
 
 		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
+			w.Header().Set("Access-Control-Max-Age", maxAge)
+			w.WriteHeader(http.StatusNoContent)
 			return
 		}
 
@@ -370,31 +511,102 @@ func enableCORS(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-// Проверка режима работы с оптимизацией
-func checkModeMiddleware(next http.HandlerFunc) http.HandlerFunc {
+// Максимальная длина входящего X-Request-ID
+const maxRequestIDLength = 128
+
+// validRequestID допускает только безопасные для журнала символы
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == ':') {
+			return false
+		}
+	}
+	return true
+}
+
+// Request ID middleware: берет X-Request-ID клиента или генерирует новый
+func withRequestID(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = randomHex(8)
+		}
+		w.Header().Set("X-Request-ID", id)
+		next(w, r.WithContext(withAuthMemo(withRequestIDContext(r.Context(), id))))
+	}
+}
+
+// Access log middleware
+func accessLog(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w}
+
+		next(rec, r)
+
+		level := slog.LevelInfo
+		if rec.Status() >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		logHTTP.Log(r.Context(), level, "запрос обработан",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.Status(),
+			"bytes", rec.bytes,
+			"latency_ms", float64(time.Since(start).Microseconds())/1000,
+			"client_ip", clientIP(r),
+		)
+	}
+}
+
+// clientIP возвращает IP клиента без порта (в том числе для IPv6)
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Проверка режима работы: действия API, закрытые режимом, получают 503,
+// страницы фронтенда - 404 в локальном режиме и 503 во время технических работ
+func checkModeMiddleware(permission string, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		modeMutex.RLock()
-		currentMode := serverMode
-		modeMutex.RUnlock()
+		state := currentModeState()
+		currentMode := state.Mode
+		name, role := requestRole(r)
 		
-		// Всегда разрешаем доступ к этим endpoint-ам
-		if r.URL.Path == "/api/mode" || r.URL.Path == "/api/admin/mode" || 
-		   r.URL.Path == "/api/stats" || r.URL.Path == "/" ||
-		   r.URL.Path == "/api/status" || r.URL.Path == "/api/info" ||
-		   r.URL.Path == "/api/health" || r.URL.Path == "/api/check-mode" ||
-		   r.URL.Path == "/ws" || strings.HasPrefix(r.URL.Path, "/api/") {
+		if permission != "" {
+			if modeBlocked(currentMode, name, role, permission) {
+				denyMode(w, r, state, permission)
+				return
+			}
 			next(w, r)
 			return
 		}
 		
-		// Если режим локальный, проверяем админский доступ
-		if currentMode == "local" {
-			isAdmin := checkAdminAccess(r)
-			
-			// Если это не админ - возвращаем 404
-			if !isAdmin {
+		// Неизвестные пути API и /ws не относятся к страницам фронтенда
+		if r.URL.Path == "/ws" || strings.HasPrefix(r.URL.Path, "/api/") {
+			next(w, r)
+			return
+		}
+		
+		// Без чтения данных фронтенд бесполезен: показываем страницу технических работ
+		if modeBlocked(currentMode, name, role, permUsersRead) {
+			maintenancePage(w, state)
+			return
+		}
+		
+		// Если данные режима скрыты, проверяем доступ к ним
+		if modePolicies[currentMode].HideData {
+			// Без local:access и не из доверенной сети - возвращаем 404
+			if !hasPermission(r, permLocalAccess) {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
 				w.WriteHeader(http.StatusNotFound)
-				w.Header().Set("Content-Type", "text/html")
 				
 				html := fmt.Sprintf(`<!DOCTYPE html>
 <html lang="ru">
@@ -489,13 +701,14 @@ func checkModeMiddleware(next http.HandlerFunc) http.HandlerFunc {
     </div>
     <script>
         function checkForUpdates() {
-            fetch('/api/check-mode?_=' + Date.now())
+            fetch('/api/v1/check-mode?_=' + Date.now())
                 .then(response => response.json())
                 .then(data => {
-                    if (data.mode === 'server') {
+                    // Страница нужна, пока режим скрывает данные: в остальных режимах перезагружаемся
+                    if (!data.hide_data) {
                         location.reload(true);
                     } else {
-                        alert('Режим все еще локальный. Попробуйте позже.');
+                        alert('Данные все еще скрыты режимом. Попробуйте позже.');
                     }
                 });
         }
@@ -515,25 +728,6 @@ func checkModeMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-// Проверка админского доступа
-func checkAdminAccess(r *http.Request) bool {
-	// Проверяем админские заголовки
-	adminToken := r.Header.Get("X-Admin-Token")
-	adminPassword := r.Header.Get("X-Admin-Password")
-	
-	if adminToken == "admin_local_token_123" || adminPassword == "D607206fd-" {
-		return true
-	}
-	
-	// Проверяем query параметры
-	tokenFromQuery := r.URL.Query().Get("admin_token")
-	if tokenFromQuery == "admin_local_token_123" {
-		return true
-	}
-	
-	return false
-}
-
 // validateUser проверяет обязательные поля
 func validateUser(user User) error {
 	if strings.TrimSpace(user.Name) == "" {
@@ -623,9 +817,24 @@ func sendJSON(w http.ResponseWriter, status int, data interface{}) {
 	json.NewEncoder(w).Encode(data)
 }
 
-// sendError отправляет JSON-ошибку
+// errorResponse - тело ответа с ошибкой
+type errorResponse struct {
+	Error     string `json:"error"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// sendError отправляет JSON-ошибку с идентификатором запроса
 func sendError(w http.ResponseWriter, status int, message string) {
-	sendJSON(w, status, map[string]string{"error": message})
+	sendJSON(w, status, errorResponse{Error: message, RequestID: w.Header().Get("X-Request-ID")})
+}
+
+// randomHex возвращает случайную hex-строку из n байт
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
 }
 
 // Обработчики HTTP
@@ -641,116 +850,147 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
 	modeMutex.RUnlock()
 	
 	sendJSON(w, http.StatusOK, map[string]interface{}{
-		"message": "UserManager Pro API",
-		"version": "1.0.0",
-		"mode":    currentMode,
-		"clients": len(clients),
-		"docs":    "/api/info",
-		"uptime":  time.Since(startTime).String(),
+		"message":  "UserManager Pro API",
+		"version":  appVersion(),
+		"mode":     currentMode,
+		"clients":  clientCount(),
+		"docs":     "/api/v1/docs",
+		"openapi":  "/api/v1/openapi.json",
+		"versions": apiVersions(),
+		"uptime":   time.Since(startTime).String(),
 	})
 }
 
-func apiUsersHandler(w http.ResponseWriter, r *http.Request) {
+// localModeDenied отвечает 404 запросам без local:access, пока активен локальный режим
+func localModeDenied(w http.ResponseWriter, r *http.Request) bool {
 	modeMutex.RLock()
 	currentMode := serverMode
 	modeMutex.RUnlock()
-	
-	// В локальном режиме проверяем админский доступ
-	if currentMode == "local" {
-		if !checkAdminAccess(r) {
-			sendError(w, http.StatusNotFound, "Локальный режим активен")
-			return
-		}
+
+	if modePolicies[currentMode].HideData && !hasPermission(r, permLocalAccess) {
+		sendError(w, http.StatusNotFound, "Локальный режим активен")
+		return true
 	}
-	
-	switch r.Method {
-	case http.MethodGet:
-		users := db.GetAll()
-		sendJSON(w, http.StatusOK, users)
+	return false
+}
 
-	case http.MethodPost:
-		var user User
-		if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-			sendError(w, http.StatusBadRequest, "Invalid JSON")
-			return
-		}
+// userIDFromPath читает {id} из шаблона маршрута
+func userIDFromPath(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		sendError(w, http.StatusBadRequest, "Invalid user ID")
+		return 0, false
+	}
+	return id, true
+}
 
-		newUser, err := db.Add(user)
-		if err != nil {
-			sendError(w, http.StatusBadRequest, err.Error())
-			return
-		}
-		sendJSON(w, http.StatusCreated, newUser)
+// GET /api/v1/users
+func listUsersHandler(w http.ResponseWriter, r *http.Request) {
+	sendJSON(w, http.StatusOK, db.GetAll())
+}
 
-	default:
-		sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+// POST /api/v1/users
+func createUserHandler(w http.ResponseWriter, r *http.Request) {
+	var body userRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		sendError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	newUser, err := db.Add(User{Name: body.Name, Email: body.Email})
+	if err != nil {
+		sendError(w, http.StatusBadRequest, err.Error())
+		return
 	}
+	sendJSON(w, http.StatusCreated, newUser)
 }
 
-func apiUserHandler(w http.ResponseWriter, r *http.Request) {
-	modeMutex.RLock()
-	currentMode := serverMode
-	modeMutex.RUnlock()
-	
-	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(pathParts) != 3 {
-		sendError(w, http.StatusBadRequest, "Invalid URL")
+// GET /api/v1/users/{id}
+func getUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := userIDFromPath(w, r)
+	if !ok {
 		return
 	}
 
-	idStr := pathParts[2]
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		sendError(w, http.StatusBadRequest, "Invalid user ID")
+	user, exists := db.GetByID(id)
+	if !exists {
+		sendError(w, http.StatusNotFound, "User not found")
 		return
 	}
+	sendJSON(w, http.StatusOK, user)
+}
 
-	// В локальном режиме проверяем админский доступ
-	if currentMode == "local" {
-		if !checkAdminAccess(r) {
-			sendError(w, http.StatusNotFound, "Локальный режим активен")
-			return
-		}
+// PUT /api/v1/users/{id}
+func updateUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := userIDFromPath(w, r)
+	if !ok {
+		return
 	}
 
-	switch r.Method {
-	case http.MethodGet:
-		user, exists := db.GetByID(id)
-		if !exists {
-			sendError(w, http.StatusNotFound, "User not found")
-			return
-		}
-		sendJSON(w, http.StatusOK, user)
+	var body userRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		sendError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
 
-	case http.MethodPut:
-		var user User
-		if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-			sendError(w, http.StatusBadRequest, "Invalid JSON")
-			return
+	if err := db.Update(id, User{Name: body.Name, Email: body.Email}); err != nil {
+		status := http.StatusBadRequest
+		if err.Error() == "user not found" {
+			status = http.StatusNotFound
 		}
+		sendError(w, status, err.Error())
+		return
+	}
+	user, _ := db.GetByID(id)
+	sendJSON(w, http.StatusOK, user)
+}
 
-		if err := db.Update(id, user); err != nil {
-			status := http.StatusInternalServerError
-			if err.Error() == "user not found" {
-				status = http.StatusNotFound
-			} else {
-				status = http.StatusBadRequest
-			}
-			sendError(w, status, err.Error())
-			return
-		}
-		sendJSON(w, http.StatusOK, user)
+// DELETE /api/v1/users/{id}
+func deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := userIDFromPath(w, r)
+	if !ok {
+		return
+	}
 
-	case http.MethodDelete:
-		if deleted := db.Delete(id); !deleted {
-			sendError(w, http.StatusNotFound, "User not found")
-			return
-		}
-		w.WriteHeader(http.StatusNoContent)
+	if deleted := db.Delete(id); !deleted {
+		sendError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	default:
-		sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+// GET /api/v1/admin/users/export
+func usersExportHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		sendError(w, http.StatusBadRequest, "Format must be 'csv' or 'json'")
+		return
+	}
+
+	users := db.GetAll()
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	name, role := requestRole(r)
+	logHTTP.InfoContext(r.Context(), "экспорт пользователей", "admin", name, "role", role, "format", format, "count", len(users))
+
+	filename := "users-" + time.Now().Format("20060102-150405") + "." + format
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	if format == "json" {
+		sendJSON(w, http.StatusOK, users)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	out := csv.NewWriter(w)
+	out.Write([]string{"id", "name", "email", "created_at"})
+	for _, user := range users {
+		out.Write([]string{strconv.Itoa(user.ID), user.Name, user.Email, user.CreatedAt.UTC().Format(time.RFC3339)})
 	}
+	out.Flush()
 }
 
 func apiStatsHandler(w http.ResponseWriter, r *http.Request) {
@@ -764,20 +1004,21 @@ func apiStatsHandler(w http.ResponseWriter, r *http.Request) {
 	modeMutex.RUnlock()
 
 	stats := map[string]interface{}{
-		"total_users": len(db.users),
+		"total_users": db.Count(),
 		"server_time": time.Now().UTC(),
 		"status":      "online",
-		"version":     "1.0.0",
-		"go_version":  "1.23.1",
+		"version":     appVersion(),
+		"go_version":  versionInfo().GoVersion,
 		"mode":        currentMode,
-		"clients":     len(clients),
+		"clients":     clientCount(),
 		"uptime":      time.Since(startTime).String(),
 		"memory_mb":   getMemoryUsage(),
+		"rate_limits": rateLimitSnapshot(hasPermission(r, permClientsRead)),
 	}
 	
 	// В локальном режиме показываем 0 пользователей для обычных пользователей
-	if currentMode == "local" {
-		if !checkAdminAccess(r) {
+	if modePolicies[currentMode].HideData {
+		if !hasPermission(r, permLocalAccess) {
 			stats["total_users"] = 0
 			stats["message"] = "Локальный режим активен. Данные скрыты."
 			stats["status"] = "local"
@@ -806,29 +1047,14 @@ func apiInfoHandler(w http.ResponseWriter, r *http.Request) {
 
 	info := map[string]interface{}{
 		"name":        "UserManager Pro API",
-		"version":     "1.0.0",
+		"version":     appVersion(),
 		"description": "Go Backend API for UserManager Pro",
 		"author":      "Dmitriy Kobelev",
 		"mode":        currentMode,
-		"clients":     len(clients),
+		"clients":     clientCount(),
 		"uptime":      time.Since(startTime).String(),
-		"endpoints": map[string]string{
-			"GET /api/users":           "Get all users",
-			"POST /api/users":          "Create user",
-			"GET /api/users/{id}":      "Get user by ID",
-			"PUT /api/users/{id}":      "Update user",
-			"DELETE /api/users/{id}":   "Delete user",
-			"GET /api/stats":           "Server statistics",
-			"GET /api/info":            "This info",
-			"GET /api/health":          "Health check",
-			"POST /api/admin/mode":     "Change mode (admin only)",
-			"GET /api/mode":            "Get current mode",
-			"GET /api/status":          "Check status and mode",
-			"GET /api/clients":         "Get connected clients",
-			"GET /api/check-mode":      "Check if mode changed",
-			"WS /ws":                   "WebSocket for real-time updates",
-		},
-		"frontend": "https://dmitriy43229.github.io/Go-Project777_GoStory/",
+		"endpoints":   routeEndpoints(),
+		"frontend": "/",
 	}
 	
 	sendJSON(w, http.StatusOK, info)
@@ -840,25 +1066,41 @@ func apiStatusHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	modeMutex.RLock()
-	currentMode := serverMode
-	modeMutex.RUnlock()
-	
-	// Проверяем админский доступ
-	isAdmin := checkAdminAccess(r)
+	state := currentModeState()
+	currentMode := state.Mode
+	
+	// Проверяем роль и права автора запроса
+	name, role := requestRole(r)
+	permissions := permissionsFor(name, role, currentMode)
+	trusted := trustedRequest(r)
+	if modePolicies[currentMode].HideData && trusted {
+		for _, permission := range append([]string{permLocalAccess}, publicPermissions...) {
+			if !grants(permissions, permission) {
+				permissions = append(permissions, permission)
+			}
+		}
+		sort.Strings(permissions)
+	}
 	
 	response := map[string]interface{}{
 		"mode":        currentMode,
-		"is_admin":    isAdmin,
+		"is_admin":    role == roleAdmin,
+		"user":        name,
+		"role":        role,
+		"permissions": permissions,
+		"trusted_network": trusted,
 		"timestamp":   time.Now().Unix(),
 		"status":      "ok",
-		"clients":     len(clients),
+		"clients":     clientCount(),
 		"server_time": time.Now().Format("2006-01-02 15:04:05"),
 		"uptime":      time.Since(startTime).String(),
 	}
+	for key, value := range state.info() {
+		response[key] = value
+	}
 	
-	// Если режим локальный и не админ - сообщаем о блокировке
-	if currentMode == "local" && !isAdmin {
+	// Если режим скрывает данные и нет доступа к ним - сообщаем о блокировке
+	if modePolicies[currentMode].HideData && !hasPermission(r, permLocalAccess) {
 		response["blocked"] = true
 		response["message"] = "Локальный режим активен"
 		response["status"] = "blocked"
@@ -881,9 +1123,9 @@ func apiHealthHandler(w http.ResponseWriter, r *http.Request) {
 	healthStatus := map[string]interface{}{
 		"status":    "healthy",
 		"timestamp": time.Now().Unix(),
-		"version":   "1.0.0",
+		"version":   appVersion(),
 		"mode":      currentMode,
-		"clients":   len(clients),
+		"clients":   clientCount(),
 		"uptime":    time.Since(startTime).String(),
 		"memory_mb": getMemoryUsage(),
 	}
@@ -891,6 +1133,19 @@ func apiHealthHandler(w http.ResponseWriter, r *http.Request) {
 	sendJSON(w, http.StatusOK, healthStatus)
 }
 
+// modeChangeRequest - тело запроса смены режима
+type modeChangeRequest struct {
+	Username string `json:"username"` // по умолчанию "admin"
+	Password string `json:"password"`
+	Mode     string     `json:"mode"`              // server, local, readonly или maintenance
+	Message  string     `json:"message,omitempty"` // пояснение для пользователей
+	ETA      *time.Time `json:"eta,omitempty"`     // ожидаемое окончание режима
+	Duration string     `json:"duration,omitempty"`  // вернуть прежний режим через ("2h")
+	RevertTo string     `json:"revert_to,omitempty"` // режим возврата вместо прежнего
+	Grace    string     `json:"grace,omitempty"`     // отсрочка с обратным отсчетом ("60s"), ответ 202
+	Reason   string     `json:"reason,omitempty"`    // причина для журнала смен режима
+}
+
 // Новые обработчики для управления режимом
 func apiAdminModeHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -899,74 +1154,96 @@ func apiAdminModeHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// Проверяем админский пароль
-	var body map[string]string
+	var body modeChangeRequest
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		sendError(w, http.StatusBadRequest, "Invalid JSON")
 		return
 	}
 	
-	if body["password"] != "D607206fd-" {
-		sendError(w, http.StatusUnauthorized, "Invalid admin password")
+	// Сессия администратора заменяет пароль в теле запроса
+	adminName, ok := authenticateAdmin(r)
+	if !ok {
+		if adminName, ok = loginAdmin(w, r, body.Username, body.Password); !ok {
+			return
+		}
+	}
+	if role := roleOf(adminName); !allows(adminName, role, permModeWrite, "") {
+		forbidRole(w, r, adminName, role, permModeWrite)
 		return
 	}
 	
-	newMode := body["mode"]
-	if newMode != "server" && newMode != "local" {
-		sendError(w, http.StatusBadRequest, "Mode must be 'server' or 'local'")
+	newMode := body.Mode
+	if !validMode(newMode) {
+		sendError(w, http.StatusBadRequest, "Mode must be one of "+modeSummary())
+		return
+	}
+	if body.ETA != nil && !body.ETA.After(time.Now()) {
+		sendError(w, http.StatusBadRequest, "eta must be in the future")
+		return
+	}
+	ttl, err := parseOptionalDuration("duration", body.Duration, 0)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if body.RevertTo != "" && (!validMode(body.RevertTo) || ttl == 0) {
+		sendError(w, http.StatusBadRequest, "revert_to must be a known mode and requires duration")
 		return
 	}
 	
-	modeMutex.Lock()
-	oldMode := serverMode
-	serverMode = newMode
-	lastModeChange = time.Now()
-	modeMutex.Unlock()
-	
-	// Отправляем обновление ВСЕМ подключенным клиентам через WebSocket
-	broadcastToAll("mode_changed", map[string]interface{}{
-		"old_mode":      oldMode,
-		"new_mode":      newMode,
-		"time":          time.Now().Unix(),
-		"force_reload":  true,
-		"changed_by":    r.RemoteAddr,
-	})
-	
-	// Небольшая задержка для гарантии отправки
-	time.Sleep(50 * time.Millisecond)
-	
-	// Также отправляем команду на принудительную перезагрузку
-	broadcastToAll("force_reload", map[string]interface{}{
-		"reason": "mode_changed_to_" + newMode,
-		"time":   time.Now().Unix(),
-	})
+	grace, err := parseGrace(body.Grace)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	
-	// Логируем изменение
-	log.Printf("\n🎯 РЕЖИМ ИЗМЕНЕН!")
-	log.Printf("   Старый режим: %s", oldMode)
-	log.Printf("   Новый режим: %s", newMode)
-	log.Printf("   Время: %s", time.Now().Format("2006-01-02 15:04:05"))
-	log.Printf("   IP админ: %s", r.RemoteAddr)
-	log.Printf("   Активных клиентов: %d", len(clients))
-	
-	if newMode == "local" {
-		log.Printf("   ⚠️  ВНИМАНИЕ: Все обычные пользователи теперь увидят белую страницу 404!")
-		log.Printf("   ✅ Только администратор может работать с системой")
-	} else {
-		log.Printf("   ✅ Теперь все пользователи видят общие данные")
+	// Без duration ETA только сообщается клиентам, с duration режим вернется сам
+	message := strings.TrimSpace(body.Message)
+	change := modeChange{
+		Mode:      newMode,
+		Message:   message,
+		ETA:       body.ETA,
+		TTL:       ttl,
+		RevertTo:  body.RevertTo,
+		ChangedBy: adminName,
+		Source:    modeSourceAPI,
+		Reason:    strings.TrimSpace(body.Reason),
+		IP:        clientIP(r),
+		RequestID: requestIDFrom(r.Context()),
 	}
 	
-	response := map[string]interface{}{
-		"message": fmt.Sprintf("Режим изменен с '%s' на '%s'", oldMode, newMode),
-		"mode":    newMode,
-		"time":    time.Now().Format("2006-01-02 15:04:05"),
-		"clients": len(clients),
-		"warning": "",
+	// С отсрочкой режим меняется после обратного отсчета, клиенты успевают сохранить работу
+	if grace > 0 {
+		pending, err := startPendingMode(change, grace)
+		if err == errModeChangePending {
+			sendError(w, http.StatusConflict, "Another mode change is pending, cancel it first")
+			return
+		}
+		logMode.InfoContext(r.Context(), "смена режима отложена",
+			"change_id", pending.ID, "new_mode", newMode, "effective_at", pending.EffectiveAt, "admin", adminName)
+		sendJSON(w, http.StatusAccepted, pending)
+		return
 	}
+	oldMode, revert := switchMode(change)
 	
-	if newMode == "local" {
-		response["warning"] = "Обычные пользователи увидят 404 страницу"
-	} else {
-		response["warning"] = "Все пользователи видят данные"
+	// Логируем изменение
+	logMode.InfoContext(r.Context(), "режим изменен",
+		"old_mode", oldMode,
+		"new_mode", newMode,
+		"admin", adminName,
+		"admin_ip", clientIP(r),
+		"clients", clientCount(),
+		"mode_message", message,
+		"reason", change.Reason,
+	)
+	
+	response := currentModeState().info()
+	response["message"] = fmt.Sprintf("Режим изменен с '%s' на '%s'", oldMode, newMode)
+	response["time"] = time.Now().Format("2006-01-02 15:04:05")
+	response["clients"] = clientCount()
+	response["warning"] = modePolicies[newMode].Warning
+	if revert != nil {
+		response["revert"] = revert
 	}
 	
 	sendJSON(w, http.StatusOK, response)
@@ -978,18 +1255,15 @@ func apiGetModeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	modeMutex.RLock()
-	currentMode := serverMode
-	lastChange := lastModeChange
-	modeMutex.RUnlock()
+	state := currentModeState()
 	
-	sendJSON(w, http.StatusOK, map[string]interface{}{
-		"mode":         currentMode,
-		"last_change":  lastChange.Format(time.RFC3339),
-		"clients":      len(clients),
-		"timestamp":    time.Now().Unix(),
-		"uptime":       time.Since(startTime).String(),
-	})
+	response := state.info()
+	response["last_change"] = state.ChangedAt.Format(time.RFC3339)
+	response["clients"] = clientCount()
+	response["timestamp"] = time.Now().Unix()
+	response["uptime"] = time.Since(startTime).String()
+	response["modes"] = modeNames()
+	sendJSON(w, http.StatusOK, response)
 }
 
 // Обработчик для проверки изменения режима
@@ -1017,65 +1291,64 @@ func apiCheckModeHandler(w http.ResponseWriter, r *http.Request) {
 	
 	sendJSON(w, http.StatusOK, map[string]interface{}{
 		"mode":         currentMode,
+		"hide_data":    modePolicies[currentMode].HideData,
 		"last_change":  lastChange.Unix(),
 		"needs_reload": needsReload,
 		"timestamp":    time.Now().Unix(),
 	})
 }
 
-// Обработчик для получения списка клиентов (только для админа)
+// Обработчик для получения списка клиентов (clients:read)
 func apiClientsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 	
-	if !checkAdminAccess(r) {
-		sendError(w, http.StatusUnauthorized, "Admin access required")
-		return
-	}
-	
-	infoMu.RLock()
-	clientsList := make([]map[string]interface{}, 0, len(clientInfo))
-	for _, info := range clientInfo {
-		clientsList = append(clientsList, map[string]interface{}{
-			"ip":          info.IP,
-			"client_id":   info.ClientID,
-			"is_admin":    info.IsAdmin,
-			"last_seen":   info.LastSeen.Format("2006-01-02 15:04:05"),
-			"user_agent":  info.UserAgent,
-			"connected":   time.Since(info.LastSeen) < 30*time.Second,
-			"idle_time":   time.Since(info.LastSeen).Round(time.Second).String(),
-		})
-	}
-	infoMu.RUnlock()
+	clientsList := clientsSnapshot()
 	
 	sendJSON(w, http.StatusOK, map[string]interface{}{
 		"clients": clientsList,
 		"total":   len(clientsList),
-		"active":  len(clients),
+		"active":  clientCount(),
 	})
 }
 
 // Запускаем периодическую отправку ping сообщений
-func startPingService() {
-	ticker := time.NewTicker(30 * time.Second)
+func startPingService(ctx context.Context) {
+	ticker := time.NewTicker(cfg.PingInterval.Duration)
+	backgroundWG.Add(1)
 	go func() {
-		for range ticker.C {
-			broadcastToAll("ping", map[string]interface{}{
-				"time":    time.Now().Unix(),
-				"clients": len(clients),
-			})
+		defer backgroundWG.Done()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				broadcastToAll("ping", map[string]interface{}{
+					"time":    time.Now().Unix(),
+					"clients": clientCount(),
+				})
+			}
 		}
 	}()
 }
 
 // Функция для периодической очистки неактивных клиентов
-func startClientCleanup() {
-	ticker := time.NewTicker(60 * time.Second)
+func startClientCleanup(ctx context.Context) {
+	ticker := time.NewTicker(cfg.CleanupInterval.Duration)
+	backgroundWG.Add(1)
 	go func() {
-		for range ticker.C {
-			cleanupInactiveClients()
+		defer backgroundWG.Done()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				cleanupInactiveClients()
+			}
 		}
 	}()
 }
@@ -1088,8 +1361,8 @@ func cleanupInactiveClients() {
 	now := time.Now()
 	
 	for client, info := range clientInfo {
-		// Если клиент неактивен более 2 минут
-		if now.Sub(info.LastSeen) > 120*time.Second {
+		// Если клиент неактивен дольше порога очистки
+		if now.Sub(info.LastSeen) > cfg.CleanupThreshold.Duration {
 			delete(clients, client)
 			delete(clientInfo, client)
 			client.Close()
@@ -1101,79 +1374,221 @@ func cleanupInactiveClients() {
 	clientsMu.Unlock()
 	
 	if inactiveClients > 0 {
-		log.Printf("🧹 Очищено %d неактивных клиентов", inactiveClients)
+		logWS.Info("очищены неактивные клиенты", "count", inactiveClients)
+	}
+}
+
+// handle регистрирует маршрут со сбором метрик, идентификатором запроса и access log;
+// в метриках маршрут помечается путем шаблона без метода
+func handle(pattern string, handler http.HandlerFunc) {
+	http.HandleFunc(pattern, instrument(metricsRoute(pattern), withRequestID(accessLog(rejectWhileShuttingDown(handler)))))
+}
+
+// metricsRoute возвращает метку route для шаблона: "GET /api/v1/users/{id}" -> "/api/v1/users/{id}"
+func metricsRoute(pattern string) string {
+	if _, path, found := strings.Cut(pattern, " "); found {
+		return path
+	}
+	return pattern
+}
+
+// printBanner выводит стартовую информацию в человекочитаемом виде
+func printBanner(w io.Writer) {
+	modeMutex.RLock()
+	currentMode := serverMode
+	modeMutex.RUnlock()
+	
+	fmt.Fprintln(w, "\n" + strings.Repeat("=", 60))
+	fmt.Fprintf(w, "🚀 UserManager Pro Server v%s\n", appVersion())
+	fmt.Fprintln(w, strings.Repeat("=", 60))
+	scheme := "http"
+	if cfg.TLS.Enabled() {
+		scheme = "https"
 	}
+	fmt.Fprintf(w, "📊 Сервер запущен на адресе %s (%s)\n", cfg.Addr, scheme)
+	fmt.Fprintf(w, "📁 База данных инициализирована с %d пользователями\n", db.Count())
+	fmt.Fprintf(w, "🌐 Начальный режим: %s\n", currentMode)
+	fmt.Fprintf(w, "⏱️  Время запуска: %s\n", startTime.Format("2006-01-02 15:04:05"))
+	fmt.Fprintln(w, strings.Repeat("-", 60))
+	
+	fmt.Fprintln(w, "\n⚙️  Конфигурация:")
+	printConfig(w, cfg)
+	
+	fmt.Fprintln(w, "\n🔧 Управление режимами:")
+	fmt.Fprintln(w, "   POST /api/v1/admin/mode - Изменить режим (пароль: ********)")
+	fmt.Fprintln(w, "   GET  /api/v1/mode       - Получить текущий режим")
+	fmt.Fprintln(w, "   GET  /api/v1/status     - Проверить статус и доступ")
+	fmt.Fprintln(w, "   GET  /api/v1/health     - Проверить состояние сервера")
+	fmt.Fprintln(w, "   GET  /api/v1/clients    - Получить список подключенных клиентов")
+	fmt.Fprintln(w, "   POST /api/v1/admin/users/bulk/preview - Предпросмотр массовой операции")
+	fmt.Fprintln(w, "   POST /api/v1/admin/users/bulk/apply   - Применить массовую операцию")
+	fmt.Fprintln(w, "   PUT  /api/v1/admin/log-levels - Изменить уровни журнала")
+	fmt.Fprintln(w, "   WS   /ws             - WebSocket для мгновенных обновлений")
+	
+	fmt.Fprintln(w, "\n🔒 Локальный режим:")
+	fmt.Fprintln(w, "   - Обычные пользователи немедленно получают 404 ошибку")
+	fmt.Fprintln(w, "   - WebSocket уведомления для всех клиентов")
+	fmt.Fprintln(w, "   - Принудительная перезагрузка при смене режима")
+	
+	fmt.Fprintln(w, "\n⚡ Мгновенное обновление через WebSocket:")
+	fmt.Fprintln(w, "   - Все клиенты получают уведомление при смене режима")
+	fmt.Fprintln(w, "   - Автоматическая перезагрузка страниц")
+	fmt.Fprintln(w, "   - Режим меняется у всех пользователей одновременно")
+	fmt.Fprintln(w, "   - Ping/pong для поддержания соединения")
+	
+	fmt.Fprintln(w, "\n🌐 API Endpoints:")
+	fmt.Fprintln(w, "   GET  /api/v1/users      - Все пользователи")
+	fmt.Fprintln(w, "   POST /api/v1/users      - Создать пользователя")
+	fmt.Fprintln(w, "   GET  /api/v1/stats      - Статистика сервера")
+	fmt.Fprintln(w, "   GET  /api/v1/stats/users - Аналитика пользователей")
+	fmt.Fprintln(w, "   GET  /api/v1/info       - Информация об API")
+	fmt.Fprintln(w, "   GET  /api/v1/version    - Версия и сборка сервера")
+	fmt.Fprintln(w, "   GET  /api/v1/status     - Проверить статус системы")
+	fmt.Fprintln(w, "   GET  /api/v1/check-mode - Проверить изменение режима")
+	fmt.Fprintln(w, "   WS   /ws             - WebSocket для реального времени")
+	fmt.Fprintln(w, "   GET  /metrics        - Метрики Prometheus")
+	
+	fmt.Fprintln(w, "\n🔧 Технические особенности:")
+	fmt.Fprintf(w, "   - Таймаут подключения: %s\n", cfg.HandshakeTimeout)
+	fmt.Fprintf(w, "   - Таймаут чтения: %s\n", cfg.ReadDeadline)
+	fmt.Fprintln(w, "   - Автоматическая очистка неактивных клиентов")
+	fmt.Fprintln(w, "   - Оптимизированная рассылка сообщений")
+	
+	fmt.Fprintln(w, strings.Repeat("=", 60))
+	fmt.Fprintf(w, "\n✅ Сервер готов к работе!\n\n")
 }
 
 func main() {
+	// Загружаем конфигурацию: файл < окружение < флаги
+	loaded, command, err := loadConfig(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ошибка конфигурации: %v\n", err)
+		os.Exit(2)
+	}
+	cfg = loaded
+
+	// Управление администраторами: usermanager-pro [флаги] admin add|reset|list
+	if len(command) > 0 {
+		if command[0] != "admin" {
+			fmt.Fprintf(os.Stderr, "неизвестная команда %q\n", command[0])
+			os.Exit(2)
+		}
+		if err := runAdminCommand(command[1:], os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "ошибка: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	upgrader.HandshakeTimeout = cfg.HandshakeTimeout.Duration
+	
+	// Настраиваем журнал до запуска сервисов
+	if err := setupLogging(cfg.Log); err != nil {
+		fmt.Fprintf(os.Stderr, "ошибка настройки журнала: %v\n", err)
+		os.Exit(1)
+	}
+	setupRateLimits(cfg.RateLimit)
+	if err := setupCORS(cfg.CORS); err != nil {
+		logHTTP.Error("ошибка настройки CORS", "error", err)
+		os.Exit(1)
+	}
+	
+	if err := loadFrontend(); err != nil {
+		logHTTP.Error("ошибка загрузки встроенного фронтенда", "error", err)
+		os.Exit(1)
+	}
+	
+	if err := loadAdmins(); err != nil {
+		logHTTP.Error("ошибка загрузки администраторов", "error", err)
+		os.Exit(1)
+	}
+	if err := loadAPIKeys(); err != nil {
+		logHTTP.Error("ошибка загрузки API-ключей", "error", err)
+		os.Exit(1)
+	}
+	if err := loadSessions(); err != nil {
+		logHTTP.Error("ошибка загрузки сессий", "error", err)
+		os.Exit(1)
+	}
+	if err := setupLocalAllowlist(); err != nil {
+		logMode.Error("ошибка загрузки доверенных сетей", "error", err)
+		os.Exit(1)
+	}
+	if err := loadModeHistory(); err != nil {
+		logMode.Error("ошибка загрузки журнала режима", "error", err)
+		os.Exit(1)
+	}
+	if err := loadModeSchedules(); err != nil {
+		logMode.Error("ошибка загрузки расписаний режима", "error", err)
+		os.Exit(1)
+	}
+	
+	// Восстанавливаем пользователей, сохраненные при прошлой остановке
+	if restored, err := db.Load(dataPath("users.json")); err != nil {
+		logDB.Error("ошибка загрузки пользователей", "error", err)
+	} else if restored {
+		logDB.Info("пользователи восстановлены", "users", db.Count())
+	}
+	
+	// Фоновые сервисы работают до получения сигнала остановки
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	backgroundCtx = ctx
+	
 	// Запускаем сервисы
-	startPingService()
-	startClientCleanup()
+	startPingService(ctx)
+	startClientCleanup(ctx)
+	startRateLimitCleanup(ctx)
+	startAuthStateCleanup(ctx)
+	startModeScheduler(ctx)
 	
 	// Регистрация маршрутов
-	http.HandleFunc("/api/users", enableCORS(checkModeMiddleware(apiUsersHandler)))
-	http.HandleFunc("/api/users/", enableCORS(checkModeMiddleware(apiUserHandler)))
-	http.HandleFunc("/api/stats", enableCORS(apiStatsHandler))
-	http.HandleFunc("/api/info", enableCORS(apiInfoHandler))
-	http.HandleFunc("/api/health", enableCORS(apiHealthHandler))
-	http.HandleFunc("/api/admin/mode", enableCORS(apiAdminModeHandler))
-	http.HandleFunc("/api/mode", enableCORS(apiGetModeHandler))
-	http.HandleFunc("/api/status", enableCORS(apiStatusHandler))
-	http.HandleFunc("/api/check-mode", enableCORS(apiCheckModeHandler))
-	http.HandleFunc("/api/clients", enableCORS(apiClientsHandler))
-	http.HandleFunc("/ws", enableCORS(handleWebSocket))
-	http.HandleFunc("/", enableCORS(homeHandler))
-
-	port := ":8068"
-	
-	// Статистика сервера
-	log.Printf("\n" + strings.Repeat("=", 60))
-	log.Printf("🚀 UserManager Pro Server v1.0.0")
-	log.Printf(strings.Repeat("=", 60))
-	log.Printf("📊 Сервер запущен на порту %s", port)
-	log.Printf("📁 База данных инициализирована с %d пользователями", len(db.users))
-	log.Printf("🌐 Начальный режим: %s", serverMode)
-	log.Printf("⏱️  Время запуска: %s", startTime.Format("2006-01-02 15:04:05"))
-	log.Printf(strings.Repeat("-", 60))
-	
-	log.Printf("\n🔧 Управление режимами:")
-	log.Printf("   POST /api/admin/mode - Изменить режим (пароль: ********)")
-	log.Printf("   GET  /api/mode       - Получить текущий режим")
-	log.Printf("   GET  /api/status     - Проверить статус и доступ")
-	log.Printf("   GET  /api/health     - Проверить состояние сервера")
-	log.Printf("   GET  /api/clients    - Получить список подключенных клиентов")
-	log.Printf("   WS   /ws             - WebSocket для мгновенных обновлений")
-	
-	log.Printf("\n🔒 Локальный режим:")
-	log.Printf("   - Обычные пользователи немедленно получают 404 ошибку")
-	log.Printf("   - WebSocket уведомления для всех клиентов")
-	log.Printf("   - Принудительная перезагрузка при смене режима")
-	
-	log.Printf("\n⚡ Мгновенное обновление через WebSocket:")
-	log.Printf("   - Все клиенты получают уведомление при смене режима")
-	log.Printf("   - Автоматическая перезагрузка страниц")
-	log.Printf("   - Режим меняется у всех пользователей одновременно")
-	log.Printf("   - Ping/pong для поддержания соединения")
-	
-	log.Printf("\n🌐 API Endpoints:")
-	log.Printf("   GET  /api/users      - Все пользователи")
-	log.Printf("   POST /api/users      - Создать пользователя")
-	log.Printf("   GET  /api/stats      - Статистика сервера")
-	log.Printf("   GET  /api/info       - Информация об API")
-	log.Printf("   GET  /api/status     - Проверить статус системы")
-	log.Printf("   GET  /api/check-mode - Проверить изменение режима")
-	log.Printf("   WS   /ws             - WebSocket для реального времени")
-	
-	log.Printf("\n🔧 Технические особенности:")
-	log.Printf("   - Таймаут подключения: 5 секунд")
-	log.Printf("   - Таймаут чтения: 60 секунд")
-	log.Printf("   - Автоматическая очистка неактивных клиентов")
-	log.Printf("   - Оптимизированная рассылка сообщений")
-	
-	log.Printf(strings.Repeat("=", 60))
-	log.Printf("\n✅ Сервер готов к работе!\n")
-
-	if err := http.ListenAndServe(port, nil); err != nil {
-		log.Fatalf("❌ Ошибка запуска сервера: %v", err)
+	registerRoutes()
+
+	logHTTP.Info("сервер запущен",
+		"addr", cfg.Addr,
+		"tls", cfg.TLS.Enabled(),
+		"users", db.Count(),
+		"mode", serverMode,
+		"version", appVersion(),
+		"revision", versionInfo().Revision,
+	)
+	if cfg.Log.Format != "json" {
+		printBanner(os.Stdout)
+	}
+
+	server := &http.Server{Addr: cfg.Addr}
+	var redirectServer *http.Server
+	
+	serverErr := make(chan error, 2)
+	if cfg.TLS.Enabled() {
+		certFile, keyFile, err := cfg.TLS.certificateFiles()
+		if err != nil {
+			logHTTP.Error("ошибка настройки TLS", "error", err)
+			os.Exit(1)
+		}
+		go func() {
+			serverErr <- server.ListenAndServeTLS(certFile, keyFile)
+		}()
+		
+		// HTTP-адрес только перенаправляет на HTTPS
+		if cfg.TLS.RedirectAddr != "" {
+			redirectServer = newRedirectServer(cfg.TLS.RedirectAddr, cfg.Addr)
+			go func() {
+				serverErr <- redirectServer.ListenAndServe()
+			}()
+		}
+	} else {
+		go func() {
+			serverErr <- server.ListenAndServe()
+		}()
+	}
+	
+	select {
+	case err := <-serverErr:
+		logHTTP.Error("ошибка запуска сервера", "error", err)
+		os.Exit(1)
+	case <-ctx.Done():
+		stop()
+		gracefulShutdown(server, redirectServer)
 	}
 }
\ No newline at end of file
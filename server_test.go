@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestIDPropagation(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		kept     bool
+	}{
+		{"generated when missing", "", false},
+		{"client id is propagated", "req-42_a.b:c", true},
+		{"longest allowed id", strings.Repeat("a", maxRequestIDLength), true},
+		{"oversized id is replaced", strings.Repeat("a", maxRequestIDLength+1), false},
+		{"spaces are replaced", "req 42", false},
+		{"header injection is replaced", "req\r\nSet-Cookie: x=1", false},
+		{"non-ASCII is replaced", "запрос", false},
+		{"log markup is replaced", `req" level=ERROR`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			handler := withRequestID(func(w http.ResponseWriter, r *http.Request) {
+				seen = requestIDFrom(r.Context())
+				sendError(w, http.StatusBadRequest, "Invalid JSON")
+			})
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/users", nil)
+			if tt.incoming != "" {
+				r.Header["X-Request-Id"] = []string{tt.incoming}
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, r)
+
+			id := rec.Header().Get("X-Request-ID")
+			if tt.kept && id != tt.incoming {
+				t.Errorf("X-Request-ID = %q, want %q", id, tt.incoming)
+			}
+			if !tt.kept && (id == tt.incoming || !validRequestID(id)) {
+				t.Errorf("X-Request-ID = %q, want a generated id", id)
+			}
+			if seen != id {
+				t.Errorf("context id = %q, header id = %q", seen, id)
+			}
+
+			var body errorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.RequestID != id || body.Error != "Invalid JSON" {
+				t.Errorf("error body = %+v, want request_id %q", body, id)
+			}
+		})
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		level  string
+	}{
+		{"success", http.StatusOK, `{"ok":true}`, "INFO"},
+		{"implicit 200", 0, "hello", "INFO"},
+		{"client error", http.StatusNotFound, `{"error":"User not found"}`, "INFO"},
+		{"server error", http.StatusInternalServerError, "", "ERROR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			const delay = 5 * time.Millisecond
+			handler := withRequestID(accessLog(func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(delay)
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				w.Write([]byte(tt.body))
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/users?page=2", nil)
+			r.Header.Set("X-Request-ID", "access-1")
+			handler(httptest.NewRecorder(), r)
+
+			records := logs.records(t)
+			if len(records) != 1 {
+				t.Fatalf("%d log records, want 1: %v", len(records), records)
+			}
+			record := records[0]
+			wantStatus := tt.status
+			if wantStatus == 0 {
+				wantStatus = http.StatusOK
+			}
+			if record["level"] != tt.level || record["subsystem"] != subsystemHTTP {
+				t.Errorf("level/subsystem = %v/%v, want %s/%s", record["level"], record["subsystem"], tt.level, subsystemHTTP)
+			}
+			if record["method"] != http.MethodGet || record["path"] != "/api/v1/users" || record["client_ip"] != "192.0.2.1" {
+				t.Errorf("request fields = %v", record)
+			}
+			if record["status"] != float64(wantStatus) {
+				t.Errorf("status = %v, want %d", record["status"], wantStatus)
+			}
+			if record["bytes"] != float64(len(tt.body)) {
+				t.Errorf("bytes = %v, want %d", record["bytes"], len(tt.body))
+			}
+			if latency, _ := record["latency_ms"].(float64); latency < float64(delay.Milliseconds()) {
+				t.Errorf("latency_ms = %v, want at least %d", record["latency_ms"], delay.Milliseconds())
+			}
+			if record["request_id"] != "access-1" {
+				t.Errorf("request_id = %v, want access-1", record["request_id"])
+			}
+		})
+	}
+}
@@ -6,8 +6,7 @@ const urlsToCache = [
     '/about.html',
     '/presentation.html',
     '/style.css',
-    '/script.js',
-    '/server.go'
+    '/script.js'
 ];
 
 // Устанавливаем Service Worker и кешируем ресурсы
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Типы токенов сессии
+const (
+	sessionAccess  = "access"
+	sessionRefresh = "refresh"
+)
+
+var (
+	errSessionInvalid = errors.New("invalid session token")
+	errSessionExpired = errors.New("session token expired")
+	errSessionRevoked = errors.New("session revoked")
+)
+
+// sessionClaims - содержимое подписанного токена: base64url(JSON).base64url(HMAC-SHA256)
+type sessionClaims struct {
+	SessionID string `json:"sid"`
+	Admin     string `json:"sub"`
+	Type      string `json:"typ"`
+	IssuedAt  int64  `json:"iat"` // Unix, миллисекунды
+	ExpiresAt int64  `json:"exp"` // Unix, миллисекунды
+}
+
+// sessionTokens - ответ на вход и обновление сессии
+type sessionTokens struct {
+	AccessToken      string    `json:"access_token"`
+	RefreshToken     string    `json:"refresh_token"`
+	TokenType        string    `json:"token_type"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+	SessionID        string    `json:"session_id"`
+	Admin            string    `json:"admin"`
+	Role             string    `json:"role"`
+}
+
+// sessionState - отозванные сессии, сохраняемые в data_dir/sessions.json
+type sessionState struct {
+	Revoked       map[string]time.Time `json:"revoked"`        // sid -> когда истекает последний токен
+	RevokedBefore map[string]time.Time `json:"revoked_before"` // admin -> токены, выданные раньше, недействительны
+}
+
+var (
+	sessionKey []byte
+	sessionsMu sync.Mutex
+	sessions   = sessionState{Revoked: map[string]time.Time{}, RevokedBefore: map[string]time.Time{}}
+)
+
+// loadSessions готовит ключ подписи и список отозванных сессий.
+// Без session_secret ключ создается один раз и хранится в data_dir/session.key,
+// чтобы сессии переживали перезапуск
+func loadSessions() error {
+	if cfg.SessionSecret != "" {
+		sessionKey = []byte(cfg.SessionSecret)
+	} else {
+		keyFile := dataPath("session.key")
+		data, err := os.ReadFile(keyFile)
+		switch {
+		case err == nil:
+			sessionKey, err = hex.DecodeString(strings.TrimSpace(string(data)))
+			if err != nil || len(sessionKey) < 32 {
+				return errors.New("session.key is corrupted, delete it to generate a new one")
+			}
+		case errors.Is(err, os.ErrNotExist):
+			sessionKey = make([]byte, 32)
+			if _, err := rand.Read(sessionKey); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(keyFile), 0o700); err != nil {
+				return err
+			}
+			if err := os.WriteFile(keyFile, []byte(hex.EncodeToString(sessionKey)+"\n"), 0o600); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+	}
+
+	var state sessionState
+	found, err := loadJSONFile(dataPath("sessions.json"), &state)
+	if err != nil || !found {
+		return err
+	}
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	if state.Revoked != nil {
+		sessions.Revoked = state.Revoked
+	}
+	if state.RevokedBefore != nil {
+		sessions.RevokedBefore = state.RevokedBefore
+	}
+	return nil
+}
+
+// saveSessionsLocked удаляет истекшие записи и сохраняет состояние; sessionsMu должен быть захвачен
+func saveSessionsLocked() error {
+	now := time.Now()
+	for sid, until := range sessions.Revoked {
+		if until.Before(now) {
+			delete(sessions.Revoked, sid)
+		}
+	}
+	for admin, before := range sessions.RevokedBefore {
+		if now.Sub(before) > cfg.RefreshTTL.Duration {
+			delete(sessions.RevokedBefore, admin)
+		}
+	}
+	return saveJSONFile(dataPath("sessions.json"), sessions)
+}
+
+// signSession кодирует и подписывает токен
+func signSession(claims sessionClaims) string {
+	payload, _ := json.Marshal(claims)
+	mac := hmac.New(sha256.New, sessionKey)
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// parseSession проверяет подпись, тип, срок действия и отзыв токена
+func parseSession(token, tokenType string) (sessionClaims, error) {
+	var claims sessionClaims
+
+	encodedPayload, encodedMAC, found := strings.Cut(token, ".")
+	if !found {
+		return claims, errSessionInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return claims, errSessionInvalid
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil {
+		return claims, errSessionInvalid
+	}
+	mac := hmac.New(sha256.New, sessionKey)
+	mac.Write(payload)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return claims, errSessionInvalid
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Type != tokenType {
+		return claims, errSessionInvalid
+	}
+
+	if time.Now().UnixMilli() >= claims.ExpiresAt {
+		return claims, errSessionExpired
+	}
+
+	// Exists перечитывает admins.json, если его изменила команда CLI: отзыв сессий
+	// после "admin reset" должен действовать уже на этот токен
+	if !admins.Exists(claims.Admin) {
+		return claims, errSessionRevoked
+	}
+	sessionsMu.Lock()
+	_, revoked := sessions.Revoked[claims.SessionID]
+	before, adminRevoked := sessions.RevokedBefore[claims.Admin]
+	sessionsMu.Unlock()
+	if revoked || (adminRevoked && claims.IssuedAt <= before.UnixMilli()) {
+		return claims, errSessionRevoked
+	}
+	return claims, nil
+}
+
+// issueSession выдает пару токенов с новым идентификатором сессии
+func issueSession(admin string) sessionTokens {
+	now := time.Now()
+	accessExpires := now.Add(cfg.SessionTTL.Duration)
+	refreshExpires := now.Add(cfg.RefreshTTL.Duration)
+	sid := randomHex(16)
+
+	return sessionTokens{
+		AccessToken: signSession(sessionClaims{
+			SessionID: sid, Admin: admin, Type: sessionAccess,
+			IssuedAt: now.UnixMilli(), ExpiresAt: accessExpires.UnixMilli(),
+		}),
+		RefreshToken: signSession(sessionClaims{
+			SessionID: sid, Admin: admin, Type: sessionRefresh,
+			IssuedAt: now.UnixMilli(), ExpiresAt: refreshExpires.UnixMilli(),
+		}),
+		TokenType:        "Bearer",
+		ExpiresAt:        accessExpires.UTC(),
+		RefreshExpiresAt: refreshExpires.UTC(),
+		SessionID:        sid,
+		Admin:            admin,
+		Role:             roleOf(admin),
+	}
+}
+
+// revokeSession отзывает сессию до истечения ее refresh-токена
+func revokeSession(sid string, until time.Time) error {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	sessions.Revoked[sid] = until
+	return saveSessionsLocked()
+}
+
+// rotateSession отзывает сессию, если она еще не отозвана, и сообщает, сделал ли это
+// именно этот вызов. Проверка и отзыв выполняются под одной блокировкой, поэтому
+// из параллельных обновлений одним refresh-токеном новую пару получает только одно
+func rotateSession(sid string, until time.Time) (bool, error) {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	if _, revoked := sessions.Revoked[sid]; revoked {
+		return false, nil
+	}
+	sessions.Revoked[sid] = until
+	return true, saveSessionsLocked()
+}
+
+// revokeAdminSessions отзывает все выданные администратору сессии
+func revokeAdminSessions(admin string) error {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	sessions.RevokedBefore[admin] = time.Now()
+	return saveSessionsLocked()
+}
+
+// bearerToken возвращает токен из заголовка Authorization: Bearer
+func bearerToken(r *http.Request) string {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// loginAdmin проверяет пароль с учетом блокировки; при отказе сам отправляет ответ
+func loginAdmin(w http.ResponseWriter, r *http.Request, name, password string) (string, bool) {
+	if name == "" {
+		name = defaultAdminName
+	}
+	if authLockedFor(clientIP(r)) > 0 {
+		recordAuthAttempt(r, "body_password", name, authResultLocked)
+		denyAdmin(w, r)
+		return "", false
+	}
+	if !admins.Verify(name, password) {
+		recordAuthAttempt(r, "body_password", name, authResultFailure)
+		if authLockedFor(clientIP(r)) > 0 {
+			denyAdmin(w, r)
+			return "", false
+		}
+		sendError(w, http.StatusUnauthorized, "Invalid admin credentials")
+		return "", false
+	}
+	recordAuthAttempt(r, "body_password", name, authResultSuccess)
+	return name, true
+}
+
+// loginRequest - тело запроса входа
+type loginRequest struct {
+	Username string `json:"username"` // по умолчанию "admin"
+	Password string `json:"password"`
+}
+
+// refreshRequest - тело запросов обновления и выхода
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// revokeSessionsRequest - отзыв одной сессии или всех сессий администратора
+type revokeSessionsRequest struct {
+	SessionID string `json:"session_id,omitempty"`
+	Admin     string `json:"admin,omitempty"`
+}
+
+// Вход администратора
+func apiLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var body loginRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		sendError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	admin, ok := loginAdmin(w, r, body.Username, body.Password)
+	if !ok {
+		return
+	}
+
+	tokens := issueSession(admin)
+	logHTTP.InfoContext(r.Context(), "администратор вошел", "admin", admin, "session_id", tokens.SessionID, "client_ip", clientIP(r))
+	sendJSON(w, http.StatusOK, tokens)
+}
+
+// Обновление сессии: старая пара токенов отзывается, выдается новая
+func apiRefreshHandler(w http.ResponseWriter, r *http.Request) {
+	var body refreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		sendError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	claims, err := parseSession(body.RefreshToken, sessionRefresh)
+	if err != nil {
+		// Подделанный токен учитывается как неудачный вход, истекший или отозванный - нет
+		if errors.Is(err, errSessionInvalid) {
+			recordAuthAttempt(r, "refresh", "", authResultFailure)
+		}
+		sendError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	rotated, err := rotateSession(claims.SessionID, time.UnixMilli(claims.ExpiresAt))
+	if err != nil {
+		logHTTP.ErrorContext(r.Context(), "ошибка сохранения отозванных сессий", "error", err)
+	}
+	if !rotated {
+		// Тот же refresh-токен уже обменяли параллельным запросом
+		logHTTP.WarnContext(r.Context(), "повторное обновление сессии", "admin", claims.Admin, "session_id", claims.SessionID)
+		sendError(w, http.StatusUnauthorized, errSessionRevoked.Error())
+		return
+	}
+
+	sendJSON(w, http.StatusOK, issueSession(claims.Admin))
+}
+
+// Выход: отзывает сессию по access-токену из Authorization или refresh-токену из тела
+func apiLogoutHandler(w http.ResponseWriter, r *http.Request) {
+	var body refreshRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			sendError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+	}
+
+	claims, err := parseSession(bearerToken(r), sessionAccess)
+	if err != nil {
+		claims, err = parseSession(body.RefreshToken, sessionRefresh)
+	}
+	if err != nil {
+		sendError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	// Отзыв действует до истечения самого долгоживущего токена сессии
+	until := time.UnixMilli(claims.IssuedAt).Add(cfg.RefreshTTL.Duration)
+	if err := revokeSession(claims.SessionID, until); err != nil {
+		logHTTP.ErrorContext(r.Context(), "ошибка сохранения отозванных сессий", "error", err)
+	}
+
+	logHTTP.InfoContext(r.Context(), "администратор вышел", "admin", claims.Admin, "session_id", claims.SessionID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Отзыв сессий администратором
+func apiRevokeSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	adminName, _ := requestRole(r)
+
+	var body revokeSessionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		sendError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	var err error
+	switch {
+	case body.SessionID != "":
+		err = revokeSession(body.SessionID, time.Now().Add(cfg.RefreshTTL.Duration))
+	case body.Admin != "":
+		if !admins.Exists(body.Admin) {
+			sendError(w, http.StatusNotFound, "Admin not found")
+			return
+		}
+		err = revokeAdminSessions(body.Admin)
+	default:
+		sendError(w, http.StatusBadRequest, "session_id or admin is required")
+		return
+	}
+	if err != nil {
+		sendError(w, http.StatusInternalServerError, "Failed to persist revocation")
+		return
+	}
+
+	logHTTP.InfoContext(r.Context(), "сессии отозваны",
+		"by", adminName, "session_id", body.SessionID, "admin", body.Admin)
+	sendJSON(w, http.StatusOK, map[string]interface{}{
+		"revoked":    true,
+		"session_id": body.SessionID,
+		"admin":      body.Admin,
+	})
+}
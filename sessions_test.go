@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseSession(t *testing.T) {
+	useTestConfig(t)
+	useTestSessions(t)
+	addTestAdmin(t, "alice", roleAdmin)
+	addTestAdmin(t, "bob", roleAdmin)
+
+	now := time.Now()
+	claims := func(admin, tokenType string, issued, expires time.Time) sessionClaims {
+		return sessionClaims{
+			SessionID: randomHex(16), Admin: admin, Type: tokenType,
+			IssuedAt: issued.UnixMilli(), ExpiresAt: expires.UnixMilli(),
+		}
+	}
+	valid := claims("alice", sessionAccess, now, now.Add(time.Hour))
+	revoked := claims("alice", sessionAccess, now, now.Add(time.Hour))
+	oldBob := claims("bob", sessionAccess, now.Add(-time.Minute), now.Add(time.Hour))
+	newBob := claims("bob", sessionAccess, now.Add(time.Minute), now.Add(time.Hour))
+
+	if err := revokeSession(revoked.SessionID, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	sessionsMu.Lock()
+	sessions.RevokedBefore["bob"] = now
+	sessionsMu.Unlock()
+
+	token := signSession(valid)
+	payload, signature, _ := strings.Cut(token, ".")
+	forged := base64.RawURLEncoding.EncodeToString([]byte(strings.Replace(
+		mustDecode(t, payload), `"sub":"alice"`, `"sub":"bob"`, 1))) + "." + signature
+
+	tests := []struct {
+		name      string
+		token     string
+		tokenType string
+		want      error
+	}{
+		{"valid access", token, sessionAccess, nil},
+		{"access used as refresh", token, sessionRefresh, errSessionInvalid},
+		{"valid refresh", signSession(claims("alice", sessionRefresh, now, now.Add(time.Hour))), sessionRefresh, nil},
+		{"empty", "", sessionAccess, errSessionInvalid},
+		{"no signature", payload, sessionAccess, errSessionInvalid},
+		{"bad base64", "!!!." + signature, sessionAccess, errSessionInvalid},
+		{"forged payload", forged, sessionAccess, errSessionInvalid},
+		{"truncated signature", token[:len(token)-2], sessionAccess, errSessionInvalid},
+		{"expired", signSession(claims("alice", sessionAccess, now.Add(-2*time.Hour), now.Add(-time.Hour))), sessionAccess, errSessionExpired},
+		{"revoked session", signSession(revoked), sessionAccess, errSessionRevoked},
+		{"issued before admin revoke", signSession(oldBob), sessionAccess, errSessionRevoked},
+		{"issued after admin revoke", signSession(newBob), sessionAccess, nil},
+		{"unknown admin", signSession(claims("mallory", sessionAccess, now, now.Add(time.Hour))), sessionAccess, errSessionRevoked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseSession(tt.token, tt.tokenType); !errors.Is(err, tt.want) {
+				t.Errorf("parseSession = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("other key", func(t *testing.T) {
+		savedKey := sessionKey
+		sessionKey = []byte(strings.Repeat("x", 32))
+		defer func() { sessionKey = savedKey }()
+		if _, err := parseSession(token, sessionAccess); !errors.Is(err, errSessionInvalid) {
+			t.Errorf("parseSession = %v, want %v", err, errSessionInvalid)
+		}
+	})
+}
+
+func mustDecode(t *testing.T, s string) string {
+	t.Helper()
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRevocationSurvivesRestart(t *testing.T) {
+	useTestConfig(t)
+	useTestSessions(t)
+	addTestAdmin(t, "alice", roleAdmin)
+	addTestAdmin(t, "bob", roleAdmin)
+	cfg.SessionSecret = string(sessionKey)
+
+	alice := issueSession("alice")
+	bob := issueSession("bob")
+	time.Sleep(2 * time.Millisecond) // IssuedAt хранится в миллисекундах
+	if err := revokeSession(alice.SessionID, alice.RefreshExpiresAt); err != nil {
+		t.Fatal(err)
+	}
+	if err := revokeAdminSessions("bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Перезапуск: состояние в памяти теряется и читается из data_dir
+	sessionsMu.Lock()
+	sessions = sessionState{Revoked: map[string]time.Time{}, RevokedBefore: map[string]time.Time{}}
+	sessionsMu.Unlock()
+	if err := loadSessions(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, token := range []string{alice.AccessToken, bob.AccessToken} {
+		if _, err := parseSession(token, sessionAccess); !errors.Is(err, errSessionRevoked) {
+			t.Errorf("after restart parseSession = %v, want %v", err, errSessionRevoked)
+		}
+	}
+	for _, token := range []string{alice.RefreshToken, bob.RefreshToken} {
+		if _, err := parseSession(token, sessionRefresh); !errors.Is(err, errSessionRevoked) {
+			t.Errorf("after restart refresh parseSession = %v, want %v", err, errSessionRevoked)
+		}
+	}
+	time.Sleep(2 * time.Millisecond)
+	if _, err := parseSession(issueSession("bob").AccessToken, sessionAccess); err != nil {
+		t.Errorf("new session after revoke: %v", err)
+	}
+}
+
+func TestSaveSessionsPrunesExpired(t *testing.T) {
+	useTestConfig(t)
+	useTestSessions(t)
+
+	now := time.Now()
+	sessionsMu.Lock()
+	sessions.Revoked["old"] = now.Add(-time.Minute)
+	sessions.Revoked["live"] = now.Add(time.Minute)
+	sessions.RevokedBefore["old"] = now.Add(-cfg.RefreshTTL.Duration - time.Minute)
+	sessions.RevokedBefore["live"] = now
+	err := saveSessionsLocked()
+	_, oldSID := sessions.Revoked["old"]
+	_, liveSID := sessions.Revoked["live"]
+	_, oldAdmin := sessions.RevokedBefore["old"]
+	_, liveAdmin := sessions.RevokedBefore["live"]
+	sessionsMu.Unlock()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oldSID || oldAdmin {
+		t.Error("expired revocations were not pruned")
+	}
+	if !liveSID || !liveAdmin {
+		t.Error("active revocations were pruned")
+	}
+}
+
+func TestRefreshRotatesOnce(t *testing.T) {
+	useTestConfig(t)
+	useTestSessions(t)
+	resetAuthAttempts(t)
+	addTestAdmin(t, "alice", roleAdmin)
+	refresh := issueSession("alice").RefreshToken
+
+	const requests = 16
+	codes := make(chan int, requests)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			codes <- postRefresh(refresh).Code
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(codes)
+
+	counts := map[int]int{}
+	for code := range codes {
+		counts[code]++
+	}
+	if counts[http.StatusOK] != 1 || counts[http.StatusUnauthorized] != requests-1 {
+		t.Errorf("status counts = %v, want one 200 and %d 401", counts, requests-1)
+	}
+}
+
+func TestRefreshCountsForgedTokens(t *testing.T) {
+	useTestConfig(t)
+	useTestSessions(t)
+	resetAuthAttempts(t)
+	addTestAdmin(t, "alice", roleAdmin)
+
+	tokens := issueSession("alice")
+	expired := signSession(sessionClaims{
+		SessionID: randomHex(16), Admin: "alice", Type: sessionRefresh,
+		IssuedAt: time.Now().Add(-2 * time.Hour).UnixMilli(), ExpiresAt: time.Now().Add(-time.Hour).UnixMilli(),
+	})
+	tests := []struct {
+		name    string
+		token   string
+		status  int
+		counted bool
+	}{
+		{"forged", tokens.RefreshToken[:len(tokens.RefreshToken)-2], http.StatusUnauthorized, true},
+		{"access token", tokens.AccessToken, http.StatusUnauthorized, true},
+		{"expired", expired, http.StatusUnauthorized, false},
+		{"valid", tokens.RefreshToken, http.StatusOK, false},
+		{"replayed", tokens.RefreshToken, http.StatusUnauthorized, false},
+	}
+	for _, tt := range tests {
+		before := authFailures()
+		if rec := postRefresh(tt.token); rec.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, rec.Code, tt.status)
+		}
+		if counted := authFailures() > before; counted != tt.counted {
+			t.Errorf("%s: counted as failure = %v, want %v", tt.name, counted, tt.counted)
+		}
+	}
+}
+
+func postRefresh(token string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(refreshRequest{RefreshToken: token})
+	rec := httptest.NewRecorder()
+	apiRefreshHandler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/auth/refresh", bytes.NewReader(body)))
+	return rec
+}
+
+// authFailures - число неудачных попыток в журнале входов
+func authFailures() int {
+	authMu.Lock()
+	defer authMu.Unlock()
+	failures := 0
+	for _, attempt := range authAttempts {
+		if attempt.Result == authResultFailure {
+			failures++
+		}
+	}
+	return failures
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Ожидание ответных close-фреймов при остановке
+const closeWaitTimeout = 2 * time.Second
+
+var (
+	// shuttingDown запрещает новые WebSocket-подключения и изменяющие запросы во время остановки
+	shuttingDown atomic.Bool
+
+	// backgroundWG ожидает завершения фоновых сервисов
+	backgroundWG sync.WaitGroup
+
+	// backgroundCtx отменяется сигналом остановки; по нему завершаются фоновые задачи,
+	// запущенные обработчиками запросов
+	backgroundCtx = context.Background()
+)
+
+// rejectWhileShuttingDown отклоняет изменяющие запросы во время остановки: они пришли
+// по уже открытым keep-alive соединениям и могли бы не попасть в сохраненные данные
+func rejectWhileShuttingDown(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if shuttingDown.Load() {
+				w.Header().Set("Connection", "close")
+				w.Header().Set("Retry-After", strconv.Itoa(int(cfg.ExpectedDowntime.Seconds())))
+				sendError(w, http.StatusServiceUnavailable, "Server is shutting down")
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// closeAllClients отправляет close-фреймы всем клиентам и ждет их отключения
+func closeAllClients(reason string) {
+	clientsMu.RLock()
+	conns := make(map[*websocket.Conn]*sync.Mutex, len(clients))
+	for conn, writeMu := range clients {
+		conns[conn] = writeMu
+	}
+	clientsMu.RUnlock()
+
+	closeMessage := websocket.FormatCloseMessage(websocket.CloseGoingAway, reason)
+	deadline := time.Now().Add(time.Second)
+	for conn, writeMu := range conns {
+		// Close-фрейм не должен попасть в середину сообщения другого писателя
+		writeMu.Lock()
+		err := conn.WriteControl(websocket.CloseMessage, closeMessage, deadline)
+		writeMu.Unlock()
+		if err != nil {
+			logWS.Debug("не удалось отправить close-фрейм", "error", err)
+		}
+	}
+
+	// Клиенты отвечают close-фреймом, и их обработчики удаляют соединения сами
+	waitUntil := time.Now().Add(closeWaitTimeout)
+	for clientCount() > 0 && time.Now().Before(waitUntil) {
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// Оставшиеся соединения закрываем принудительно
+	clientsMu.Lock()
+	infoMu.Lock()
+	remaining := len(clients)
+	for conn := range clients {
+		delete(clients, conn)
+		delete(clientInfo, conn)
+		conn.Close()
+	}
+	infoMu.Unlock()
+	clientsMu.Unlock()
+
+	logWS.Info("WebSocket клиенты отключены", "clients", len(conns), "forced", remaining)
+}
+
+// gracefulShutdown останавливает сервер: уведомляет клиентов, закрывает WebSocket,
+// дожидается HTTP-запросов, фоновых сервисов и сохраняет данные
+func gracefulShutdown(server, redirectServer *http.Server) {
+	logHTTP.Info("остановка сервера", "timeout", cfg.ShutdownTimeout.String())
+	shuttingDown.Store(true)
+	server.SetKeepAlivesEnabled(false)
+
+	// HTTP-сервер перестает принимать соединения сразу, пока отключаются WebSocket клиенты:
+	// Shutdown не ждет перехваченных соединений
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout.Duration)
+	defer cancel()
+	httpDone := make(chan error, 1)
+	go func() { httpDone <- server.Shutdown(ctx) }()
+
+	broadcastToAll("server_shutdown", map[string]interface{}{
+		"reason":                    "server_restart",
+		"expected_downtime_seconds": int(cfg.ExpectedDowntime.Seconds()),
+		"reconnect_after":           time.Now().Add(cfg.ExpectedDowntime.Duration).Unix(),
+	})
+
+	closeAllClients("server shutdown")
+
+	if err := <-httpDone; err != nil {
+		logHTTP.Error("HTTP-запросы не завершились вовремя", "error", err)
+	}
+	if redirectServer != nil {
+		redirectServer.Shutdown(ctx)
+	}
+
+	backgroundWG.Wait()
+
+	if err := db.Save(dataPath("users.json")); err != nil {
+		logDB.Error("ошибка сохранения пользователей", "error", err)
+	} else {
+		logDB.Info("пользователи сохранены", "users", db.Count())
+	}
+
+	logHTTP.Info("сервер остановлен")
+	closeLogFile()
+}
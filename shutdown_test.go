@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// useShuttingDown включает признак остановки на время теста
+func useShuttingDown(t *testing.T) {
+	t.Helper()
+	shuttingDown.Store(true)
+	t.Cleanup(func() { shuttingDown.Store(false) })
+}
+
+func TestRejectWhileShuttingDown(t *testing.T) {
+	tests := []struct {
+		method       string
+		shuttingDown bool
+		want         int
+	}{
+		{http.MethodPost, false, http.StatusOK},
+		{http.MethodGet, true, http.StatusOK},
+		{http.MethodHead, true, http.StatusOK},
+		{http.MethodOptions, true, http.StatusOK},
+		{http.MethodPost, true, http.StatusServiceUnavailable},
+		{http.MethodPut, true, http.StatusServiceUnavailable},
+		{http.MethodPatch, true, http.StatusServiceUnavailable},
+		{http.MethodDelete, true, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			useTestConfig(t)
+			if tt.shuttingDown {
+				useShuttingDown(t)
+			}
+			handler := rejectWhileShuttingDown(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(tt.method, "/api/v1/users", nil))
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want == http.StatusServiceUnavailable &&
+				(rec.Header().Get("Retry-After") == "" || rec.Header().Get("Connection") != "close") {
+				t.Errorf("headers = %v, want Retry-After and Connection: close", rec.Header())
+			}
+		})
+	}
+}
+
+func TestGracefulShutdownClosesListenerDuringWSDrain(t *testing.T) {
+	useTestConfig(t)
+	useTestDB(t)
+	t.Cleanup(func() { shuttingDown.Store(false) })
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}
+	go server.Serve(listener)
+
+	// Клиент не отвечает на close-фрейм, и отключение ждет closeWaitTimeout
+	testWSPair(t)
+
+	done := make(chan struct{})
+	go func() {
+		gracefulShutdown(server, nil)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(closeWaitTimeout / 2)
+	for {
+		conn, err := net.DialTimeout("tcp", listener.Addr().String(), 100*time.Millisecond)
+		if err != nil {
+			break
+		}
+		conn.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("HTTP listener still accepts connections while WebSocket clients drain")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	select {
+	case <-done:
+		t.Fatal("WebSocket drain finished before the check; test is not exercising the parallel shutdown")
+	default:
+	}
+
+	select {
+	case <-done:
+	case <-time.After(cfg.ShutdownTimeout.Duration + closeWaitTimeout + time.Second):
+		t.Fatal("gracefulShutdown did not return")
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Срок действия самоподписанного сертификата и запас до его обновления
+const (
+	selfSignedValidity = 365 * 24 * time.Hour
+	selfSignedRenewal  = 30 * 24 * time.Hour
+)
+
+// TLSConfig - настройки HTTPS
+type TLSConfig struct {
+	CertFile     string   `json:"cert_file"`
+	KeyFile      string   `json:"key_file"`
+	SelfSigned   bool     `json:"self_signed"`   // сгенерировать и закешировать сертификат в data_dir
+	Hosts        []string `json:"hosts"`         // имена и IP для самоподписанного сертификата
+	RedirectAddr string   `json:"redirect_addr"` // HTTP-адрес с перенаправлением на HTTPS
+}
+
+// Enabled сообщает, что сервер работает по HTTPS
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" || t.SelfSigned
+}
+
+// certificateFiles возвращает пути к сертификату и ключу, при необходимости создавая самоподписанные
+func (t TLSConfig) certificateFiles() (string, string, error) {
+	if !t.SelfSigned {
+		return t.CertFile, t.KeyFile, nil
+	}
+
+	certFile := dataPath(filepath.Join("tls", "cert.pem"))
+	keyFile := dataPath(filepath.Join("tls", "key.pem"))
+
+	if cert, err := tls.LoadX509KeyPair(certFile, keyFile); err == nil {
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err == nil && time.Until(leaf.NotAfter) > selfSignedRenewal && certCoversHosts(leaf, t.Hosts) {
+			logHTTP.Info("используется закешированный самоподписанный сертификат",
+				"file", certFile, "expires", leaf.NotAfter.Format(time.RFC3339))
+			return certFile, keyFile, nil
+		}
+	}
+
+	if err := generateSelfSigned(certFile, keyFile, t.Hosts); err != nil {
+		return "", "", fmt.Errorf("self-signed certificate: %w", err)
+	}
+	logHTTP.Warn("создан самоподписанный сертификат, используйте его только для локальной разработки",
+		"file", certFile, "hosts", t.Hosts)
+	return certFile, keyFile, nil
+}
+
+// certCoversHosts проверяет, что сертификат выдан на все нужные имена
+func certCoversHosts(cert *x509.Certificate, hosts []string) bool {
+	for _, host := range hosts {
+		if cert.VerifyHostname(host) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// generateSelfSigned создает ключ ECDSA P-256 и самоподписанный сертификат
+func generateSelfSigned(certFile, keyFile string, hosts []string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"UserManager Pro (local development)"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(certFile), 0o700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+		return err
+	}
+	// WriteFile задает права только новому файлу, поэтому старый ключ удаляется
+	if err := os.Remove(keyFile); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+}
+
+// newRedirectServer создает HTTP-сервер, перенаправляющий все запросы на HTTPS-адрес
+func newRedirectServer(redirectAddr, httpsAddr string) *http.Server {
+	_, httpsPort, _ := net.SplitHostPort(httpsAddr)
+
+	return &http.Server{
+		Addr:              redirectAddr,
+		ReadHeaderTimeout: 5 * time.Second,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Host без порта может быть IPv6-адресом в скобках
+			host := strings.TrimSuffix(strings.TrimPrefix(r.Host, "["), "]")
+			if h, _, err := net.SplitHostPort(r.Host); err == nil {
+				host = h
+			}
+			if httpsPort != "443" {
+				host = net.JoinHostPort(host, httpsPort)
+			} else if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+				host = "[" + host + "]"
+			}
+			target := "https://" + host + r.URL.RequestURI()
+			http.Redirect(w, r, target, http.StatusPermanentRedirect)
+		}),
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// readTestCert разбирает PEM-сертификат с диска
+func readTestCert(t *testing.T, certFile string) *x509.Certificate {
+	t.Helper()
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		t.Fatalf("%s is not PEM", certFile)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// writeExpiringCert заменяет закешированный сертификат действительным до notAfter
+func writeExpiringCert(t *testing.T, certFile, keyFile string, notAfter time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+}
+
+func TestCertificateFilesCache(t *testing.T) {
+	tests := []struct {
+		name        string
+		hosts       []string
+		prepare     func(t *testing.T, certFile, keyFile string)
+		nextHosts   []string
+		regenerated bool
+	}{
+		{
+			name:      "valid certificate is reused",
+			hosts:     []string{"localhost", "127.0.0.1"},
+			nextHosts: []string{"localhost", "127.0.0.1"},
+		},
+		{
+			name:      "subset of hosts is still covered",
+			hosts:     []string{"localhost", "127.0.0.1", "::1"},
+			nextHosts: []string{"::1"},
+		},
+		{
+			name:        "new host regenerates",
+			hosts:       []string{"localhost"},
+			nextHosts:   []string{"localhost", "dev.example.test"},
+			regenerated: true,
+		},
+		{
+			name:  "certificate near expiry regenerates",
+			hosts: []string{"localhost", "127.0.0.1"},
+			prepare: func(t *testing.T, certFile, keyFile string) {
+				writeExpiringCert(t, certFile, keyFile, time.Now().Add(selfSignedRenewal-time.Hour))
+			},
+			nextHosts:   []string{"localhost", "127.0.0.1"},
+			regenerated: true,
+		},
+		{
+			name:  "certificate outside the renewal window is reused",
+			hosts: []string{"localhost", "127.0.0.1"},
+			prepare: func(t *testing.T, certFile, keyFile string) {
+				writeExpiringCert(t, certFile, keyFile, time.Now().Add(selfSignedRenewal+24*time.Hour))
+			},
+			nextHosts: []string{"localhost", "127.0.0.1"},
+		},
+		{
+			name:  "unreadable key regenerates",
+			hosts: []string{"localhost"},
+			prepare: func(t *testing.T, certFile, keyFile string) {
+				os.WriteFile(keyFile, []byte("broken"), 0o600)
+			},
+			nextHosts:   []string{"localhost"},
+			regenerated: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestConfig(t)
+			captureLogs(t)
+
+			certFile, keyFile, err := TLSConfig{SelfSigned: true, Hosts: tt.hosts}.certificateFiles()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.prepare != nil {
+				tt.prepare(t, certFile, keyFile)
+			}
+			before, _ := os.ReadFile(certFile)
+
+			if _, _, err := (TLSConfig{SelfSigned: true, Hosts: tt.nextHosts}).certificateFiles(); err != nil {
+				t.Fatal(err)
+			}
+			after, _ := os.ReadFile(certFile)
+			if regenerated := !bytes.Equal(before, after); regenerated != tt.regenerated {
+				t.Fatalf("regenerated = %v, want %v", regenerated, tt.regenerated)
+			}
+
+			cert := readTestCert(t, certFile)
+			if !certCoversHosts(cert, tt.nextHosts) {
+				t.Errorf("certificate does not cover %v", tt.nextHosts)
+			}
+			if time.Until(cert.NotAfter) <= selfSignedRenewal {
+				t.Errorf("certificate expires at %v, inside the renewal window", cert.NotAfter)
+			}
+		})
+	}
+}
+
+func TestCertCoversHosts(t *testing.T) {
+	useTestConfig(t)
+	certFile, keyFile := dataPath("cert.pem"), dataPath("key.pem")
+	if err := generateSelfSigned(certFile, keyFile, []string{"localhost", "127.0.0.1", "::1"}); err != nil {
+		t.Fatal(err)
+	}
+	cert := readTestCert(t, certFile)
+
+	tests := []struct {
+		hosts []string
+		want  bool
+	}{
+		{nil, true},
+		{[]string{"localhost"}, true},
+		{[]string{"127.0.0.1", "::1"}, true},
+		{[]string{"localhost", "example.com"}, false},
+		{[]string{"127.0.0.2"}, false},
+		{[]string{"::2"}, false},
+	}
+	for _, tt := range tests {
+		if got := certCoversHosts(cert, tt.hosts); got != tt.want {
+			t.Errorf("certCoversHosts(%v) = %v, want %v", tt.hosts, got, tt.want)
+		}
+	}
+}
+
+func TestSelfSignedKeyPermissions(t *testing.T) {
+	useTestConfig(t)
+	certFile, keyFile := dataPath("tls/cert.pem"), dataPath("tls/key.pem")
+	if err := generateSelfSigned(certFile, keyFile, []string{"localhost"}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("key file mode = %o, want 600", perm)
+	}
+
+	// Ключ, оставленный с широкими правами, при перевыпуске получает 0600
+	if err := os.Chmod(keyFile, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := generateSelfSigned(certFile, keyFile, []string{"localhost"}); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(keyFile); info.Mode().Perm() != 0o600 {
+		t.Errorf("regenerated key file mode = %o, want 600", info.Mode().Perm())
+	}
+}
+
+func TestRedirectServer(t *testing.T) {
+	tests := []struct {
+		name      string
+		httpsAddr string
+		host      string
+		target    string
+		want      string
+	}{
+		{"default port", ":443", "example.com", "/api/v1/users?page=2", "https://example.com/api/v1/users?page=2"},
+		{"default port drops the HTTP port", ":443", "example.com:80", "/", "https://example.com/"},
+		{"non-default port", ":8443", "example.com:8080", "/about.html", "https://example.com:8443/about.html"},
+		{"non-default port without HTTP port", "0.0.0.0:8443", "localhost", "/", "https://localhost:8443/"},
+		{"IPv4 host", ":443", "192.0.2.10:80", "/", "https://192.0.2.10/"},
+		{"IPv6 host on default port", ":443", "[::1]:8080", "/ws", "https://[::1]/ws"},
+		{"IPv6 host on non-default port", ":8443", "[2001:db8::1]:8080", "/", "https://[2001:db8::1]:8443/"},
+		{"IPv6 host without port", ":8443", "[::1]", "/", "https://[::1]:8443/"},
+		{"IPv6 host without port on default port", ":443", "[::1]", "/", "https://[::1]/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newRedirectServer(":8080", tt.httpsAddr)
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			r.Host = tt.host
+			rec := httptest.NewRecorder()
+			server.Handler.ServeHTTP(rec, r)
+
+			if rec.Code != http.StatusPermanentRedirect {
+				t.Errorf("status %d, want %d", rec.Code, http.StatusPermanentRedirect)
+			}
+			if got := rec.Header().Get("Location"); got != tt.want {
+				t.Errorf("Location = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
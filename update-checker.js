@@ -3,7 +3,17 @@ class UpdateChecker {
     constructor() {
         this.lastCheck = localStorage.getItem('last_update_check') || 0;
         this.checkInterval = 5 * 60 * 1000; // 5 минут
-        this.version = '2.0.5';
+        // Отпечаток сборки фронтенда, который сервер встраивает в страницу
+        const meta = document.querySelector('meta[name="app-version"]');
+        this.version = meta ? meta.content : null;
+    }
+
+    // Сравнивает сборку сервера (из /api/version или WebSocket app_version) с загруженной страницей
+    handleServerVersion(info) {
+        if (this.version && info && info.frontend_build && info.frontend_build !== this.version) {
+            console.log('Фронтенд устарел:', this.version, '->', info.frontend_build, '(сервер', info.version + ')');
+            this.showUpdateNotification();
+        }
     }
     
     async checkForUpdates() {
@@ -16,13 +26,9 @@ class UpdateChecker {
         
         try {
             // Проверяем версию на сервере
-            const response = await fetch('/version.json?t=' + Date.now());
+            const response = await fetch(`${CONFIG.API_URL}/version`);
             if (response.ok) {
-                const serverVersion = await response.json();
-                
-                if (serverVersion.version !== this.version) {
-                    this.showUpdateNotification();
-                }
+                this.handleServerVersion(await response.json());
             }
             
             localStorage.setItem('last_update_check', now.toString());
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// buildVersion задается при сборке: go build -ldflags "-X main.buildVersion=2.1.0"
+var buildVersion = ""
+
+// VersionInfo описывает сборку сервера
+type VersionInfo struct {
+	Version       string   `json:"version"`
+	ModuleVersion string   `json:"module_version,omitempty"` // версия модуля Go, например псевдоверсия v0.0.0-...
+	Revision      string   `json:"revision,omitempty"`
+	RevisionTime  string   `json:"revision_time,omitempty"`
+	Modified      bool     `json:"modified"`
+	GoVersion     string   `json:"go_version"`
+	FrontendBuild string   `json:"frontend_build"`
+	Changelog     []string `json:"changelog"`
+}
+
+var (
+	versionOnce sync.Once
+	versionData VersionInfo
+)
+
+// resolveVersion выбирает номер версии: из ldflags, затем из version.json
+func resolveVersion(build, manifest string) string {
+	switch {
+	case build != "":
+		return build
+	case manifest != "":
+		return manifest
+	default:
+		return "dev"
+	}
+}
+
+// versionInfo собирает данные о сборке один раз: ldflags, version.json и runtime/debug.
+// Версия модуля и ревизия из runtime/debug только дополняют номер версии
+func versionInfo() VersionInfo {
+	versionOnce.Do(func() {
+		versionData = VersionInfo{
+			GoVersion: runtime.Version(),
+			Changelog: []string{},
+		}
+
+		var manifest struct {
+			Version   string   `json:"version"`
+			Changelog []string `json:"changelog"`
+		}
+		if data, err := frontendFiles.ReadFile("version.json"); err == nil {
+			if err := json.Unmarshal(data, &manifest); err != nil {
+				logHTTP.Warn("ошибка чтения version.json", "error", err)
+			}
+		}
+		if manifest.Changelog != nil {
+			versionData.Changelog = manifest.Changelog
+		}
+		versionData.Version = resolveVersion(buildVersion, manifest.Version)
+
+		if info, ok := debug.ReadBuildInfo(); ok {
+			if info.Main.Version != "(devel)" {
+				versionData.ModuleVersion = info.Main.Version
+			}
+			versionData.GoVersion = info.GoVersion
+			for _, setting := range info.Settings {
+				switch setting.Key {
+				case "vcs.revision":
+					versionData.Revision = setting.Value
+				case "vcs.time":
+					versionData.RevisionTime = setting.Value
+				case "vcs.modified":
+					versionData.Modified = setting.Value == "true"
+				}
+			}
+		}
+	})
+
+	// Отпечаток фронтенда берется при каждом вызове: versionInfo может быть вызвана до loadFrontend
+	info := versionData
+	info.FrontendBuild = frontendBuild
+	return info
+}
+
+// appVersion возвращает номер версии сервера
+func appVersion() string {
+	return versionInfo().Version
+}
+
+// Информация о версии и сборке
+func apiVersionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	sendJSON(w, http.StatusOK, versionInfo())
+}
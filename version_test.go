@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestResolveVersion(t *testing.T) {
+	tests := []struct {
+		build, manifest, want string
+	}{
+		{"2.1.0", "2.0.1", "2.1.0"},
+		{"", "2.0.1", "2.0.1"},
+		{"", "", "dev"},
+	}
+	for _, tt := range tests {
+		if got := resolveVersion(tt.build, tt.manifest); got != tt.want {
+			t.Errorf("resolveVersion(%q, %q) = %q, want %q", tt.build, tt.manifest, got, tt.want)
+		}
+	}
+}
+
+func TestAPIVersionResponse(t *testing.T) {
+	useTestFrontend(t)
+	rec := httptest.NewRecorder()
+	apiVersionHandler(rec, httptest.NewRequest(http.MethodGet, "/api/v1/version", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"version", "modified", "go_version", "frontend_build", "changelog"} {
+		if _, exists := body[key]; !exists {
+			t.Errorf("response has no %q: %s", key, rec.Body)
+		}
+	}
+	if version, _ := body["version"].(string); version == "" || version != appVersion() {
+		t.Errorf("version = %v, want %q", body["version"], appVersion())
+	}
+	if goVersion, _ := body["go_version"].(string); !strings.HasPrefix(goVersion, "go") {
+		t.Errorf("go_version = %v, want a Go release", body["go_version"])
+	}
+	if body["frontend_build"] != frontendBuild {
+		t.Errorf("frontend_build = %v, want %q", body["frontend_build"], frontendBuild)
+	}
+	if _, isList := body["changelog"].([]interface{}); !isList {
+		t.Errorf("changelog = %v, want a list", body["changelog"])
+	}
+
+	rec = httptest.NewRecorder()
+	apiVersionHandler(rec, httptest.NewRequest(http.MethodPost, "/api/v1/version", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestWebSocketPushesAppVersion(t *testing.T) {
+	useTestConfig(t)
+	useTestFrontend(t)
+	captureLogs(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(handleWebSocket))
+	t.Cleanup(srv.Close)
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"?clientId=version-test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	// Версия приходит сразу после приветствия
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var types []string
+	for {
+		var msg struct {
+			Type string          `json:"type"`
+			Data json.RawMessage `json:"data"`
+		}
+		if err := client.ReadJSON(&msg); err != nil {
+			t.Fatalf("after %v: %v", types, err)
+		}
+		types = append(types, msg.Type)
+		if msg.Type != "app_version" {
+			continue
+		}
+
+		var info VersionInfo
+		if err := json.Unmarshal(msg.Data, &info); err != nil {
+			t.Fatal(err)
+		}
+		if info.FrontendBuild == "" || info.FrontendBuild != frontendBuild {
+			t.Errorf("frontend_build = %q, want %q", info.FrontendBuild, frontendBuild)
+		}
+		if info.Version != appVersion() {
+			t.Errorf("version = %q, want %q", info.Version, appVersion())
+		}
+		break
+	}
+	if types[0] != "connected" {
+		t.Errorf("messages %v, want connected before app_version", types)
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Время жизни одноразового билета для подключения к /ws
+const wsTicketTTL = 30 * time.Second
+
+// wsTicket - билет, выданный подтвержденной учетной записи или ключу
+type wsTicket struct {
+	name      string
+	session   string // access-токен, если билет выдан по сессии
+	ip        string
+	expiresAt time.Time
+}
+
+var (
+	wsTicketsMu sync.Mutex
+	wsTickets   = make(map[string]wsTicket)
+)
+
+// wsMessagePermissions - входящие WebSocket-сообщения, доступные только с разрешением.
+// Данные пользователей и изменения идут только через REST, поэтому режимы сообщения
+// не закрывают; разрешение, закрываемое режимом, потребует и проверки режима
+var wsMessagePermissions = map[string]string{
+	"get_clients": permClientsRead,
+}
+
+// issueWSTicket выдает билет; истекшие билеты удаляются заодно
+func issueWSTicket(name, session, ip string) (string, time.Time) {
+	ticket := randomHex(24)
+	now := time.Now()
+	expiresAt := now.Add(wsTicketTTL)
+
+	wsTicketsMu.Lock()
+	defer wsTicketsMu.Unlock()
+	for key, t := range wsTickets {
+		if now.After(t.expiresAt) {
+			delete(wsTickets, key)
+		}
+	}
+	wsTickets[ticket] = wsTicket{name: name, session: session, ip: ip, expiresAt: expiresAt}
+	return ticket, expiresAt
+}
+
+// consumeWSTicket погашает билет: он действует один раз, недолго и только с IP, получившего его
+func consumeWSTicket(ticket, ip string) (wsTicket, bool) {
+	wsTicketsMu.Lock()
+	t, exists := wsTickets[ticket]
+	delete(wsTickets, ticket)
+	wsTicketsMu.Unlock()
+
+	if !exists || time.Now().After(t.expiresAt) || t.ip != ip {
+		return wsTicket{}, false
+	}
+	return t, true
+}
+
+// requestSession возвращает access-токен сессии, которой подтвержден запрос
+func requestSession(r *http.Request) string {
+	if bearer := bearerToken(r); bearer != "" && !strings.HasPrefix(bearer, apiKeyPrefix) {
+		return bearer
+	}
+	return ""
+}
+
+// wsTicketResponse - ответ POST /api/v1/ws-ticket
+type wsTicketResponse struct {
+	Ticket    string    `json:"ticket"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Role      string    `json:"role"`
+}
+
+// Выдача билета для подключения к /ws по учетным данным из заголовков
+func apiWSTicketHandler(w http.ResponseWriter, r *http.Request) {
+	name, role := requestRole(r)
+	if role == roleAnonymous {
+		denyAdmin(w, r)
+		return
+	}
+
+	ticket, expiresAt := issueWSTicket(name, requestSession(r), clientIP(r))
+	sendJSON(w, http.StatusOK, wsTicketResponse{Ticket: ticket, ExpiresAt: expiresAt.UTC(), Role: role})
+}
+
+// wsPrincipal определяет учетную запись и сессию при подключении: по билету ?ticket= или заголовкам.
+// admin_token в строке запроса для /ws не принимается - URL попадает в журналы прокси
+func wsPrincipal(r *http.Request) (string, string) {
+	if ticket := r.URL.Query().Get("ticket"); ticket != "" {
+		t, ok := consumeWSTicket(ticket, clientIP(r))
+		if !ok {
+			logWS.WarnContext(r.Context(), "недействительный билет WebSocket", "ip", clientIP(r))
+		}
+		return t.name, t.session
+	}
+	if r.URL.Query().Has("admin_token") {
+		logWS.WarnContext(r.Context(), "admin_token в URL /ws игнорируется, используйте /api/v1/ws-ticket", "ip", clientIP(r))
+		return "", ""
+	}
+	if hasAdminCredentials(r) {
+		if name, role := requestRole(r); role != roleAnonymous {
+			return name, requestSession(r)
+		}
+	}
+	return "", ""
+}
+
+// setClientPrincipal меняет учетную запись живого подключения; session - access-токен,
+// если права получены по сессии
+func setClientPrincipal(conn *websocket.Conn, name, session string) (string, string) {
+	role := roleAnonymous
+	if name != "" {
+		role = roleOf(name)
+	}
+
+	infoMu.Lock()
+	if info, exists := clientInfo[conn]; exists {
+		info.Name = name
+		info.Role = role
+		info.IsAdmin = role == roleAdmin
+		info.session = session
+	}
+	infoMu.Unlock()
+	return name, role
+}
+
+// Причины сброса прав подключения, не связанные с сессией
+var (
+	errAccountRemoved = errors.New("account removed")
+	errRoleChanged    = errors.New("account role changed")
+)
+
+// clientPrincipal возвращает учетную запись и роль подключения. Права сверяются с
+// учетной записью и сессией: после удаления записи, смены ее роли, выхода, отзыва
+// или истечения сессии подключение становится анонимным и получает auth_result с причиной
+func clientPrincipal(conn *websocket.Conn) (string, string, bool) {
+	infoMu.RLock()
+	info, exists := clientInfo[conn]
+	var name, role, session string
+	if exists {
+		name, role, session = info.Name, info.Role, info.session
+	}
+	infoMu.RUnlock()
+	if !exists || name == "" {
+		return name, role, exists
+	}
+
+	var err error
+	switch current := roleOf(name); {
+	case current == roleAnonymous:
+		err = errAccountRemoved
+	case current != role:
+		err = errRoleChanged
+	case session != "":
+		_, err = parseSession(session, sessionAccess)
+	}
+	if err != nil {
+		prevName := name
+		name, role = setClientPrincipal(conn, "", "")
+		logWS.Info("права WebSocket клиента сброшены", "user", prevName, "reason", err)
+		sendToClient(conn, "auth_result", map[string]interface{}{
+			"user":     name,
+			"role":     role,
+			"is_admin": false,
+			"reason":   err.Error(),
+		})
+	}
+	return name, role, true
+}
+
+// clientAllows проверяет разрешение подключения в текущем режиме
+func clientAllows(conn *websocket.Conn, permission string) bool {
+	name, role, exists := clientPrincipal(conn)
+	if !exists {
+		return false
+	}
+
+	modeMutex.RLock()
+	currentMode := serverMode
+	modeMutex.RUnlock()
+	return allows(name, role, permission, currentMode)
+}
+
+// handleWSAuth обрабатывает {"type": "auth"}: ticket или token (сессия, API-ключ) повышают
+// права подключения, {"type": "auth", "logout": true} возвращает его к анонимному
+func handleWSAuth(conn *websocket.Conn, upgrade *http.Request, msg map[string]interface{}) (string, string, bool) {
+	if logout, _ := msg["logout"].(bool); logout {
+		name, role := setClientPrincipal(conn, "", "")
+		return name, role, true
+	}
+
+	ip := clientIP(upgrade)
+	if ticket, _ := msg["ticket"].(string); ticket != "" {
+		t, ok := consumeWSTicket(ticket, ip)
+		if !ok {
+			return "", "", false
+		}
+		name, role := setClientPrincipal(conn, t.name, t.session)
+		return name, role, true
+	}
+
+	if token, _ := msg["token"].(string); token != "" {
+		// Проверяем токен так же, как заголовок Authorization, с учетом блокировки
+		authRequest := upgrade.Clone(context.WithoutCancel(upgrade.Context()))
+		authRequest.Header = http.Header{"Authorization": {"Bearer " + token}}
+		authRequest.URL.RawQuery = ""
+		name, ok := verifyAdminRequest(authRequest)
+		if !ok {
+			return "", "", false
+		}
+		name, role := setClientPrincipal(conn, name, requestSession(authRequest))
+		return name, role, true
+	}
+	return "", "", false
+}
+
+// clientsSnapshot возвращает список подключений для /api/v1/clients и get_clients
+func clientsSnapshot() []map[string]interface{} {
+	infoMu.RLock()
+	defer infoMu.RUnlock()
+	clientsList := make([]map[string]interface{}, 0, len(clientInfo))
+	for _, info := range clientInfo {
+		clientsList = append(clientsList, map[string]interface{}{
+			"ip":         info.IP,
+			"client_id":  info.ClientID,
+			"is_admin":   info.IsAdmin,
+			"role":       info.Role,
+			"user":       info.Name,
+			"last_seen":  info.LastSeen.Format("2006-01-02 15:04:05"),
+			"user_agent": info.UserAgent,
+			"connected":  time.Since(info.LastSeen) < 30*time.Second,
+			"idle_time":  time.Since(info.LastSeen).Round(time.Second).String(),
+		})
+	}
+	return clientsList
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// testWSPair возвращает серверную и клиентскую стороны настоящего WebSocket-соединения
+func testWSPair(t *testing.T) (server, client *websocket.Conn) {
+	t.Helper()
+	accepted := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		accepted <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server = <-accepted
+	clientsMu.Lock()
+	clients[server] = new(sync.Mutex)
+	clientsMu.Unlock()
+	t.Cleanup(func() {
+		clientsMu.Lock()
+		delete(clients, server)
+		clientsMu.Unlock()
+		client.Close()
+		server.Close()
+	})
+	return server, client
+}
+
+func TestClientPrincipalFollowsSession(t *testing.T) {
+	tests := []struct {
+		name   string
+		revoke func(tokens sessionTokens)
+		reason string
+	}{
+		{"session stays valid", func(sessionTokens) {}, ""},
+		{"logout", func(tokens sessionTokens) {
+			revokeSession(tokens.SessionID, time.Now().Add(time.Hour))
+		}, errSessionRevoked.Error()},
+		{"all sessions of admin revoked", func(tokens sessionTokens) {
+			time.Sleep(2 * time.Millisecond)
+			revokeAdminSessions(tokens.Admin)
+		}, errSessionRevoked.Error()},
+		{"session expired", func(sessionTokens) {
+			time.Sleep(300 * time.Millisecond)
+		}, errSessionExpired.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestConfig(t)
+			useTestSessions(t)
+			addTestAdmin(t, "alice", roleAdmin)
+			if tt.reason == errSessionExpired.Error() {
+				cfg.SessionTTL = Duration{200 * time.Millisecond}
+			}
+			server, client := testWSPair(t)
+			useTestClients(t)
+			logs := captureLogs(t)
+
+			tokens := issueSession("alice")
+			infoMu.Lock()
+			clientInfo[server] = &ClientData{ClientID: "c1"}
+			infoMu.Unlock()
+			setClientPrincipal(server, "alice", tokens.AccessToken)
+			if !clientAllows(server, permClientsRead) {
+				t.Fatal("admin session does not grant clients:read")
+			}
+
+			tt.revoke(tokens)
+			name, role, _ := clientPrincipal(server)
+			if tt.reason == "" {
+				if name != "alice" || role != roleAdmin {
+					t.Fatalf("valid session downgraded to %q/%q", name, role)
+				}
+				return
+			}
+			if name != "" || role != roleAnonymous || clientAllows(server, permClientsRead) {
+				t.Fatalf("revoked session kept rights: %q/%q", name, role)
+			}
+
+			client.SetReadDeadline(time.Now().Add(time.Second))
+			var msg struct {
+				Type string                 `json:"type"`
+				Data map[string]interface{} `json:"data"`
+			}
+			_, data, err := client.ReadMessage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(data, &msg); err != nil {
+				t.Fatal(err)
+			}
+			if msg.Type != "auth_result" || msg.Data["role"] != roleAnonymous || msg.Data["reason"] != tt.reason {
+				t.Fatalf("unexpected notification: %s", data)
+			}
+
+			// Запись аудита называет учетную запись, у которой забрали права
+			var logged bool
+			for _, record := range logs.records(t) {
+				if record["subsystem"] == subsystemWS && record["reason"] == tt.reason {
+					if record["user"] != "alice" {
+						t.Errorf("audit record user = %v, want alice", record["user"])
+					}
+					logged = true
+				}
+			}
+			if !logged {
+				t.Error("revocation was not logged")
+			}
+		})
+	}
+}
+
+func TestClientPrincipalFollowsAccount(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func()
+		reason string
+	}{
+		{"role unchanged", func() {}, ""},
+		{"demoted", func() { admins.SetRole("alice", roleViewer) }, errRoleChanged.Error()},
+		{"account deleted", func() { removeTestAdmin("alice") }, errAccountRemoved.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestConfig(t)
+			addTestAdmin(t, "alice", roleAdmin)
+			server, client := testWSPair(t)
+			useTestClients(t)
+			captureLogs(t)
+
+			// Подключение по паролю: без сессии, права держатся только на учетной записи
+			infoMu.Lock()
+			clientInfo[server] = &ClientData{ClientID: "c1"}
+			infoMu.Unlock()
+			setClientPrincipal(server, "alice", "")
+			if !clientAllows(server, permClientsRead) {
+				t.Fatal("admin does not have clients:read")
+			}
+
+			tt.change()
+			broadcastToAdmins("admin_lockout", map[string]interface{}{"ip": "192.0.2.1"})
+
+			client.SetReadDeadline(time.Now().Add(time.Second))
+			var msg struct {
+				Type string                 `json:"type"`
+				Data map[string]interface{} `json:"data"`
+			}
+			if err := client.ReadJSON(&msg); err != nil {
+				t.Fatal(err)
+			}
+			if tt.reason == "" {
+				if msg.Type != "admin_lockout" {
+					t.Fatalf("admin got %s, want admin_lockout", msg.Type)
+				}
+				if name, role, _ := clientPrincipal(server); name != "alice" || role != roleAdmin {
+					t.Fatalf("unchanged account downgraded to %q/%q", name, role)
+				}
+				return
+			}
+
+			if msg.Type != "auth_result" || msg.Data["role"] != roleAnonymous || msg.Data["reason"] != tt.reason {
+				t.Fatalf("unexpected notification: %+v", msg)
+			}
+			if name, role, _ := clientPrincipal(server); name != "" || role != roleAnonymous {
+				t.Fatalf("connection kept %q/%q", name, role)
+			}
+			if clientAllows(server, permClientsRead) {
+				t.Error("connection still has clients:read")
+			}
+			infoMu.RLock()
+			isAdmin := clientInfo[server].IsAdmin
+			infoMu.RUnlock()
+			if isAdmin {
+				t.Error("connection is still marked as admin")
+			}
+
+			// admin_lockout до подключения больше не доходит
+			client.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			if err := client.ReadJSON(&msg); err == nil {
+				t.Errorf("unexpected message after reset: %+v", msg)
+			}
+		})
+	}
+}
+
+func TestWSTicketCarriesSession(t *testing.T) {
+	ticket, _ := issueWSTicket("alice", "session-token", "192.0.2.1")
+	if _, ok := consumeWSTicket(ticket, "192.0.2.2"); ok {
+		t.Fatal("ticket accepted from another IP")
+	}
+
+	ticket, _ = issueWSTicket("alice", "session-token", "192.0.2.1")
+	got, ok := consumeWSTicket(ticket, "192.0.2.1")
+	if !ok || got.name != "alice" || got.session != "session-token" {
+		t.Fatalf("consumeWSTicket = %+v, %v", got, ok)
+	}
+	if _, ok := consumeWSTicket(ticket, "192.0.2.1"); ok {
+		t.Fatal("ticket accepted twice")
+	}
+}
+
+func TestConcurrentWritesToClient(t *testing.T) {
+	server, client := testWSPair(t)
+
+	const writers, messages = 8, 50
+	// Крупные сообщения пишутся несколькими фреймами, и записи без блокировки пересекаются
+	payload := strings.Repeat("x", 64<<10)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < messages; j++ {
+				// Рассылки, ответы обработчика и auth_result пишут в одно соединение одновременно
+				if i%2 == 0 {
+					broadcastToAll("ping", payload)
+				} else if err := sendToClient(server, "pong", payload); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for received := 0; received < writers*messages; received++ {
+		var msg map[string]interface{}
+		if err := client.ReadJSON(&msg); err != nil {
+			t.Fatalf("after %d messages: %v", received, err)
+		}
+	}
+	wg.Wait()
+
+	clientsMu.Lock()
+	delete(clients, server)
+	clientsMu.Unlock()
+	if err := sendToClient(server, "pong", nil); err != errClientGone {
+		t.Errorf("sendToClient after disconnect = %v, want %v", err, errClientGone)
+	}
+}